@@ -0,0 +1,312 @@
+package catalog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"task4/models"
+)
+
+// bibEntry is one @type{key, field = value, ...} block.
+type bibEntry struct {
+	Type   string
+	Key    string
+	Fields []bibField
+}
+
+type bibField struct {
+	Name  string
+	Value string
+}
+
+// ReadBibTeX parses BibTeX entries. Each entry becomes a book; the citation
+// key "book<ID>" (as written by WriteBibTeX) restores the ID. @string,
+// @preamble and @comment blocks are skipped.
+func ReadBibTeX(r io.Reader) ([]models.Book, ImportReport, error) {
+	var report ImportReport
+	src, err := io.ReadAll(bufio.NewReader(r))
+	if err != nil {
+		return nil, report, err
+	}
+
+	entries, err := parseBibTeX(string(src))
+	if err != nil {
+		return nil, report, err
+	}
+
+	books := make([]models.Book, 0, len(entries))
+	for _, e := range entries {
+		report.Records++
+		n := report.Records
+		book := models.Book{Status: "Available"}
+
+		if e.Type != "book" {
+			report.skip(n, "@"+e.Type, e.Key)
+		}
+		if id, err := strconv.Atoi(strings.TrimPrefix(e.Key, "book")); err == nil && strings.HasPrefix(e.Key, "book") {
+			book.ID = id
+		} else {
+			report.skip(n, "key", e.Key)
+		}
+
+		for _, f := range e.Fields {
+			v := unescapeBibTeX(f.Value)
+			switch f.Name {
+			case "title":
+				book.Title = v
+			case "author":
+				book.Author = v
+			case "publisher":
+				book.Publisher = v
+			case "year":
+				if y := parseYear(v); y != 0 {
+					book.Year = y
+				} else {
+					report.skip(n, f.Name, v)
+				}
+			case "isbn":
+				book.ISBN = cleanISBN(v)
+			case "keywords":
+				// Ours are separated by semicolons, since subjects may
+				// hold commas; other files mostly use commas.
+				sep := ";"
+				if !strings.Contains(v, ";") {
+					sep = ","
+				}
+				for _, k := range strings.Split(v, sep) {
+					if k = strings.TrimSpace(k); k != "" {
+						book.Subjects = append(book.Subjects, k)
+					}
+				}
+			default:
+				report.skip(n, f.Name, v)
+			}
+		}
+		books = append(books, book)
+	}
+	return books, report, nil
+}
+
+// WriteBibTeX writes books as @book entries.
+func WriteBibTeX(w io.Writer, books []models.Book) error {
+	bw := bufio.NewWriter(w)
+	for i, b := range books {
+		if i > 0 {
+			bw.WriteString("\n")
+		}
+		fmt.Fprintf(bw, "@book{book%d,\n", b.ID)
+		field := func(name, value string) {
+			if value != "" {
+				fmt.Fprintf(bw, "  %-9s = {%s},\n", name, escapeBibTeX(value))
+			}
+		}
+		field("title", b.Title)
+		field("author", b.Author)
+		field("publisher", b.Publisher)
+		if b.Year != 0 {
+			field("year", strconv.Itoa(b.Year))
+		}
+		field("isbn", b.ISBN)
+		keywords := strings.Join(b.Subjects, "; ")
+		if strings.Contains(keywords, ",") && !strings.Contains(keywords, ";") {
+			keywords += ";" // or one subject with a comma reads back as two
+		}
+		field("keywords", keywords)
+		bw.WriteString("}\n")
+	}
+	return bw.Flush()
+}
+
+var bibEscapes = strings.NewReplacer(`&`, `\&`, `%`, `\%`, `$`, `\$`, `#`, `\#`, `_`, `\_`, `{`, `\{`, `}`, `\}`)
+
+var bibUnescapes = strings.NewReplacer(`\&`, `&`, `\%`, `%`, `\$`, `$`, `\#`, `#`, `\_`, `_`, `\{`, `{`, `\}`, `}`)
+
+func escapeBibTeX(s string) string { return bibEscapes.Replace(s) }
+
+// unescapeBibTeX undoes escapeBibTeX and drops the protective braces authors
+// put around words, e.g. "{Go} Programming".
+func unescapeBibTeX(s string) string {
+	s = bibUnescapes.Replace(strings.ReplaceAll(strings.ReplaceAll(s, `\{`, "\x00"), `\}`, "\x01"))
+	s = strings.NewReplacer("{", "", "}", "", "\x00", "{", "\x01", "}").Replace(s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func parseBibTeX(src string) ([]bibEntry, error) {
+	p := &bibParser{src: src}
+	var entries []bibEntry
+	for {
+		at := strings.IndexByte(p.src[p.pos:], '@')
+		if at < 0 {
+			return entries, nil
+		}
+		p.pos += at + 1
+		typ := strings.ToLower(p.ident())
+		p.space()
+		if p.pos >= len(p.src) || (p.src[p.pos] != '{' && p.src[p.pos] != '(') {
+			return nil, p.errorf("expected { after @%s", typ)
+		}
+		open := p.src[p.pos]
+		p.pos++
+
+		switch typ {
+		case "comment", "preamble", "string":
+			if _, err := p.balanced(open); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		e := bibEntry{Type: typ}
+		p.space()
+		e.Key = strings.TrimSpace(p.until(",}) \t\r\n"))
+		for {
+			p.space()
+			if p.pos >= len(p.src) {
+				return nil, p.errorf("unterminated @%s{%s", typ, e.Key)
+			}
+			c := p.src[p.pos]
+			if c == ',' {
+				p.pos++
+				continue
+			}
+			if c == '}' || c == ')' {
+				p.pos++
+				break
+			}
+			name := strings.ToLower(p.ident())
+			if name == "" {
+				return nil, p.errorf("expected field name in @%s{%s", typ, e.Key)
+			}
+			p.space()
+			if p.pos >= len(p.src) || p.src[p.pos] != '=' {
+				return nil, p.errorf("expected = after %s", name)
+			}
+			p.pos++
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			e.Fields = append(e.Fields, bibField{Name: name, Value: value})
+		}
+		entries = append(entries, e)
+	}
+}
+
+type bibParser struct {
+	src string
+	pos int
+}
+
+func (p *bibParser) errorf(format string, args ...any) error {
+	line := strings.Count(p.src[:min(p.pos, len(p.src))], "\n") + 1
+	return fmt.Errorf("bibtex line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (p *bibParser) space() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *bibParser) ident() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '_' || c == '-' || c == ':' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *bibParser) until(stop string) string {
+	start := p.pos
+	for p.pos < len(p.src) && !strings.ContainsRune(stop, rune(p.src[p.pos])) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// balanced consumes up to the delimiter matching an already consumed opening
+// brace or parenthesis and returns what was inside.
+func (p *bibParser) balanced(open byte) (string, error) {
+	closeCh := byte('}')
+	if open == '(' {
+		closeCh = ')'
+	}
+	start, depth := p.pos, 0
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '\\' && p.pos+1 < len(p.src):
+			p.pos += 2
+			continue
+		case c == '{' && open == '{':
+			depth++
+		case c == closeCh && depth == 0:
+			p.pos++
+			return p.src[start : p.pos-1], nil
+		case c == '}' && open == '{':
+			depth--
+		}
+		p.pos++
+	}
+	return "", errors.New("bibtex: unbalanced braces")
+}
+
+// value reads a field value: {braced}, "quoted" or a bare number/macro,
+// joined with # concatenation.
+func (p *bibParser) value() (string, error) {
+	var sb strings.Builder
+	for {
+		p.space()
+		if p.pos >= len(p.src) {
+			return "", p.errorf("missing value")
+		}
+		switch c := p.src[p.pos]; {
+		case c == '{':
+			p.pos++
+			part, err := p.balanced('{')
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(part)
+		case c == '"':
+			p.pos++
+			start, depth := p.pos, 0
+			for p.pos < len(p.src) && (p.src[p.pos] != '"' || depth > 0) {
+				switch p.src[p.pos] {
+				case '{':
+					depth++
+				case '}':
+					depth--
+				}
+				p.pos++
+			}
+			if p.pos >= len(p.src) {
+				return "", p.errorf("unterminated quoted value")
+			}
+			sb.WriteString(p.src[start:p.pos])
+			p.pos++
+		default:
+			word := p.ident()
+			if word == "" {
+				return "", p.errorf("unexpected %q in value", c)
+			}
+			sb.WriteString(word)
+		}
+		p.space()
+		if p.pos < len(p.src) && p.src[p.pos] == '#' {
+			p.pos++
+			continue
+		}
+		return sb.String(), nil
+	}
+}
@@ -0,0 +1,213 @@
+// Package catalog converts books to and from the record formats catalogers
+// and academics exchange: MARC 21 (ISO 2709), MARCXML and BibTeX.
+package catalog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"task4/models"
+)
+
+// ImportReport lists everything an import could not map onto a book.
+type ImportReport struct {
+	Records  int
+	Unmapped []UnmappedField
+}
+
+type UnmappedField struct {
+	Record int // 1-based position in the input
+	Field  string
+	Value  string
+}
+
+func (r ImportReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d record(s) read, %d field(s) not mapped", r.Records, len(r.Unmapped))
+	for _, u := range r.Unmapped {
+		fmt.Fprintf(&b, "\n  record %d: %s = %q", u.Record, u.Field, u.Value)
+	}
+	return b.String()
+}
+
+func (r *ImportReport) skip(record int, field, value string) {
+	r.Unmapped = append(r.Unmapped, UnmappedField{Record: record, Field: field, Value: value})
+}
+
+// marcRecord is the format-neutral shape shared by ISO 2709 and MARCXML.
+type marcRecord struct {
+	Leader  string
+	Control []controlField
+	Data    []dataField
+}
+
+type controlField struct {
+	Tag   string
+	Value string
+}
+
+type dataField struct {
+	Tag       string
+	Ind1      byte
+	Ind2      byte
+	Subfields []subfield
+}
+
+type subfield struct {
+	Code  byte
+	Value string
+}
+
+func (f dataField) first(code byte) string {
+	for _, sf := range f.Subfields {
+		if sf.Code == code {
+			return sf.Value
+		}
+	}
+	return ""
+}
+
+// bookFromMARC maps the fields we store and reports the rest.
+//
+//	001      control number -> ID (when numeric)
+//	020 $a   ISBN
+//	100 $a   main entry, personal name -> Author
+//	245 $a$b title and remainder -> Title
+//	260/264  $b publisher, $c date -> Publisher, Year
+//	650 $a   topical subject -> Subjects
+//
+// Trailing ISBD punctuation is stripped from names, titles, publishers and
+// subjects unless the leader says the record has none, as marcFromBook's
+// do; their values then come back exactly as written.
+func bookFromMARC(rec marcRecord, n int, report *ImportReport) models.Book {
+	book := models.Book{Status: "Available"}
+	trimPunct := trimISBD
+	if len(rec.Leader) > 18 && rec.Leader[18] == isbdOmitted {
+		trimPunct = strings.TrimSpace
+	}
+
+	for _, cf := range rec.Control {
+		if cf.Tag == "001" {
+			if id, err := strconv.Atoi(strings.TrimSpace(cf.Value)); err == nil {
+				book.ID = id
+				continue
+			}
+		}
+		report.skip(n, cf.Tag, cf.Value)
+	}
+
+	for _, df := range rec.Data {
+		used := map[byte]bool{}
+		switch df.Tag {
+		case "020":
+			if book.ISBN == "" {
+				book.ISBN = cleanISBN(df.first('a'))
+				used['a'] = true
+			}
+		case "100":
+			book.Author = trimPunct(df.first('a'))
+			used['a'] = true
+		case "245":
+			title := trimPunct(df.first('a'))
+			if rest := trimPunct(df.first('b')); rest != "" {
+				title += ": " + rest
+			}
+			book.Title = title
+			used['a'], used['b'] = true, true
+		case "260", "264":
+			if pub := trimPunct(df.first('b')); pub != "" {
+				book.Publisher = pub
+				used['b'] = true
+			}
+			if year := parseYear(df.first('c')); year != 0 {
+				book.Year = year
+				used['c'] = true
+			}
+		case "650":
+			if subject := trimPunct(df.first('a')); subject != "" {
+				book.Subjects = append(book.Subjects, subject)
+				used['a'] = true
+			}
+		}
+
+		for _, sf := range df.Subfields {
+			if used[sf.Code] {
+				used[sf.Code] = false // only the first occurrence was consumed
+				continue
+			}
+			report.skip(n, df.Tag+"$"+string(sf.Code), sf.Value)
+		}
+	}
+	return book
+}
+
+// isbdOmitted in leader position 18 marks a record whose subfields carry
+// no ISBD punctuation.
+const isbdOmitted = 'c'
+
+// marcFromBook writes exactly the fields bookFromMARC reads back. The values
+// go out as stored, without ISBD punctuation, and the leader says so.
+func marcFromBook(book models.Book) marcRecord {
+	rec := marcRecord{Leader: "00000nam a2200000 c 4500"}
+	if book.ID != 0 {
+		rec.Control = append(rec.Control, controlField{Tag: "001", Value: strconv.Itoa(book.ID)})
+	}
+	if book.ISBN != "" {
+		rec.Data = append(rec.Data, dataField{Tag: "020", Ind1: ' ', Ind2: ' ', Subfields: []subfield{{'a', book.ISBN}}})
+	}
+	if book.Author != "" {
+		rec.Data = append(rec.Data, dataField{Tag: "100", Ind1: '1', Ind2: ' ', Subfields: []subfield{{'a', book.Author}}})
+	}
+	ind1 := byte('0')
+	if book.Author != "" {
+		ind1 = '1'
+	}
+	rec.Data = append(rec.Data, dataField{Tag: "245", Ind1: ind1, Ind2: '0', Subfields: []subfield{{'a', book.Title}}})
+	if book.Publisher != "" || book.Year != 0 {
+		f := dataField{Tag: "264", Ind1: ' ', Ind2: '1'}
+		if book.Publisher != "" {
+			f.Subfields = append(f.Subfields, subfield{'b', book.Publisher})
+		}
+		if book.Year != 0 {
+			f.Subfields = append(f.Subfields, subfield{'c', strconv.Itoa(book.Year)})
+		}
+		rec.Data = append(rec.Data, f)
+	}
+	for _, s := range book.Subjects {
+		rec.Data = append(rec.Data, dataField{Tag: "650", Ind1: ' ', Ind2: '0', Subfields: []subfield{{'a', s}}})
+	}
+	return rec
+}
+
+// trimISBD strips the ISBD punctuation catalogers leave at the end of
+// subfields ("Title /", "Author,", "Publisher,").
+func trimISBD(s string) string {
+	return strings.TrimRight(strings.TrimSpace(s), " /:;,.")
+}
+
+// cleanISBN drops qualifiers such as "(pbk.)" after the number.
+func cleanISBN(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, ' '); i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
+
+// parseYear picks the first four-digit run out of a date like "c2015." or "[2016]".
+func parseYear(s string) int {
+	run := 0
+	for i, r := range s {
+		if r >= '0' && r <= '9' {
+			run++
+			if run == 4 {
+				y, _ := strconv.Atoi(s[i-3 : i+1])
+				return y
+			}
+			continue
+		}
+		run = 0
+	}
+	return 0
+}
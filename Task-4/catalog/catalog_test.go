@@ -0,0 +1,76 @@
+package catalog
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"task4/models"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	books := []models.Book{
+		{
+			ID: 1, Title: "Dr. Who: A history.", Author: "Smith, J.", Status: "Available",
+			ISBN: "9780000000002", Publisher: "ACME Inc.", Year: 2015,
+			Subjects: []string{"Television programs.", "Science fiction", "History, Modern"},
+		},
+		{ID: 2, Title: "Untitled /", Status: "Available", Publisher: "Press,", Subjects: []string{"Europe, Eastern"}},
+	}
+	formats := []struct {
+		name  string
+		write func(io.Writer, []models.Book) error
+		read  func(io.Reader) ([]models.Book, ImportReport, error)
+	}{
+		{"marc", WriteMARC, ReadMARC},
+		{"marcxml", WriteMARCXML, ReadMARCXML},
+		{"bibtex", WriteBibTeX, ReadBibTeX},
+	}
+	for _, f := range formats {
+		t.Run(f.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := f.write(&buf, books); err != nil {
+				t.Fatal(err)
+			}
+			got, report, err := f.read(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Unmapped) != 0 {
+				t.Errorf("unmapped fields: %s", report)
+			}
+			if !reflect.DeepEqual(got, books) {
+				t.Errorf("round trip changed the books\n got: %+v\nwant: %+v", got, books)
+			}
+		})
+	}
+}
+
+func TestImportStripsISBDPunctuation(t *testing.T) {
+	const doc = `<collection xmlns="http://www.loc.gov/MARC21/slim"><record>
+<leader>00000nam a2200000 i 4500</leader>
+<datafield tag="100" ind1="1" ind2=" "><subfield code="a">Herbert, Frank,</subfield></datafield>
+<datafield tag="245" ind1="1" ind2="0"><subfield code="a">Dune :</subfield><subfield code="b">a novel /</subfield></datafield>
+<datafield tag="264" ind1=" " ind2="1"><subfield code="b">Chilton,</subfield><subfield code="c">1965.</subfield></datafield>
+</record></collection>`
+	books, _, err := ReadMARCXML(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := books[0]
+	if b.Author != "Herbert, Frank" || b.Title != "Dune: a novel" || b.Publisher != "Chilton" || b.Year != 1965 {
+		t.Errorf("got %+v", b)
+	}
+}
+
+func TestReadBibTeXCommaKeywords(t *testing.T) {
+	books, _, err := ReadBibTeX(strings.NewReader("@book{x,\n  title = {Dune},\n  keywords = {Science fiction, Deserts},\n}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Science fiction", "Deserts"}; !reflect.DeepEqual(books[0].Subjects, want) {
+		t.Errorf("subjects = %q, want %q", books[0].Subjects, want)
+	}
+}
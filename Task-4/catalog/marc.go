@@ -0,0 +1,164 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"task4/models"
+)
+
+// ISO 2709 delimiters.
+const (
+	subfieldDelimiter = 0x1F
+	fieldTerminator   = 0x1E
+	recordTerminator  = 0x1D
+)
+
+// ReadMARC parses a stream of MARC 21 records in ISO 2709 transmission format.
+func ReadMARC(r io.Reader) ([]models.Book, ImportReport, error) {
+	var books []models.Book
+	var report ImportReport
+
+	br := bufio.NewReader(r)
+	for {
+		raw, err := br.ReadBytes(recordTerminator)
+		raw = bytes.TrimLeft(raw, "\r\n")
+		if len(raw) > 0 {
+			report.Records++
+			rec, perr := decodeISO2709(raw)
+			if perr != nil {
+				return nil, report, fmt.Errorf("record %d: %w", report.Records, perr)
+			}
+			books = append(books, bookFromMARC(rec, report.Records, &report))
+		}
+		if errors.Is(err, io.EOF) {
+			return books, report, nil
+		}
+		if err != nil {
+			return nil, report, err
+		}
+	}
+}
+
+func decodeISO2709(raw []byte) (marcRecord, error) {
+	if len(raw) < 25 {
+		return marcRecord{}, errors.New("record shorter than its leader")
+	}
+	leader := string(raw[:24])
+	base, ok := number(raw[12:17])
+	if !ok || base < 25 || base > len(raw) {
+		return marcRecord{}, errors.New("invalid base address of data")
+	}
+
+	rec := marcRecord{Leader: leader}
+	dir := raw[24 : base-1]
+	if len(dir)%12 != 0 {
+		return marcRecord{}, errors.New("malformed directory")
+	}
+	data := raw[base:]
+
+	for i := 0; i < len(dir); i += 12 {
+		tag := string(dir[i : i+3])
+		length, ok1 := number(dir[i+3 : i+7])
+		start, ok2 := number(dir[i+7 : i+12])
+		if !ok1 || !ok2 || length < 1 || start+length > len(data) {
+			return marcRecord{}, fmt.Errorf("bad directory entry for field %s", tag)
+		}
+		field := data[start : start+length-1] // drop the field terminator
+
+		if tag < "010" {
+			rec.Control = append(rec.Control, controlField{Tag: tag, Value: string(field)})
+			continue
+		}
+		if len(field) < 2 {
+			return marcRecord{}, fmt.Errorf("field %s has no indicators", tag)
+		}
+		df := dataField{Tag: tag, Ind1: field[0], Ind2: field[1]}
+		for _, part := range bytes.Split(field[2:], []byte{subfieldDelimiter}) {
+			if len(part) == 0 {
+				continue
+			}
+			df.Subfields = append(df.Subfields, subfield{Code: part[0], Value: string(part[1:])})
+		}
+		rec.Data = append(rec.Data, df)
+	}
+	return rec, nil
+}
+
+// number reads a fixed-width ISO 2709 number, which is digits only: no sign
+// and no spaces.
+func number(b []byte) (int, bool) {
+	n := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n, true
+}
+
+// WriteMARC writes books as MARC 21 records in ISO 2709 format, UTF-8 encoded.
+func WriteMARC(w io.Writer, books []models.Book) error {
+	for _, b := range books {
+		raw, err := encodeISO2709(marcFromBook(b))
+		if err != nil {
+			return fmt.Errorf("book %d: %w", b.ID, err)
+		}
+		if _, err := w.Write(raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeISO2709(rec marcRecord) ([]byte, error) {
+	var dir, data bytes.Buffer
+
+	add := func(tag string, field []byte) error {
+		field = append(field, fieldTerminator)
+		if len(field) > 9999 || data.Len() > 99999 {
+			return fmt.Errorf("field %s too long for ISO 2709", tag)
+		}
+		fmt.Fprintf(&dir, "%s%04d%05d", tag, len(field), data.Len())
+		data.Write(field)
+		return nil
+	}
+
+	for _, cf := range rec.Control {
+		if err := add(cf.Tag, []byte(cf.Value)); err != nil {
+			return nil, err
+		}
+	}
+	for _, df := range rec.Data {
+		field := []byte{df.Ind1, df.Ind2}
+		for _, sf := range df.Subfields {
+			field = append(field, subfieldDelimiter, sf.Code)
+			field = append(field, sf.Value...)
+		}
+		if err := add(df.Tag, field); err != nil {
+			return nil, err
+		}
+	}
+	dir.WriteByte(fieldTerminator)
+
+	base := 24 + dir.Len()
+	total := base + data.Len() + 1
+	if total > 99999 {
+		return nil, errors.New("record too long for ISO 2709")
+	}
+
+	leader := []byte(rec.Leader)
+	copy(leader[0:5], fmt.Sprintf("%05d", total))
+	leader[9] = 'a' // UCS/Unicode
+	copy(leader[12:17], fmt.Sprintf("%05d", base))
+
+	out := make([]byte, 0, total)
+	out = append(out, leader...)
+	out = append(out, dir.Bytes()...)
+	out = append(out, data.Bytes()...)
+	return append(out, recordTerminator), nil
+}
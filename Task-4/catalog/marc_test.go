@@ -0,0 +1,49 @@
+package catalog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"task4/models"
+)
+
+func TestReadMARCRejectsCorruptDirectory(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMARC(&buf, []models.Book{{ID: 7, Title: "Dune", Author: "Herbert, Frank"}}); err != nil {
+		t.Fatal(err)
+	}
+	good := buf.Bytes()
+
+	// The first directory entry follows the leader: tag (3), length (4),
+	// start (5).
+	const length, start = 24 + 3, 24 + 7
+	tests := []struct {
+		name string
+		at   int
+		with string
+	}{
+		{"negative start", start, "-0001"},
+		{"signed start", start, "+0000"},
+		{"spaces in start", start, "   00"},
+		{"start past the data", start, "99999"},
+		{"negative length", length, "-001"},
+		{"zero length", length, "0000"},
+		{"length past the data", length, "9999"},
+		{"base address not a number", 12, "-0025"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := bytes.Clone(good)
+			copy(raw[tt.at:], tt.with)
+			_, _, err := ReadMARC(bytes.NewReader(raw))
+			if err == nil || !strings.HasPrefix(err.Error(), "record 1: ") {
+				t.Fatalf("err = %v, want a record 1 import error", err)
+			}
+		})
+	}
+
+	if _, _, err := ReadMARC(bytes.NewReader(good)); err != nil {
+		t.Fatalf("uncorrupted record: %v", err)
+	}
+}
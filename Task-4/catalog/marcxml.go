@@ -0,0 +1,130 @@
+package catalog
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+
+	"task4/models"
+)
+
+const marcXMLNamespace = "http://www.loc.gov/MARC21/slim"
+
+type xmlCollection struct {
+	XMLName xml.Name    `xml:"http://www.loc.gov/MARC21/slim collection"`
+	Records []xmlRecord `xml:"record"`
+}
+
+type xmlRecord struct {
+	XMLName       xml.Name          `xml:"record"`
+	Leader        string            `xml:"leader"`
+	ControlFields []xmlControlField `xml:"controlfield"`
+	DataFields    []xmlDataField    `xml:"datafield"`
+}
+
+type xmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlDataField struct {
+	Tag       string        `xml:"tag,attr"`
+	Ind1      string        `xml:"ind1,attr"`
+	Ind2      string        `xml:"ind2,attr"`
+	Subfields []xmlSubfield `xml:"subfield"`
+}
+
+type xmlSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// ReadMARCXML parses a MARCXML document whose root is either <collection>
+// or a single <record>.
+func ReadMARCXML(r io.Reader) ([]models.Book, ImportReport, error) {
+	var report ImportReport
+	var records []xmlRecord
+
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, report, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Space != marcXMLNamespace {
+			continue
+		}
+		if start.Name.Local != "record" {
+			continue // descend into <collection>
+		}
+		var rec xmlRecord
+		if err := dec.DecodeElement(&rec, &start); err != nil {
+			return nil, report, err
+		}
+		records = append(records, rec)
+	}
+
+	books := make([]models.Book, 0, len(records))
+	for _, x := range records {
+		report.Records++
+		rec := marcRecord{Leader: x.Leader}
+		for _, cf := range x.ControlFields {
+			rec.Control = append(rec.Control, controlField{Tag: cf.Tag, Value: cf.Value})
+		}
+		for _, df := range x.DataFields {
+			f := dataField{Tag: df.Tag, Ind1: indicator(df.Ind1), Ind2: indicator(df.Ind2)}
+			for _, sf := range df.Subfields {
+				if len(sf.Code) != 1 {
+					return nil, report, fmt.Errorf("record %d: field %s has subfield code %q", report.Records, df.Tag, sf.Code)
+				}
+				f.Subfields = append(f.Subfields, subfield{Code: sf.Code[0], Value: sf.Value})
+			}
+			rec.Data = append(rec.Data, f)
+		}
+		books = append(books, bookFromMARC(rec, report.Records, &report))
+	}
+	return books, report, nil
+}
+
+func indicator(s string) byte {
+	if s == "" {
+		return ' '
+	}
+	return s[0]
+}
+
+// WriteMARCXML writes books as a MARCXML <collection>.
+func WriteMARCXML(w io.Writer, books []models.Book) error {
+	coll := xmlCollection{}
+	for _, b := range books {
+		rec := marcFromBook(b)
+		x := xmlRecord{Leader: rec.Leader}
+		for _, cf := range rec.Control {
+			x.ControlFields = append(x.ControlFields, xmlControlField{Tag: cf.Tag, Value: cf.Value})
+		}
+		for _, df := range rec.Data {
+			f := xmlDataField{Tag: df.Tag, Ind1: string(df.Ind1), Ind2: string(df.Ind2)}
+			for _, sf := range df.Subfields {
+				f.Subfields = append(f.Subfields, xmlSubfield{Code: string(sf.Code), Value: sf.Value})
+			}
+			x.DataFields = append(x.DataFields, f)
+		}
+		coll.Records = append(coll.Records, x)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(coll); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
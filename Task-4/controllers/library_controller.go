@@ -3,12 +3,16 @@ package controllers
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"task4/catalog"
 	"task4/models"
+	"task4/reports"
 	"task4/services"
 )
 
@@ -42,19 +46,189 @@ func simulateConcurrentReservations(lib *services.Library) {
 	fmt.Println("-- Done. Try borrowing as the winning member before 5s passes! --")
 }
 
+func seed(library *services.Library) error {
+	members := []models.Member{
+		{ID: 1, Name: "Alice", Tier: "Premium"},
+		{ID: 2, Name: "Bob", Tier: "Standard"},
+		{ID: 3, Name: "Charlie", Tier: "Student"},
+		{ID: 4, Name: "Dana", Tier: "Standard"},
+		{ID: 5, Name: "Evan", Tier: "Student"},
+	}
+	for _, m := range members {
+		if err := library.RegisterMember(m); err != nil {
+			return err
+		}
+	}
+
+	if err := library.AddBranch(models.Branch{ID: 1, Name: "Central"}); err != nil {
+		return err
+	}
+	if err := library.AddBranch(models.Branch{ID: 2, Name: "Riverside"}); err != nil {
+		return err
+	}
+
+	if err := library.AddBook(models.Book{ID: 1, Title: "The Go Programming Language", Author: "Donovan & Kernighan", Status: "Available", HomeBranchID: 1}); err != nil {
+		return err
+	}
+	return library.AddBook(models.Book{ID: 2, Title: "Concurrency in Go", Author: "Katherine Cox-Buday", Status: "Available", HomeBranchID: 2})
+}
+
+func printState(snap services.Snapshot) {
+	fmt.Printf("\nState as of %s (event #%d)\n", snap.At.Format(time.RFC3339), snap.Seq)
+	fmt.Println("Books:")
+	for _, b := range snap.Books {
+		fmt.Printf("  ID: %d | %s — %s | %s | branch %d\n", b.ID, b.Title, b.Author, b.Status, b.LocationID)
+	}
+	fmt.Println("Loans:")
+	for _, loan := range snap.Loans {
+		returned := "still out"
+		if !loan.Active() {
+			returned = "returned " + loan.ReturnedAt.Format(time.RFC3339)
+		}
+		fmt.Printf("  Book %d -> Member %d | borrowed %s | %s\n", loan.BookID, loan.MemberID, loan.BorrowedAt.Format(time.RFC3339), returned)
+	}
+	fmt.Println("Reservations:")
+	for _, res := range snap.Reservations {
+		fmt.Printf("  Book %d held for Member %d\n", res.BookID, res.MemberID)
+	}
+}
+
+func importCatalog(library *services.Library, path, format string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var books []models.Book
+	var report catalog.ImportReport
+	switch strings.ToLower(format) {
+	case "marc":
+		books, report, err = catalog.ReadMARC(f)
+	case "marcxml":
+		books, report, err = catalog.ReadMARCXML(f)
+	case "bibtex":
+		books, report, err = catalog.ReadBibTeX(f)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	existing := map[int]bool{}
+	nextID := 1
+	for _, b := range library.ListBooks() {
+		existing[b.ID] = true
+		if b.ID >= nextID {
+			nextID = b.ID + 1
+		}
+	}
+	added := 0
+	for _, b := range books {
+		if b.ID == 0 {
+			b.ID = nextID
+		} else if existing[b.ID] {
+			fmt.Printf("Skipped %q: book ID %d already exists.\n", b.Title, b.ID)
+			continue
+		}
+		if b.ID >= nextID {
+			nextID = b.ID + 1
+		}
+		if err := library.AddBook(b); err != nil {
+			return err
+		}
+		existing[b.ID] = true
+		added++
+	}
+	fmt.Println(report)
+	fmt.Printf("%d book(s) added.\n", added)
+	return nil
+}
+
+func exportCatalog(library *services.Library, path, format string) error {
+	var write func(io.Writer, []models.Book) error
+	switch strings.ToLower(format) {
+	case "marc":
+		write = catalog.WriteMARC
+	case "marcxml":
+		write = catalog.WriteMARCXML
+	case "bibtex":
+		write = catalog.WriteBibTeX
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f, library.ListBooks()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeReport(library *services.Library, format, path string) error {
+	report := reports.Build(library.Snapshot(), 5)
+
+	var write func(io.Writer) error
+	switch strings.ToLower(format) {
+	case "", "table":
+		write = report.WriteTable
+	case "csv":
+		write = report.WriteCSV
+	case "html":
+		write = report.WriteHTML
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	if path == "" {
+		return write(os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Println("Report written to", path)
+	return nil
+}
+
+// RunLibrarySystem starts the interactive menu. When LIBRARY_DATA_DIR is set
+// the library is rebuilt from the event log there and every change is
+// appended to it; otherwise everything lives in memory.
 func RunLibrarySystem() {
 	r := bufio.NewReader(os.Stdin)
-	library := services.NewLibrary()
+	dataDir := os.Getenv("LIBRARY_DATA_DIR")
 
-	// Seed data
-	library.RegisterMember(models.Member{ID: 1, Name: "Alice"})
-	library.RegisterMember(models.Member{ID: 2, Name: "Bob"})
-	library.RegisterMember(models.Member{ID: 3, Name: "Charlie"})
-	library.RegisterMember(models.Member{ID: 4, Name: "Dana"})
-	library.RegisterMember(models.Member{ID: 5, Name: "Evan"})
+	var library *services.Library
+	if dataDir != "" {
+		var err error
+		library, err = services.OpenLibrary(dataDir)
+		if err != nil {
+			fmt.Println("Error opening event log:", err)
+			return
+		}
+		defer library.Close()
+	} else {
+		library = services.NewLibrary()
+	}
 
-	library.AddBook(models.Book{ID: 1, Title: "The Go Programming Language", Author: "Donovan & Kernighan", Status: "Available"})
-	library.AddBook(models.Book{ID: 2, Title: "Concurrency in Go", Author: "Katherine Cox-Buday", Status: "Available"})
+	if len(library.Snapshot().Members) == 0 {
+		if err := seed(library); err != nil {
+			fmt.Println("Error seeding library:", err)
+			return
+		}
+	}
 
 	for {
 		fmt.Println("\n=== Library Management System (Concurrent) ===")
@@ -66,7 +240,20 @@ func RunLibrarySystem() {
 		fmt.Println("6. List Borrowed Books (by Member)")
 		fmt.Println("7. Reserve Book")
 		fmt.Println("8. Simulate Concurrent Reservations")
-		fmt.Println("9. Exit")
+		fmt.Println("9. Recommend Books")
+		fmt.Println("10. Add Branch")
+		fmt.Println("11. Request Pickup at Branch")
+		fmt.Println("12. List Transfers")
+		fmt.Println("13. Dispatch Transfer")
+		fmt.Println("14. Receive Transfer")
+		fmt.Println("15. Cancel Transfer")
+		fmt.Println("16. List Books at Branch")
+		fmt.Println("17. Replay State at Time")
+		fmt.Println("18. Book History")
+		fmt.Println("19. Import Catalog (MARC / MARCXML / BibTeX)")
+		fmt.Println("20. Export Catalog (MARC / MARCXML / BibTeX)")
+		fmt.Println("21. Circulation Report")
+		fmt.Println("22. Exit")
 
 		choice := asInt(readLine(r, "Enter choice: "))
 
@@ -75,8 +262,12 @@ func RunLibrarySystem() {
 			id := asInt(readLine(r, "Book ID: "))
 			title := readLine(r, "Title: ")
 			author := readLine(r, "Author: ")
-			library.AddBook(models.Book{ID: id, Title: title, Author: author, Status: "Available"})
-			fmt.Println("Book added.")
+			branch := asInt(readLine(r, "Home Branch ID: "))
+			if err := library.AddBook(models.Book{ID: id, Title: title, Author: author, Status: "Available", HomeBranchID: branch}); err != nil {
+				fmt.Println("Error:", err)
+			} else {
+				fmt.Println("Book added.")
+			}
 		case 2:
 			id := asInt(readLine(r, "Book ID to remove: "))
 			if err := library.RemoveBook(id); err != nil {
@@ -126,6 +317,124 @@ func RunLibrarySystem() {
 		case 8:
 			simulateConcurrentReservations(library)
 		case 9:
+			mid := asInt(readLine(r, "Member ID: "))
+			n := asInt(readLine(r, "How many? "))
+			recs, err := library.Recommend(mid, n)
+			if err != nil {
+				fmt.Println("Error:", err)
+			} else if len(recs) == 0 {
+				fmt.Println("No recommendations yet — borrow a few books first.")
+			} else {
+				for _, rec := range recs {
+					fmt.Printf("ID: %d | %s — %s (%s, score %.2f)\n", rec.Book.ID, rec.Book.Title, rec.Book.Author, rec.Reason, rec.Score)
+				}
+			}
+		case 10:
+			id := asInt(readLine(r, "Branch ID: "))
+			name := readLine(r, "Name: ")
+			if err := library.AddBranch(models.Branch{ID: id, Name: name}); err != nil {
+				fmt.Println("Error:", err)
+			} else {
+				fmt.Println("Branch added.")
+			}
+		case 11:
+			bid := asInt(readLine(r, "Book ID: "))
+			mid := asInt(readLine(r, "Member ID: "))
+			branch := asInt(readLine(r, "Pickup Branch ID: "))
+			if err := library.RequestPickup(bid, mid, branch); err != nil {
+				fmt.Println("Error:", err)
+			} else {
+				fmt.Println("Pickup requested. The reservation clock starts once the book arrives.")
+			}
+		case 12:
+			transfers := library.ListTransfers()
+			if len(transfers) == 0 {
+				fmt.Println("No transfers.")
+			}
+			for _, t := range transfers {
+				fmt.Printf("Transfer %d | Book %d for Member %d | Branch %d -> %d | %s\n", t.ID, t.BookID, t.MemberID, t.FromBranchID, t.ToBranchID, t.Status)
+			}
+		case 13:
+			id := asInt(readLine(r, "Transfer ID: "))
+			if err := library.DispatchTransfer(id); err != nil {
+				fmt.Println("Error:", err)
+			} else {
+				fmt.Println("Transfer in transit.")
+			}
+		case 14:
+			id := asInt(readLine(r, "Transfer ID: "))
+			if err := library.ReceiveTransfer(id); err != nil {
+				fmt.Println("Error:", err)
+			} else {
+				fmt.Println("Transfer arrived; the member can borrow the book now.")
+			}
+		case 15:
+			id := asInt(readLine(r, "Transfer ID: "))
+			if err := library.CancelTransfer(id); err != nil {
+				fmt.Println("Error:", err)
+			} else {
+				fmt.Println("Transfer cancelled; the pickup reservation was dropped.")
+			}
+		case 16:
+			branch := asInt(readLine(r, "Branch ID: "))
+			for _, b := range library.ListBooksAtBranch(branch) {
+				fmt.Printf("ID: %d | %s — %s | %s\n", b.ID, b.Title, b.Author, b.Status)
+			}
+		case 17:
+			if dataDir == "" {
+				fmt.Println("Replay needs LIBRARY_DATA_DIR to be set.")
+				continue
+			}
+			at, err := time.Parse(time.RFC3339, readLine(r, "Point in time (RFC3339): "))
+			if err != nil {
+				fmt.Println("Error: use RFC3339, e.g. 2025-12-31T23:59:59Z")
+				continue
+			}
+			snap, err := services.StateAt(dataDir, at)
+			if err != nil {
+				fmt.Println("Error:", err)
+				continue
+			}
+			printState(snap)
+		case 18:
+			if dataDir == "" {
+				fmt.Println("Book history needs LIBRARY_DATA_DIR to be set.")
+				continue
+			}
+			bid := asInt(readLine(r, "Book ID: "))
+			events, err := services.BookHistory(dataDir, bid)
+			if err != nil {
+				fmt.Println("Error:", err)
+				continue
+			}
+			for _, e := range events {
+				fmt.Printf("#%d %s %s", e.Seq, e.At.Format(time.RFC3339), e.Type)
+				if e.MemberID != 0 {
+					fmt.Printf(" (Member %d)", e.MemberID)
+				}
+				fmt.Println()
+			}
+		case 19:
+			path := readLine(r, "File to import: ")
+			format := readLine(r, "Format (marc | marcxml | bibtex): ")
+			if err := importCatalog(library, path, format); err != nil {
+				fmt.Println("Error:", err)
+			}
+		case 20:
+			path := readLine(r, "File to write: ")
+			format := readLine(r, "Format (marc | marcxml | bibtex): ")
+			if err := exportCatalog(library, path, format); err != nil {
+				fmt.Println("Error:", err)
+			} else {
+				fmt.Println("Catalog exported.")
+			}
+		case 21:
+			format := readLine(r, "Format (table | csv | html): ")
+			path := readLine(r, "Output file (blank for screen): ")
+			if err := writeReport(library, format, path); err != nil {
+				fmt.Println("Error:", err)
+			}
+		case 22:
 			fmt.Println("Goodbye!")
 			return
 		default:
@@ -5,4 +5,14 @@ type Book struct {
 	Title  string
 	Author string
 	Status string 
+
+	// HomeBranchID owns the copy; LocationID is where it currently sits.
+	HomeBranchID int
+	LocationID   int
+
+	// Bibliographic details, filled in by catalog imports.
+	ISBN      string
+	Publisher string
+	Year      int
+	Subjects  []string
 }
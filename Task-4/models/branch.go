@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+type Branch struct {
+	ID   int
+	Name string
+}
+
+type TransferStatus string
+
+const (
+	TransferRequested TransferStatus = "Requested"
+	TransferInTransit TransferStatus = "InTransit"
+	TransferArrived   TransferStatus = "Arrived"
+	TransferCancelled TransferStatus = "Cancelled"
+)
+
+// Transfer moves a book from one branch to another so a member can pick it up
+// there.
+type Transfer struct {
+	ID           int
+	BookID       int
+	MemberID     int
+	FromBranchID int
+	ToBranchID   int
+	Status       TransferStatus
+	RequestedAt  time.Time
+	DispatchedAt time.Time
+	ArrivedAt    time.Time
+	CancelledAt  time.Time
+}
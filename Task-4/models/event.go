@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+type EventType string
+
+const (
+	EventBookAdded          EventType = "BookAdded"
+	EventBookRemoved        EventType = "BookRemoved"
+	EventMemberRegistered   EventType = "MemberRegistered"
+	EventBranchAdded        EventType = "BranchAdded"
+	EventBorrowed           EventType = "Borrowed"
+	EventReturned           EventType = "Returned"
+	EventReserved           EventType = "Reserved"
+	EventReservationExpired EventType = "ReservationExpired"
+	EventTransferRequested  EventType = "TransferRequested"
+	EventTransferDispatched EventType = "TransferDispatched"
+	EventTransferArrived    EventType = "TransferArrived"
+	EventTransferCancelled  EventType = "TransferCancelled"
+)
+
+// Event is one entry in the library's append-only log. Only the fields that
+// matter for its Type are set.
+type Event struct {
+	Seq  int64
+	Type EventType
+	At   time.Time
+
+	BookID     int     `json:",omitempty"`
+	MemberID   int     `json:",omitempty"`
+	BranchID   int     `json:",omitempty"`
+	TransferID int     `json:",omitempty"`
+	Book       *Book   `json:",omitempty"`
+	Member     *Member `json:",omitempty"`
+	Branch     *Branch `json:",omitempty"`
+
+	// ExpiresAt is when a Reserved or TransferArrived hold lapses.
+	ExpiresAt time.Time `json:",omitzero"`
+}
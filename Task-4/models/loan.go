@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Loan records one borrow of a book by a member. ReturnedAt stays zero while
+// the book is still out.
+type Loan struct {
+	BookID     int
+	MemberID   int
+	BorrowedAt time.Time
+	ReturnedAt time.Time
+}
+
+func (l Loan) Active() bool {
+	return l.ReturnedAt.IsZero()
+}
@@ -3,5 +3,6 @@ package models
 type Member struct {
 	ID            int
 	Name          string
+	Tier          string // e.g. "Standard", "Student", "Premium"
 	BorrowedBooks []Book
 }
@@ -0,0 +1,121 @@
+// Package reports summarises how the collection is used, from library state
+// and loan history.
+package reports
+
+import (
+	"sort"
+	"time"
+
+	"task4/models"
+	"task4/services"
+)
+
+type TitleCount struct {
+	BookID int
+	Title  string
+	Author string
+	Loans  int
+}
+
+type TierUsage struct {
+	Tier      string
+	Members   int
+	Loans     int
+	PerMember float64
+}
+
+// Circulation is a point-in-time report over the whole collection.
+type Circulation struct {
+	GeneratedAt time.Time
+
+	Books       int
+	Members     int
+	Loans       int
+	ActiveLoans int
+
+	MostBorrowed  []TitleCount
+	LeastBorrowed []TitleCount // among books borrowed at least once
+	NeverBorrowed []models.Book
+
+	ByTier []TierUsage
+
+	// AverageLoan covers returned loans only; books still out have no length yet.
+	AverageLoan   time.Duration
+	ReturnedLoans int
+
+	Reservations services.ReservationStats
+	WinRate      float64 // share of granted reservations that ended in a borrow
+	ExpiryRate   float64 // share of granted reservations that lapsed
+}
+
+// Build computes the report from a library snapshot, keeping the top n
+// entries in the most/least borrowed lists.
+func Build(snap services.Snapshot, n int) Circulation {
+	r := Circulation{
+		GeneratedAt:  snap.At,
+		Books:        len(snap.Books),
+		Members:      len(snap.Members),
+		Loans:        len(snap.Loans),
+		Reservations: snap.Reservation,
+	}
+
+	perBook := make(map[int]int)
+	tierOf := make(map[int]string)
+	tiers := make(map[string]*TierUsage)
+	for _, m := range snap.Members {
+		tier := m.Tier
+		if tier == "" {
+			tier = "Standard"
+		}
+		tierOf[m.ID] = tier
+		if tiers[tier] == nil {
+			tiers[tier] = &TierUsage{Tier: tier}
+		}
+		tiers[tier].Members++
+	}
+
+	var total time.Duration
+	for _, loan := range snap.Loans {
+		perBook[loan.BookID]++
+		if t, ok := tiers[tierOf[loan.MemberID]]; ok {
+			t.Loans++
+		}
+		if loan.Active() {
+			r.ActiveLoans++
+			continue
+		}
+		total += loan.ReturnedAt.Sub(loan.BorrowedAt)
+		r.ReturnedLoans++
+	}
+	if r.ReturnedLoans > 0 {
+		r.AverageLoan = total / time.Duration(r.ReturnedLoans)
+	}
+
+	var borrowed []TitleCount
+	for _, b := range snap.Books {
+		if perBook[b.ID] == 0 {
+			r.NeverBorrowed = append(r.NeverBorrowed, b)
+			continue
+		}
+		borrowed = append(borrowed, TitleCount{BookID: b.ID, Title: b.Title, Author: b.Author, Loans: perBook[b.ID]})
+	}
+
+	sort.SliceStable(borrowed, func(i, j int) bool { return borrowed[i].Loans > borrowed[j].Loans })
+	r.MostBorrowed = append(r.MostBorrowed, borrowed[:min(n, len(borrowed))]...)
+	sort.SliceStable(borrowed, func(i, j int) bool { return borrowed[i].Loans < borrowed[j].Loans })
+	r.LeastBorrowed = append(r.LeastBorrowed, borrowed[:min(n, len(borrowed))]...)
+
+	for _, t := range tiers {
+		if t.Members > 0 {
+			t.PerMember = float64(t.Loans) / float64(t.Members)
+		}
+		r.ByTier = append(r.ByTier, *t)
+	}
+	sort.Slice(r.ByTier, func(i, j int) bool { return r.ByTier[i].Tier < r.ByTier[j].Tier })
+
+	if g := r.Reservations.Granted; g > 0 {
+		r.WinRate = float64(r.Reservations.Fulfilled) / float64(g)
+		r.ExpiryRate = float64(r.Reservations.Expired) / float64(g)
+	}
+	return r
+}
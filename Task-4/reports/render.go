@@ -0,0 +1,154 @@
+package reports
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// WriteTable prints the report as aligned plain-text tables for the terminal.
+func (r Circulation) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Circulation report — %s\n\n", r.GeneratedAt.Format(time.RFC3339))
+	fmt.Fprintf(tw, "Books\t%d\n", r.Books)
+	fmt.Fprintf(tw, "Members\t%d\n", r.Members)
+	fmt.Fprintf(tw, "Loans (all time)\t%d\n", r.Loans)
+	fmt.Fprintf(tw, "Loans out now\t%d\n", r.ActiveLoans)
+	fmt.Fprintf(tw, "Average loan length\t%s (%d returned)\n", r.AverageLoan.Round(time.Second), r.ReturnedLoans)
+
+	titles := func(heading string, rows []TitleCount) {
+		fmt.Fprintf(tw, "\n%s\nID\tTitle\tAuthor\tLoans\n", heading)
+		for _, t := range rows {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%d\n", t.BookID, t.Title, t.Author, t.Loans)
+		}
+	}
+	titles("Most borrowed", r.MostBorrowed)
+	titles("Least borrowed", r.LeastBorrowed)
+
+	fmt.Fprintf(tw, "\nBorrowing by member tier\nTier\tMembers\tLoans\tLoans/member\n")
+	for _, t := range r.ByTier {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.2f\n", t.Tier, t.Members, t.Loans, t.PerMember)
+	}
+
+	fmt.Fprintf(tw, "\nReservations\nGranted\tBorrowed\tExpired\tWin rate\tExpiry rate\n")
+	fmt.Fprintf(tw, "%d\t%d\t%d\t%.0f%%\t%.0f%%\n",
+		r.Reservations.Granted, r.Reservations.Fulfilled, r.Reservations.Expired, r.WinRate*100, r.ExpiryRate*100)
+
+	fmt.Fprintf(tw, "\nNever borrowed\nID\tTitle\tAuthor\n")
+	for _, b := range r.NeverBorrowed {
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", b.ID, b.Title, b.Author)
+	}
+	return tw.Flush()
+}
+
+// WriteCSV flattens the report into section,item,metric,value rows so it can
+// be loaded into a spreadsheet as a single sheet.
+func (r Circulation) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	rows := [][]string{
+		{"section", "item", "metric", "value"},
+		{"summary", "", "books", strconv.Itoa(r.Books)},
+		{"summary", "", "members", strconv.Itoa(r.Members)},
+		{"summary", "", "loans", strconv.Itoa(r.Loans)},
+		{"summary", "", "active_loans", strconv.Itoa(r.ActiveLoans)},
+		{"summary", "", "average_loan_seconds", strconv.FormatFloat(r.AverageLoan.Seconds(), 'f', 0, 64)},
+	}
+	for _, t := range r.MostBorrowed {
+		rows = append(rows, []string{"most_borrowed", t.Title, "loans", strconv.Itoa(t.Loans)})
+	}
+	for _, t := range r.LeastBorrowed {
+		rows = append(rows, []string{"least_borrowed", t.Title, "loans", strconv.Itoa(t.Loans)})
+	}
+	for _, t := range r.ByTier {
+		rows = append(rows,
+			[]string{"tier", t.Tier, "members", strconv.Itoa(t.Members)},
+			[]string{"tier", t.Tier, "loans", strconv.Itoa(t.Loans)},
+			[]string{"tier", t.Tier, "loans_per_member", strconv.FormatFloat(t.PerMember, 'f', 2, 64)},
+		)
+	}
+	rows = append(rows,
+		[]string{"reservations", "", "granted", strconv.Itoa(r.Reservations.Granted)},
+		[]string{"reservations", "", "borrowed", strconv.Itoa(r.Reservations.Fulfilled)},
+		[]string{"reservations", "", "expired", strconv.Itoa(r.Reservations.Expired)},
+		[]string{"reservations", "", "win_rate", strconv.FormatFloat(r.WinRate, 'f', 4, 64)},
+		[]string{"reservations", "", "expiry_rate", strconv.FormatFloat(r.ExpiryRate, 'f', 4, 64)},
+	)
+	for _, b := range r.NeverBorrowed {
+		rows = append(rows, []string{"never_borrowed", b.Title, "book_id", strconv.Itoa(b.ID)})
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"pct":  func(f float64) string { return fmt.Sprintf("%.0f%%", f*100) },
+	"dur":  func(d time.Duration) string { return d.Round(time.Second).String() },
+	"when": func(t time.Time) string { return t.Format(time.RFC3339) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Circulation report</title>
+<style>
+body { font-family: sans-serif; margin: 2rem; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5rem; }
+th, td { border: 1px solid #ccc; padding: .3rem .7rem; text-align: left; }
+th { background: #f3f3f3; }
+</style>
+</head>
+<body>
+<h1>Circulation report</h1>
+<p>Generated {{when .GeneratedAt}}</p>
+
+<table>
+<tr><th>Books</th><td>{{.Books}}</td></tr>
+<tr><th>Members</th><td>{{.Members}}</td></tr>
+<tr><th>Loans (all time)</th><td>{{.Loans}}</td></tr>
+<tr><th>Loans out now</th><td>{{.ActiveLoans}}</td></tr>
+<tr><th>Average loan length</th><td>{{dur .AverageLoan}} ({{.ReturnedLoans}} returned)</td></tr>
+</table>
+
+<h2>Most borrowed</h2>
+<table>
+<tr><th>ID</th><th>Title</th><th>Author</th><th>Loans</th></tr>
+{{range .MostBorrowed}}<tr><td>{{.BookID}}</td><td>{{.Title}}</td><td>{{.Author}}</td><td>{{.Loans}}</td></tr>
+{{end}}</table>
+
+<h2>Least borrowed</h2>
+<table>
+<tr><th>ID</th><th>Title</th><th>Author</th><th>Loans</th></tr>
+{{range .LeastBorrowed}}<tr><td>{{.BookID}}</td><td>{{.Title}}</td><td>{{.Author}}</td><td>{{.Loans}}</td></tr>
+{{end}}</table>
+
+<h2>Borrowing by member tier</h2>
+<table>
+<tr><th>Tier</th><th>Members</th><th>Loans</th><th>Loans/member</th></tr>
+{{range .ByTier}}<tr><td>{{.Tier}}</td><td>{{.Members}}</td><td>{{.Loans}}</td><td>{{printf "%.2f" .PerMember}}</td></tr>
+{{end}}</table>
+
+<h2>Reservations</h2>
+<table>
+<tr><th>Granted</th><th>Borrowed</th><th>Expired</th><th>Win rate</th><th>Expiry rate</th></tr>
+<tr><td>{{.Reservations.Granted}}</td><td>{{.Reservations.Fulfilled}}</td><td>{{.Reservations.Expired}}</td><td>{{pct .WinRate}}</td><td>{{pct .ExpiryRate}}</td></tr>
+</table>
+
+<h2>Never borrowed</h2>
+<table>
+<tr><th>ID</th><th>Title</th><th>Author</th></tr>
+{{range .NeverBorrowed}}<tr><td>{{.ID}}</td><td>{{.Title}}</td><td>{{.Author}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// WriteHTML renders the report as a self-contained static HTML page.
+func (r Circulation) WriteHTML(w io.Writer) error {
+	return htmlReport.Execute(w, r)
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"task4/models"
+)
+
+func (l *Library) AddBranch(b models.Branch) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.record(models.Event{Type: models.EventBranchAdded, BranchID: b.ID, Branch: &b})
+}
+
+// RequestPickup reserves a book for collection at the given branch. If the
+// book is elsewhere a transfer is opened and the reservation is held until
+// the book arrives, or until the transfer is cancelled; the usual reservation
+// TTL starts counting from arrival.
+func (l *Library) RequestPickup(bookID int, memberID int, branchID int) error {
+	if branchID == 0 {
+		return errors.New("branch not found")
+	}
+	resp := make(chan error, 1)
+	l.reservationCh <- ReservationRequest{BookID: bookID, MemberID: memberID, BranchID: branchID, RespCh: resp}
+	return <-resp
+}
+
+func (l *Library) DispatchTransfer(transferID int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	t, ok := l.transfers[transferID]
+	if !ok {
+		return errors.New("transfer not found")
+	}
+	if t.Status != models.TransferRequested {
+		return errors.New("transfer already dispatched")
+	}
+	return l.record(models.Event{Type: models.EventTransferDispatched, TransferID: transferID, BookID: t.BookID})
+}
+
+// ReceiveTransfer marks a transfer as arrived, moves the book to its new
+// location and starts the pickup reservation's expiry timer.
+func (l *Library) ReceiveTransfer(transferID int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	t, ok := l.transfers[transferID]
+	if !ok {
+		return errors.New("transfer not found")
+	}
+	if t.Status != models.TransferInTransit {
+		return errors.New("transfer is not in transit")
+	}
+	err := l.record(models.Event{
+		Type:       models.EventTransferArrived,
+		TransferID: transferID,
+		BookID:     t.BookID,
+		ExpiresAt:  time.Now().Add(l.reservationTTL),
+	})
+	if err != nil {
+		return err
+	}
+	l.armExpiry(t.BookID)
+	return nil
+}
+
+// CancelTransfer calls off a transfer that hasn't arrived and drops the
+// pickup reservation waiting on it, so the book is free again. The book
+// stays listed at the branch it was sent from.
+func (l *Library) CancelTransfer(transferID int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	t, ok := l.transfers[transferID]
+	if !ok {
+		return errors.New("transfer not found")
+	}
+	if t.Status != models.TransferRequested && t.Status != models.TransferInTransit {
+		return errors.New("transfer already " + strings.ToLower(string(t.Status)))
+	}
+	return l.record(models.Event{Type: models.EventTransferCancelled, TransferID: transferID, BookID: t.BookID})
+}
+
+func (l *Library) ListTransfers() []models.Transfer {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	out := make([]models.Transfer, 0, len(l.transfers))
+	for _, t := range l.transfers {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+func (l *Library) ListBooksAtBranch(branchID int) []models.Book {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var books []models.Book
+	for _, b := range l.Books {
+		if b.LocationID == branchID {
+			books = append(books, b)
+		}
+	}
+	sort.Slice(books, func(i, j int) bool { return books[i].ID < books[j].ID })
+	return books
+}
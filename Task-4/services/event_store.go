@@ -0,0 +1,169 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"task4/models"
+)
+
+// EventStore keeps the library's append-only event log as JSON lines in
+// dir/events.log, next to periodic snapshots in dir/snapshots.
+type EventStore struct {
+	mu  sync.Mutex
+	dir string
+	f   *os.File
+}
+
+func OpenEventStore(dir string) (*EventStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "snapshots"), 0o755); err != nil {
+		return nil, err
+	}
+	return &EventStore{dir: dir}, nil
+}
+
+func (s *EventStore) logPath() string {
+	return filepath.Join(s.dir, "events.log")
+}
+
+// Append writes one event and syncs it to disk before returning.
+func (s *EventStore) Append(e models.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		f, err := os.OpenFile(s.logPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		s.f = f
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := s.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+// Events reads the whole log. A final line cut short by a crash is ignored;
+// corruption anywhere else is an error.
+func (s *EventStore) Events() ([]models.Event, error) {
+	f, err := os.Open(s.logPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []models.Event
+	var bad error
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		if bad != nil {
+			return nil, bad
+		}
+		var e models.Event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			bad = fmt.Errorf("event log line %d: %w", n, err)
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, sc.Err()
+}
+
+// Repair drops a torn final record left by a crash mid-append so new events
+// start on a clean line.
+func (s *EventStore) Repair() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.logPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	good := len(data)
+	if good > 0 && data[good-1] != '\n' {
+		start := bytes.LastIndexByte(data, '\n') + 1
+		if json.Valid(data[start:]) {
+			data = append(data, '\n')
+			return os.WriteFile(s.logPath(), data, 0o644)
+		}
+		good = start
+	}
+	if good == len(data) {
+		return nil
+	}
+	return os.Truncate(s.logPath(), int64(good))
+}
+
+// SaveSnapshot writes a snapshot atomically, named after its sequence number.
+func (s *EventStore) SaveSnapshot(snap Snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, "snapshots", fmt.Sprintf("snapshot-%012d.json", snap.Seq))
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LatestSnapshot returns the newest snapshot taken at or before the given
+// time, or the newest overall when before is zero.
+func (s *EventStore) LatestSnapshot(before time.Time) (Snapshot, bool, error) {
+	names, err := filepath.Glob(filepath.Join(s.dir, "snapshots", "snapshot-*.json"))
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	for _, name := range names {
+		if strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return Snapshot{}, false, err
+		}
+		var snap Snapshot
+		if err := json.Unmarshal(data, &snap); err != nil {
+			continue
+		}
+		if before.IsZero() || !snap.At.After(before) {
+			return snap, true, nil
+		}
+	}
+	return Snapshot{}, false, nil
+}
+
+func (s *EventStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
@@ -0,0 +1,313 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"task4/models"
+)
+
+// record stamps an event, appends it to the log and applies it to the
+// in-memory state. Every change to the library goes through here so the log
+// alone is enough to rebuild it. Callers hold l.mu.
+func (l *Library) record(e models.Event) error {
+	e.Seq = l.seq + 1
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	if l.store != nil {
+		if err := l.store.Append(e); err != nil {
+			return err
+		}
+	}
+	l.apply(e)
+
+	if l.store != nil && l.snapshotEvery > 0 && e.Seq%l.snapshotEvery == 0 {
+		// A failed snapshot only slows the next startup down; the log is intact.
+		_ = l.store.SaveSnapshot(l.snapshot())
+	}
+	return nil
+}
+
+// apply folds a single event into the state. It must stay deterministic:
+// replaying the same events always yields the same library.
+func (l *Library) apply(e models.Event) {
+	l.seq = e.Seq
+
+	switch e.Type {
+	case models.EventBookAdded:
+		l.Books[e.BookID] = *e.Book
+
+	case models.EventBookRemoved:
+		delete(l.Books, e.BookID)
+
+	case models.EventMemberRegistered:
+		l.Members[e.MemberID] = *e.Member
+
+	case models.EventBranchAdded:
+		l.Branches[e.BranchID] = *e.Branch
+
+	case models.EventBorrowed:
+		book := l.Books[e.BookID]
+		book.Status = "Borrowed"
+		l.Books[e.BookID] = book
+		member := l.Members[e.MemberID]
+		member.BorrowedBooks = append(member.BorrowedBooks, book)
+		l.Members[e.MemberID] = member
+		l.loans = append(l.loans, models.Loan{BookID: e.BookID, MemberID: e.MemberID, BorrowedAt: e.At})
+
+		if res, reserved := l.reservations[e.BookID]; reserved && res.MemberID == e.MemberID {
+			l.dropReservation(e.BookID)
+			l.resStats.Fulfilled++
+		}
+
+	case models.EventReturned:
+		member := l.Members[e.MemberID]
+		for i, b := range member.BorrowedBooks {
+			if b.ID == e.BookID {
+				member.BorrowedBooks = append(member.BorrowedBooks[:i:i], member.BorrowedBooks[i+1:]...)
+				break
+			}
+		}
+		l.Members[e.MemberID] = member
+		book := l.Books[e.BookID]
+		book.Status = "Available"
+		l.Books[e.BookID] = book
+		for i := len(l.loans) - 1; i >= 0; i-- {
+			if l.loans[i].BookID == e.BookID && l.loans[i].MemberID == e.MemberID && l.loans[i].Active() {
+				l.loans[i].ReturnedAt = e.At
+				break
+			}
+		}
+
+	case models.EventReserved:
+		l.reservations[e.BookID] = &reservation{
+			MemberID:   e.MemberID,
+			transferID: e.TransferID,
+			expiresAt:  e.ExpiresAt,
+		}
+		l.resStats.Granted++
+
+	case models.EventReservationExpired:
+		l.dropReservation(e.BookID)
+		l.resStats.Expired++
+
+	case models.EventTransferRequested:
+		l.transfers[e.TransferID] = &models.Transfer{
+			ID:           e.TransferID,
+			BookID:       e.BookID,
+			MemberID:     e.MemberID,
+			FromBranchID: l.Books[e.BookID].LocationID,
+			ToBranchID:   e.BranchID,
+			Status:       models.TransferRequested,
+			RequestedAt:  e.At,
+		}
+		if e.TransferID > l.transferSeq {
+			l.transferSeq = e.TransferID
+		}
+
+	case models.EventTransferDispatched:
+		if t, ok := l.transfers[e.TransferID]; ok {
+			t.Status = models.TransferInTransit
+			t.DispatchedAt = e.At
+		}
+
+	case models.EventTransferArrived:
+		t, ok := l.transfers[e.TransferID]
+		if !ok {
+			return
+		}
+		t.Status = models.TransferArrived
+		t.ArrivedAt = e.At
+		if book, ok := l.Books[t.BookID]; ok {
+			book.LocationID = t.ToBranchID
+			l.Books[t.BookID] = book
+		}
+		if res, ok := l.reservations[t.BookID]; ok && res.transferID == e.TransferID {
+			res.transferID = 0
+			res.expiresAt = e.ExpiresAt
+		}
+
+	case models.EventTransferCancelled:
+		t, ok := l.transfers[e.TransferID]
+		if !ok {
+			return
+		}
+		t.Status = models.TransferCancelled
+		t.CancelledAt = e.At
+		if res, ok := l.reservations[t.BookID]; ok && res.transferID == e.TransferID {
+			l.dropReservation(t.BookID)
+			l.resStats.Cancelled++
+		}
+	}
+}
+
+func (l *Library) dropReservation(bookID int) {
+	if res, ok := l.reservations[bookID]; ok {
+		if res.timer != nil {
+			res.timer.Stop()
+		}
+		delete(l.reservations, bookID)
+	}
+}
+
+// replay rebuilds state from the newest snapshot taken at or before until and
+// the events logged after it. A zero until replays everything.
+func (l *Library) replay(store *EventStore, until time.Time) error {
+	snap, ok, err := store.LatestSnapshot(until)
+	if err != nil {
+		return err
+	}
+	if ok {
+		l.restore(snap)
+	}
+
+	events, err := store.Events()
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		if e.Seq <= l.seq {
+			continue
+		}
+		if !until.IsZero() && e.At.After(until) {
+			break
+		}
+		l.apply(e)
+	}
+	return nil
+}
+
+// ReservationStats counts how granted reservations ended: the member came
+// and borrowed the book (Fulfilled), the hold lapsed (Expired) or the
+// transfer bringing the book to the pickup branch was cancelled (Cancelled).
+type ReservationStats struct {
+	Granted   int
+	Fulfilled int
+	Expired   int
+	Cancelled int
+}
+
+// Snapshot is the full library state as of event Seq.
+type Snapshot struct {
+	Seq          int64
+	At           time.Time
+	Books        []models.Book
+	Members      []models.Member
+	Branches     []models.Branch
+	Loans        []models.Loan
+	Reservations []ReservationState
+	Transfers    []models.Transfer
+	Reservation  ReservationStats
+}
+
+type ReservationState struct {
+	BookID     int
+	MemberID   int
+	TransferID int       `json:",omitempty"`
+	ExpiresAt  time.Time `json:",omitzero"`
+}
+
+func (l *Library) snapshot() Snapshot {
+	snap := Snapshot{Seq: l.seq, At: time.Now(), Reservation: l.resStats}
+	for _, b := range l.Books {
+		snap.Books = append(snap.Books, b)
+	}
+	for _, m := range l.Members {
+		m.BorrowedBooks = append([]models.Book(nil), m.BorrowedBooks...)
+		snap.Members = append(snap.Members, m)
+	}
+	for _, b := range l.Branches {
+		snap.Branches = append(snap.Branches, b)
+	}
+	snap.Loans = append(snap.Loans, l.loans...)
+	for bookID, res := range l.reservations {
+		snap.Reservations = append(snap.Reservations, ReservationState{
+			BookID:     bookID,
+			MemberID:   res.MemberID,
+			TransferID: res.transferID,
+			ExpiresAt:  res.expiresAt,
+		})
+	}
+	for _, t := range l.transfers {
+		snap.Transfers = append(snap.Transfers, *t)
+	}
+
+	sort.Slice(snap.Books, func(i, j int) bool { return snap.Books[i].ID < snap.Books[j].ID })
+	sort.Slice(snap.Members, func(i, j int) bool { return snap.Members[i].ID < snap.Members[j].ID })
+	sort.Slice(snap.Branches, func(i, j int) bool { return snap.Branches[i].ID < snap.Branches[j].ID })
+	sort.Slice(snap.Reservations, func(i, j int) bool { return snap.Reservations[i].BookID < snap.Reservations[j].BookID })
+	sort.Slice(snap.Transfers, func(i, j int) bool { return snap.Transfers[i].ID < snap.Transfers[j].ID })
+	return snap
+}
+
+func (l *Library) restore(snap Snapshot) {
+	l.seq = snap.Seq
+	l.resStats = snap.Reservation
+	for _, b := range snap.Books {
+		l.Books[b.ID] = b
+	}
+	for _, m := range snap.Members {
+		l.Members[m.ID] = m
+	}
+	for _, b := range snap.Branches {
+		l.Branches[b.ID] = b
+	}
+	l.loans = append(l.loans, snap.Loans...)
+	for _, r := range snap.Reservations {
+		l.reservations[r.BookID] = &reservation{MemberID: r.MemberID, transferID: r.TransferID, expiresAt: r.ExpiresAt}
+	}
+	for _, t := range snap.Transfers {
+		t := t
+		l.transfers[t.ID] = &t
+		if t.ID > l.transferSeq {
+			l.transferSeq = t.ID
+		}
+	}
+}
+
+// Snapshot returns the current state of the library.
+func (l *Library) Snapshot() Snapshot {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.snapshot()
+}
+
+// StateAt replays the event log in dir up to the given moment and returns the
+// library as it stood then. Nothing is written and no timers are started.
+func StateAt(dir string, at time.Time) (Snapshot, error) {
+	store, err := OpenEventStore(dir)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer store.Close()
+
+	l := newLibrary()
+	if err := l.replay(store, at); err != nil {
+		return Snapshot{}, err
+	}
+	snap := l.snapshot()
+	snap.At = at
+	return snap, nil
+}
+
+// BookHistory lists every logged event that touched a book, oldest first.
+func BookHistory(dir string, bookID int) ([]models.Event, error) {
+	store, err := OpenEventStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	events, err := store.Events()
+	if err != nil {
+		return nil, err
+	}
+	var out []models.Event
+	for _, e := range events {
+		if e.BookID == bookID {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
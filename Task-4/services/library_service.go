@@ -2,6 +2,7 @@ package services
 
 import (
 	"errors"
+	"sort"
 	"sync"
 	"time"
 
@@ -10,24 +11,37 @@ import (
 
 
 type LibraryManager interface {
-	AddBook(book models.Book)
+	AddBook(book models.Book) error
 	RemoveBook(bookID int) error
 	BorrowBook(bookID int, memberID int) error
 	ReturnBook(bookID int, memberID int) error
 	ListAvailableBooks() []models.Book
 	ListBorrowedBooks(memberID int) []models.Book
 	ReserveBook(bookID int, memberID int) error
-	RegisterMember(m models.Member)
+	RegisterMember(m models.Member) error
+	Recommend(memberID int, n int) ([]Recommendation, error)
+	AddBranch(b models.Branch) error
+	RequestPickup(bookID int, memberID int, branchID int) error
+	DispatchTransfer(transferID int) error
+	ReceiveTransfer(transferID int) error
+	CancelTransfer(transferID int) error
+	ListTransfers() []models.Transfer
 }
 
 type reservation struct {
 	MemberID int
 	timer    *time.Timer
+	// transferID is set while the book is on its way to the pickup branch;
+	// the expiry timer only starts once it arrives.
+	transferID int
+	expiresAt  time.Time
 }
 
 type ReservationRequest struct {
 	BookID   int
 	MemberID int
+	// BranchID is the pickup branch; zero means wherever the book is now.
+	BranchID int
 	RespCh   chan error
 }
 
@@ -35,35 +49,98 @@ type Library struct {
 	mu             sync.Mutex
 	Books          map[int]models.Book
 	Members        map[int]models.Member
+	Branches       map[int]models.Branch
 	reservations   map[int]*reservation          
+	loans          []models.Loan
+	transfers      map[int]*models.Transfer
+	transferSeq    int
 	reservationCh  chan ReservationRequest        
 	cancelAllCh    chan struct{}                  
 	reservationTTL time.Duration                  
+
+	seq           int64
+	resStats      ReservationStats
+	store         *EventStore
+	snapshotEvery int64
 }
 
-func NewLibrary() *Library {
-	l := &Library{
+func newLibrary() *Library {
+	return &Library{
 		Books:          make(map[int]models.Book),
 		Members:        make(map[int]models.Member),
+		Branches:       make(map[int]models.Branch),
 		reservations:   make(map[int]*reservation),
+		transfers:      make(map[int]*models.Transfer),
 		reservationCh:  make(chan ReservationRequest, 128),
 		cancelAllCh:    make(chan struct{}),
 		reservationTTL: 5 * time.Second,
+		snapshotEvery:  100,
 	}
+}
+
+// NewLibrary returns a library whose state lives only in memory.
+func NewLibrary() *Library {
+	l := newLibrary()
 	go l.startReservationWorker() 
 	return l
 }
 
-func (l *Library) RegisterMember(m models.Member) {
+// OpenLibrary rebuilds a library from the event log in dir, starting from the
+// latest snapshot, and keeps appending to that log from then on.
+func OpenLibrary(dir string) (*Library, error) {
+	store, err := OpenEventStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Repair(); err != nil {
+		return nil, err
+	}
+	l := newLibrary()
+	if err := l.replay(store, time.Time{}); err != nil {
+		store.Close()
+		return nil, err
+	}
+	l.store = store
+
+	l.mu.Lock()
+	for bookID := range l.reservations {
+		l.armExpiry(bookID)
+	}
+	l.mu.Unlock()
+
+	go l.startReservationWorker()
+	return l, nil
+}
+
+// Close stops the reservation worker and releases the event log.
+func (l *Library) Close() error {
+	close(l.cancelAllCh)
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	l.Members[m.ID] = m
+	for _, res := range l.reservations {
+		if res.timer != nil {
+			res.timer.Stop()
+		}
+	}
+	if l.store != nil {
+		return l.store.Close()
+	}
+	return nil
 }
 
-func (l *Library) AddBook(book models.Book) {
+func (l *Library) RegisterMember(m models.Member) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	l.Books[book.ID] = book
+	return l.record(models.Event{Type: models.EventMemberRegistered, MemberID: m.ID, Member: &m})
+}
+
+func (l *Library) AddBook(book models.Book) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if book.LocationID == 0 {
+		book.LocationID = book.HomeBranchID
+	}
+	return l.record(models.Event{Type: models.EventBookAdded, BookID: book.ID, Book: &book})
 }
 
 func (l *Library) RemoveBook(bookID int) error {
@@ -81,8 +158,7 @@ func (l *Library) RemoveBook(bookID int) error {
 		return errors.New("cannot remove: book is reserved")
 	}
 
-	delete(l.Books, bookID)
-	return nil
+	return l.record(models.Event{Type: models.EventBookRemoved, BookID: bookID})
 }
 
 func (l *Library) BorrowBook(bookID int, memberID int) error {
@@ -93,8 +169,7 @@ func (l *Library) BorrowBook(bookID int, memberID int) error {
 	if !ok {
 		return errors.New("book not found")
 	}
-	member, ok := l.Members[memberID]
-	if !ok {
+	if _, ok := l.Members[memberID]; !ok {
 		return errors.New("member not found")
 	}
 
@@ -102,26 +177,15 @@ func (l *Library) BorrowBook(bookID int, memberID int) error {
 	if res, reserved := l.reservations[bookID]; reserved && res.MemberID != memberID {
 		return errors.New("book is reserved by another member")
 	}
+	if res, reserved := l.reservations[bookID]; reserved && res.transferID != 0 {
+		return errors.New("book has not arrived at the pickup branch yet")
+	}
 
 	if book.Status == "Borrowed" {
 		return errors.New("book already borrowed")
 	}
 
-
-	book.Status = "Borrowed"
-	l.Books[bookID] = book
-	member.BorrowedBooks = append(member.BorrowedBooks, book)
-	l.Members[memberID] = member
-
-
-	if res, reserved := l.reservations[bookID]; reserved && res.MemberID == memberID {
-		if res.timer != nil {
-			res.timer.Stop()
-		}
-		delete(l.reservations, bookID)
-	}
-
-	return nil
+	return l.record(models.Event{Type: models.EventBorrowed, BookID: bookID, MemberID: memberID})
 }
 
 func (l *Library) ReturnBook(bookID int, memberID int) error {
@@ -133,15 +197,13 @@ func (l *Library) ReturnBook(bookID int, memberID int) error {
 		return errors.New("member not found")
 	}
 
-	book, ok := l.Books[bookID]
-	if !ok {
+	if _, ok := l.Books[bookID]; !ok {
 		return errors.New("book not found")
 	}
 
 	found := false
-	for i, b := range member.BorrowedBooks {
+	for _, b := range member.BorrowedBooks {
 		if b.ID == bookID {
-			member.BorrowedBooks = append(member.BorrowedBooks[:i], member.BorrowedBooks[i+1:]...)
 			found = true
 			break
 		}
@@ -150,10 +212,14 @@ func (l *Library) ReturnBook(bookID int, memberID int) error {
 		return errors.New("book not borrowed by this member")
 	}
 
-	book.Status = "Available"
-	l.Books[bookID] = book
-	l.Members[memberID] = member
-	return nil
+	return l.record(models.Event{Type: models.EventReturned, BookID: bookID, MemberID: memberID})
+}
+
+// LoanHistory returns every recorded loan, oldest first.
+func (l *Library) LoanHistory() []models.Loan {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]models.Loan(nil), l.loans...)
 }
 
 func (l *Library) ListAvailableBooks() []models.Book {
@@ -171,6 +237,19 @@ func (l *Library) ListAvailableBooks() []models.Book {
 	return available
 }
 
+// ListBooks returns every book in the catalog ordered by ID.
+func (l *Library) ListBooks() []models.Book {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	books := make([]models.Book, 0, len(l.Books))
+	for _, b := range l.Books {
+		books = append(books, b)
+	}
+	sort.Slice(books, func(i, j int) bool { return books[i].ID < books[j].ID })
+	return books
+}
+
 func (l *Library) ListBorrowedBooks(memberID int) []models.Book {
 	l.mu.Lock()
 	defer l.mu.Unlock()
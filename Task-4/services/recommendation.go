@@ -0,0 +1,126 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"task4/models"
+)
+
+type Recommendation struct {
+	Book   models.Book
+	Score  float64
+	Reason string
+}
+
+// Recommend suggests up to n books for a member from the recorded loan history.
+// Candidates are scored by item-to-item co-borrowing similarity with the books
+// the member has already read; when that yields too few results the remaining
+// slots are filled by authors the member has borrowed before. Only books that
+// can be borrowed right now are returned, and books the member has ever
+// borrowed are skipped.
+func (l *Library) Recommend(memberID int, n int) ([]Recommendation, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.Members[memberID]; !ok {
+		return nil, errors.New("member not found")
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+
+	borrowers := make(map[int]map[int]bool)
+	for _, loan := range l.loans {
+		if borrowers[loan.BookID] == nil {
+			borrowers[loan.BookID] = make(map[int]bool)
+		}
+		borrowers[loan.BookID][loan.MemberID] = true
+	}
+
+	read := make(map[int]bool)
+	for bookID, members := range borrowers {
+		if members[memberID] {
+			read[bookID] = true
+		}
+	}
+	for _, b := range l.Members[memberID].BorrowedBooks {
+		read[b.ID] = true
+	}
+
+	authors := make(map[string]int)
+	for bookID := range read {
+		if b, ok := l.Books[bookID]; ok {
+			authors[b.Author]++
+		}
+	}
+
+	var coBorrowed, byAuthor []Recommendation
+	for id, book := range l.Books {
+		if read[id] || book.Status != "Available" {
+			continue
+		}
+		if _, reserved := l.reservations[id]; reserved {
+			continue
+		}
+
+		best, bestID, score := 0.0, 0, 0.0
+		for readID := range read {
+			if _, ok := l.Books[readID]; !ok {
+				continue // removed since, so there is nothing to name
+			}
+			sim := similarity(borrowers[id], borrowers[readID])
+			score += sim
+			if sim > best || (sim == best && sim > 0 && readID < bestID) {
+				best, bestID = sim, readID
+			}
+		}
+		if score > 0 {
+			coBorrowed = append(coBorrowed, Recommendation{
+				Book:   book,
+				Score:  score,
+				Reason: "borrowed together with " + l.Books[bestID].Title,
+			})
+			continue
+		}
+		if count := authors[book.Author]; count > 0 {
+			byAuthor = append(byAuthor, Recommendation{
+				Book:   book,
+				Score:  float64(count) / float64(len(read)),
+				Reason: "more by " + book.Author,
+			})
+		}
+	}
+
+	sortRecommendations(coBorrowed)
+	sortRecommendations(byAuthor)
+	out := append(coBorrowed, byAuthor...)
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out, nil
+}
+
+// similarity is the cosine similarity between two books' sets of borrowers.
+func similarity(a, b map[int]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	common := 0
+	for m := range a {
+		if b[m] {
+			common++
+		}
+	}
+	return float64(common) / math.Sqrt(float64(len(a)*len(b)))
+}
+
+func sortRecommendations(recs []Recommendation) {
+	sort.Slice(recs, func(i, j int) bool {
+		if recs[i].Score != recs[j].Score {
+			return recs[i].Score > recs[j].Score
+		}
+		return recs[i].Book.ID < recs[j].Book.ID
+	})
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"testing"
+
+	"task4/models"
+)
+
+func TestRecommendSkipsRemovedBooks(t *testing.T) {
+	l := NewLibrary()
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, m := range []models.Member{{ID: 1, Name: "Ann"}, {ID: 2, Name: "Bo"}} {
+		must(l.RegisterMember(m))
+	}
+	for _, b := range []models.Book{
+		{ID: 1, Title: "Dune", Author: "Herbert", Status: "Available"},
+		{ID: 2, Title: "The Left Hand of Darkness", Author: "Le Guin", Status: "Available"},
+		{ID: 3, Title: "The Dispossessed", Author: "Le Guin", Status: "Available"},
+	} {
+		must(l.AddBook(b))
+	}
+	// Book 3 is co-borrowed only with book 1, which is then removed.
+	for _, loan := range [][2]int{{1, 1}, {2, 1}, {1, 2}, {3, 2}} {
+		must(l.BorrowBook(loan[0], loan[1]))
+		must(l.ReturnBook(loan[0], loan[1]))
+	}
+	must(l.RemoveBook(1))
+
+	recs, err := l.Recommend(1, 5)
+	must(err)
+	if len(recs) != 1 || recs[0].Book.ID != 3 || recs[0].Reason != "more by Le Guin" {
+		t.Fatalf("got %+v, want book 3 for its author", recs)
+	}
+}
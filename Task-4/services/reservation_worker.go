@@ -2,7 +2,10 @@ package services
 
 import (
 	"errors"
+	"log"
 	"time"
+
+	"task4/models"
 )
 
 
@@ -34,26 +37,71 @@ func (l *Library) startReservationWorker() {
 				continue
 			}
 
-			timer := time.AfterFunc(l.reservationTTL, func() {
-				l.mu.Lock()
-				defer l.mu.Unlock()
-				if r, ok := l.reservations[req.BookID]; ok && r.MemberID == req.MemberID {
-					if b, ok2 := l.Books[req.BookID]; ok2 && b.Status != "Borrowed" {
-						delete(l.reservations, req.BookID)
-					}
+			if req.BranchID != 0 && req.BranchID != book.LocationID {
+				if _, ok := l.Branches[req.BranchID]; !ok {
+					l.mu.Unlock()
+					req.RespCh <- errors.New("branch not found")
+					continue
 				}
-			})
+				transferID := l.transferSeq + 1
+				err := l.record(models.Event{
+					Type:       models.EventTransferRequested,
+					TransferID: transferID,
+					BookID:     req.BookID,
+					MemberID:   req.MemberID,
+					BranchID:   req.BranchID,
+				})
+				if err == nil {
+					err = l.record(models.Event{
+						Type:       models.EventReserved,
+						BookID:     req.BookID,
+						MemberID:   req.MemberID,
+						TransferID: transferID,
+					})
+				}
+				l.mu.Unlock()
+				req.RespCh <- err
+				continue
+			}
 
-			l.reservations[req.BookID] = &reservation{
-				MemberID: req.MemberID,
-				timer:    timer,
+			err := l.record(models.Event{
+				Type:      models.EventReserved,
+				BookID:    req.BookID,
+				MemberID:  req.MemberID,
+				ExpiresAt: time.Now().Add(l.reservationTTL),
+			})
+			if err == nil {
+				l.armExpiry(req.BookID)
 			}
 			l.mu.Unlock()
 
-			req.RespCh <- nil
+			req.RespCh <- err
 
 		case <-l.cancelAllCh:
 			return
 		}
 	}
 }
+
+// armExpiry starts the timer that drops a reservation once its hold lapses
+// without a borrow. Callers hold l.mu.
+func (l *Library) armExpiry(bookID int) {
+	res, ok := l.reservations[bookID]
+	if !ok || res.expiresAt.IsZero() {
+		return
+	}
+	if res.timer != nil {
+		res.timer.Stop()
+	}
+	res.timer = time.AfterFunc(time.Until(res.expiresAt), func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if r, ok := l.reservations[bookID]; ok && r == res {
+			if b, ok2 := l.Books[bookID]; ok2 && b.Status != "Borrowed" {
+				if err := l.record(models.Event{Type: models.EventReservationExpired, BookID: bookID, MemberID: res.MemberID}); err != nil {
+					log.Printf("reservation expiry for book %d: %v", bookID, err)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"task_manager/data"
+	"task_manager/models"
+)
+
+// Batch applies a list of creates, updates and deletes in order. A
+// malformed operation rejects the whole batch before anything runs.
+func (c *TaskController) Batch(ctx *gin.Context) {
+	var req models.BatchRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorMsg("invalid request body"))
+		return
+	}
+	atomic := true
+	switch req.Mode {
+	case "", models.BatchAtomic:
+	case models.BatchBestEffort:
+		atomic = false
+	default:
+		ctx.JSON(http.StatusBadRequest, errorMsg("invalid mode (use: atomic | best_effort)"))
+		return
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > models.MaxBatchSize {
+		ctx.JSON(http.StatusBadRequest, errorMsg(fmt.Sprintf("a batch takes 1 to %d operations", models.MaxBatchSize)))
+		return
+	}
+	ops := make([]data.BatchOp, len(req.Operations))
+	for i, o := range req.Operations {
+		op, err := batchOp(o)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, batchError(i, err.Error()))
+			return
+		}
+		ops[i] = op
+	}
+
+	results, err := c.Service.Batch(ctx.Request.Context(), ops, atomic)
+	var failed *data.BatchError
+	if errors.As(err, &failed) {
+		code, msg := batchStatus(ops[failed.Index].Op, failed.Err)
+		logCause(ctx, code, failed.Err)
+		ctx.JSON(code, batchError(failed.Index, msg))
+		return
+	}
+	if err != nil {
+		fail(ctx, http.StatusInternalServerError, "internal error", err)
+		return
+	}
+	out := make([]models.BatchResult, len(results))
+	for i, r := range results {
+		out[i] = models.BatchResult{Index: i}
+		if r.Err != nil {
+			out[i].Status, out[i].Error = batchStatus(ops[i].Op, r.Err)
+			logCause(ctx, out[i].Status, r.Err)
+			continue
+		}
+		switch ops[i].Op {
+		case models.BatchCreate:
+			out[i].Status, out[i].Data = http.StatusCreated, &r.Task
+		case models.BatchUpdate:
+			out[i].Status, out[i].Data = http.StatusOK, &r.Task
+		default:
+			out[i].Status = http.StatusNoContent
+		}
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": out})
+}
+
+// batchOp checks one operation of a batch request and decodes its task.
+func batchOp(o models.BatchOperation) (data.BatchOp, error) {
+	op := data.BatchOp{Op: o.Op, ID: strconv.FormatInt(o.ID, 10), Version: data.AnyVersion, Cascade: o.Cascade}
+	if o.Version != nil {
+		op.Version = *o.Version
+	}
+	switch o.Op {
+	case models.BatchCreate:
+		if len(o.Task) == 0 || json.Unmarshal(o.Task, &op.Create) != nil {
+			return op, errors.New("invalid task")
+		}
+		if binding.Validator.ValidateStruct(&op.Create) != nil {
+			return op, errors.New("task needs a title, due_date and status")
+		}
+	case models.BatchUpdate:
+		if o.ID == 0 {
+			return op, errors.New("id is required")
+		}
+		if len(o.Task) == 0 || json.Unmarshal(o.Task, &op.Update) != nil {
+			return op, errors.New("invalid task")
+		}
+	case models.BatchDelete:
+		if o.ID == 0 {
+			return op, errors.New("id is required")
+		}
+	default:
+		return op, fmt.Errorf("invalid op %q (use: create | update | delete)", o.Op)
+	}
+	return op, nil
+}
+
+// batchStatus maps the error of one operation like its single-task
+// endpoint would.
+func batchStatus(op string, err error) (int, string) {
+	switch op {
+	case models.BatchCreate:
+		return createStatus(err)
+	case models.BatchUpdate:
+		return updateStatus(err)
+	default:
+		return deleteStatus(err)
+	}
+}
+
+// batchError names the operation that failed, by its index in the request.
+func batchError(index int, msg string) gin.H {
+	return gin.H{"error": fmt.Sprintf("operations[%d]: %s", index, msg), "index": index}
+}
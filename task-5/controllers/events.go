@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"task_manager/data"
+	"task_manager/models"
+)
+
+// eventPing is how often an idle stream sends a comment, so proxies don't
+// close it.
+const eventPing = 20 * time.Second
+
+// Events streams task changes as Server-Sent Events, optionally narrowed by
+// status=a,b and assignee=name. An update is sent when the task matched
+// before or matches after it, so a client sees a task leave its filter and
+// can drop it. A Last-Event-ID header resumes after that event; if it is too
+// old to replay, a reset event tells the client to reload its tasks first.
+func (c *TaskController) Events(ctx *gin.Context) {
+	var statuses []models.TaskStatus
+	if v := ctx.Query("status"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			status := models.TaskStatus(strings.TrimSpace(s))
+			if !models.IsValidStatus(status) {
+				ctx.JSON(http.StatusBadRequest, errorMsg(invalidStatusMsg()))
+				return
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	assignee := strings.TrimSpace(ctx.Query("assignee"))
+	matchTask := func(t models.Task) bool {
+		return (len(statuses) == 0 || slices.Contains(statuses, t.Status)) &&
+			(assignee == "" || t.Assignee == assignee)
+	}
+	match := func(ev data.TaskEvent) bool {
+		return matchTask(ev.Task) || ev.Before != nil && matchTask(*ev.Before)
+	}
+
+	sub := c.Service.Events().Subscribe(ctx.GetHeader("Last-Event-ID"))
+	defer sub.Close()
+
+	h := ctx.Writer.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+	fmt.Fprint(ctx.Writer, "retry: 3000\n\n")
+	if sub.Missed {
+		fmt.Fprint(ctx.Writer, "event: reset\ndata: {}\n\n")
+	}
+	for _, ev := range sub.Replay {
+		if match(ev) {
+			writeEvent(ctx.Writer, ev)
+		}
+	}
+	ctx.Writer.Flush()
+
+	ping := time.NewTicker(eventPing)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case ev, ok := <-sub.C:
+			if !ok {
+				return // fell behind; the client resumes from the replay buffer
+			}
+			if !match(ev) {
+				continue
+			}
+			writeEvent(ctx.Writer, ev)
+		case <-ping.C:
+			fmt.Fprint(ctx.Writer, ": ping\n\n")
+		}
+		ctx.Writer.Flush()
+	}
+}
+
+func writeEvent(w io.Writer, ev data.TaskEvent) {
+	payload, _ := json.Marshal(ev.Task)
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, payload)
+}
@@ -1,48 +1,74 @@
 package controllers
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"task_manager/data"
 	"task_manager/models"
+	"task_manager/patch"
 )
 
 type TaskController struct {
-	Service *data.InMemoryTaskService
+	Service data.TaskRepository
 }
 
-func NewTaskController(s *data.InMemoryTaskService) *TaskController {
+func NewTaskController(s data.TaskRepository) *TaskController {
 	return &TaskController{Service: s}
 }
 
 func (c *TaskController) Register(r *gin.RouterGroup) {
 	r.GET("/tasks", c.List)
+	r.GET("/tasks/events", c.Events)
+	r.GET("/tasks.ics", c.Calendar)
+	r.GET("/tasks/export", c.Export)
 	r.GET("/tasks/:id", c.Get)
+	r.GET("/tasks/:id/children", c.Children)
+	r.GET("/tasks/:id/tree", c.Tree)
+	r.GET("/tasks/:id/dependencies", c.Dependencies)
 	r.POST("/tasks", c.Create)
 	r.PUT("/tasks/:id", c.Update)
+	r.PATCH("/tasks/:id", c.Patch)
 	r.DELETE("/tasks/:id", c.Delete)
+	r.POST("/tasks/batch", c.Batch)
+	r.POST("/tasks/import", c.Import)
+	r.POST("/tasks/:id/blockers", c.AddBlocker)
+	r.DELETE("/tasks/:id/blockers/:blocker", c.RemoveBlocker)
 }
 
 func (c *TaskController) List(ctx *gin.Context) {
-	tasks := c.Service.List()
-	ctx.JSON(http.StatusOK, gin.H{"data": tasks})
-}
-
-func (c *TaskController) Get(ctx *gin.Context) {
-	id, err := parseID(ctx.Param("id"))
+	q, err := parseTaskQuery(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorMsg(err.Error()))
+		return
+	}
+	page, err := c.Service.List(ctx.Request.Context(), q)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, errorMsg("invalid id"))
+		code, msg := listStatus(err)
+		fail(ctx, code, msg, err)
 		return
 	}
-	task, err := c.Service.Get(id)
+	ctx.JSON(http.StatusOK, page)
+}
+
+func (c *TaskController) Get(ctx *gin.Context) {
+	id := ctx.Param("id")
+	task, err := c.Service.Get(ctx.Request.Context(), id)
 	if err != nil {
 		if err == data.ErrNotFound {
 			ctx.JSON(http.StatusNotFound, errorMsg("task not found"))
 			return
 		}
-		ctx.JSON(http.StatusInternalServerError, errorMsg("internal error"))
+		fail(ctx, http.StatusInternalServerError, "internal error", err)
+		return
+	}
+	tag := etag(task.Version)
+	ctx.Header("ETag", tag)
+	if notModified(ctx, tag) {
+		ctx.Status(http.StatusNotModified)
 		return
 	}
 	ctx.JSON(http.StatusOK, gin.H{"data": task})
@@ -54,70 +80,294 @@ func (c *TaskController) Create(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, errorMsg("invalid request body"))
 		return
 	}
-	task, err := c.Service.Create(dto)
+	task, err := c.Service.Create(ctx.Request.Context(), dto)
 	if err != nil {
-		switch err {
-		case data.ErrInvalidStatus:
-			ctx.JSON(http.StatusBadRequest, errorMsg("invalid status (use: pending | in_progress | done)"))
-			return
-		case data.ErrInvalidDate:
-			ctx.JSON(http.StatusBadRequest, errorMsg("invalid due_date (use RFC3339, e.g. 2025-12-31T23:59:59Z)"))
-			return
-		default:
-			ctx.JSON(http.StatusInternalServerError, errorMsg("internal error"))
-			return
-		}
+		code, msg := createStatus(err)
+		fail(ctx, code, msg, err)
+		return
 	}
+	ctx.Header("ETag", etag(task.Version))
 	ctx.JSON(http.StatusCreated, gin.H{"data": task})
 }
 
 func (c *TaskController) Update(ctx *gin.Context) {
-	id, err := parseID(ctx.Param("id"))
+	id := ctx.Param("id")
+	var dto models.UpdateTaskDTO
+	if err := ctx.ShouldBindJSON(&dto); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorMsg("invalid request body"))
+		return
+	}
+	version, ok := c.expectedVersion(ctx, id)
+	if !ok {
+		ctx.JSON(http.StatusPreconditionFailed, errorMsg(data.ErrVersionMismatch.Error()))
+		return
+	}
+	task, err := c.Service.Update(ctx.Request.Context(), id, dto, version)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, errorMsg("invalid id"))
+		code, msg := updateStatus(err)
+		fail(ctx, code, msg, err)
 		return
 	}
-	var dto models.UpdateTaskDTO
-	if err := ctx.ShouldBindJSON(&dto); err != nil {
+	ctx.Header("ETag", etag(task.Version))
+	ctx.JSON(http.StatusOK, gin.H{"data": task})
+}
+
+// Patch accepts either a JSON Merge Patch or a JSON Patch, chosen by
+// Content-Type.
+func (c *TaskController) Patch(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var apply func(doc, p []byte) ([]byte, error)
+	switch ctx.ContentType() {
+	case "application/merge-patch+json":
+		apply = patch.Merge
+	case "application/json-patch+json":
+		apply = patch.Apply
+	default:
+		ctx.JSON(http.StatusUnsupportedMediaType, errorMsg("use application/merge-patch+json or application/json-patch+json"))
+		return
+	}
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
 		ctx.JSON(http.StatusBadRequest, errorMsg("invalid request body"))
 		return
 	}
-	task, err := c.Service.Update(id, dto)
+	version, ok := c.expectedVersion(ctx, id)
+	if !ok {
+		ctx.JSON(http.StatusPreconditionFailed, errorMsg(data.ErrVersionMismatch.Error()))
+		return
+	}
+
+	task, err := data.PatchTask(ctx.Request.Context(), c.Service, id, version, func(doc []byte) ([]byte, error) {
+		return apply(doc, body)
+	})
+	if err != nil {
+		code, msg := patchStatus(err)
+		fail(ctx, code, msg, err)
+		return
+	}
+	ctx.Header("ETag", etag(task.Version))
+	ctx.JSON(http.StatusOK, gin.H{"data": task})
+}
+
+func (c *TaskController) Delete(ctx *gin.Context) {
+	id := ctx.Param("id")
+	version, ok := c.expectedVersion(ctx, id)
+	if !ok {
+		ctx.JSON(http.StatusPreconditionFailed, errorMsg(data.ErrVersionMismatch.Error()))
+		return
+	}
+	cascade := ctx.Query("cascade") == "true"
+	if err := c.Service.Delete(ctx.Request.Context(), id, version, cascade); err != nil {
+		code, msg := deleteStatus(err)
+		fail(ctx, code, msg, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// Children lists the direct subtasks of a task.
+func (c *TaskController) Children(ctx *gin.Context) {
+	children, err := c.Service.Children(ctx.Request.Context(), ctx.Param("id"))
 	if err != nil {
 		switch err {
 		case data.ErrNotFound:
 			ctx.JSON(http.StatusNotFound, errorMsg("task not found"))
-		case data.ErrInvalidStatus:
-			ctx.JSON(http.StatusBadRequest, errorMsg("invalid status (use: pending | in_progress | done)"))
-		case data.ErrInvalidDate:
-			ctx.JSON(http.StatusBadRequest, errorMsg("invalid due_date (use RFC3339, e.g. 2025-12-31T23:59:59Z)"))
 		default:
-			ctx.JSON(http.StatusInternalServerError, errorMsg("internal error"))
+			fail(ctx, http.StatusInternalServerError, "internal error", err)
 		}
 		return
 	}
-	ctx.JSON(http.StatusOK, gin.H{"data": task})
+	ctx.JSON(http.StatusOK, gin.H{"data": children})
 }
 
-func (c *TaskController) Delete(ctx *gin.Context) {
-	id, err := parseID(ctx.Param("id"))
+// Tree returns a task with its whole subtree nested under it.
+func (c *TaskController) Tree(ctx *gin.Context) {
+	tree, err := c.Service.Tree(ctx.Request.Context(), ctx.Param("id"))
+	if err != nil {
+		switch err {
+		case data.ErrNotFound:
+			ctx.JSON(http.StatusNotFound, errorMsg("task not found"))
+		default:
+			fail(ctx, http.StatusInternalServerError, "internal error", err)
+		}
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": tree})
+}
+
+// AddBlocker marks the task as blocked by the task named in the body.
+func (c *TaskController) AddBlocker(ctx *gin.Context) {
+	var body struct {
+		TaskID int64 `json:"task_id" binding:"required"`
+	}
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorMsg("invalid request body"))
+		return
+	}
+	c.editBlockers(ctx, func(id string, version int64) (models.Task, error) {
+		return data.AddBlocker(ctx.Request.Context(), c.Service, id, body.TaskID, version)
+	})
+}
+
+// RemoveBlocker drops one blocked-by edge from the task.
+func (c *TaskController) RemoveBlocker(ctx *gin.Context) {
+	blocker, err := strconv.ParseInt(ctx.Param("blocker"), 10, 64)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, errorMsg("invalid id"))
+		ctx.JSON(http.StatusBadRequest, errorMsg(data.ErrInvalidBlocker.Error()))
 		return
 	}
-	if err := c.Service.Delete(id); err != nil {
-		if err == data.ErrNotFound {
+	c.editBlockers(ctx, func(id string, version int64) (models.Task, error) {
+		return data.RemoveBlocker(ctx.Request.Context(), c.Service, id, blocker, version)
+	})
+}
+
+func (c *TaskController) editBlockers(ctx *gin.Context, edit func(id string, version int64) (models.Task, error)) {
+	id := ctx.Param("id")
+	version, ok := c.expectedVersion(ctx, id)
+	if !ok {
+		ctx.JSON(http.StatusPreconditionFailed, errorMsg(data.ErrVersionMismatch.Error()))
+		return
+	}
+	task, err := edit(id, version)
+	if err != nil {
+		switch err {
+		case data.ErrNotFound:
 			ctx.JSON(http.StatusNotFound, errorMsg("task not found"))
-			return
+		case data.ErrVersionMismatch:
+			ctx.JSON(http.StatusPreconditionFailed, errorMsg(err.Error()))
+		case data.ErrInvalidBlocker, data.ErrDependencyCycle:
+			ctx.JSON(http.StatusBadRequest, errorMsg(err.Error()))
+		default:
+			fail(ctx, http.StatusInternalServerError, "internal error", err)
 		}
-		ctx.JSON(http.StatusInternalServerError, errorMsg("internal error"))
 		return
 	}
-	ctx.Status(http.StatusNoContent)
+	ctx.Header("ETag", etag(task.Version))
+	ctx.JSON(http.StatusOK, gin.H{"data": task})
+}
+
+// Dependencies lists the task after everything it transitively waits on,
+// each task after its own blockers.
+func (c *TaskController) Dependencies(ctx *gin.Context) {
+	tasks, err := data.DependencyOrder(ctx.Request.Context(), c.Service, ctx.Param("id"))
+	if err != nil {
+		switch err {
+		case data.ErrNotFound:
+			ctx.JSON(http.StatusNotFound, errorMsg("task not found"))
+		default:
+			fail(ctx, http.StatusInternalServerError, "internal error", err)
+		}
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": tasks})
+}
+
+// listStatus maps a List error to its response status and message.
+func listStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, data.ErrInvalidQuery):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, data.ErrInvalidStatus):
+		return http.StatusBadRequest, invalidStatusMsg()
+	case errors.Is(err, data.ErrInvalidPriority):
+		return http.StatusBadRequest, "invalid priority (use: low | medium | high | urgent)"
+	default:
+		return http.StatusInternalServerError, "internal error"
+	}
+}
+
+// createStatus maps a Create error to its response status and message.
+func createStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, data.ErrInvalidStatus):
+		return http.StatusBadRequest, invalidStatusMsg()
+	case errors.Is(err, data.ErrInvalidDate):
+		return http.StatusBadRequest, "invalid due_date (use RFC3339, e.g. 2025-12-31T23:59:59Z)"
+	case errors.Is(err, data.ErrInvalidPriority):
+		return http.StatusBadRequest, "invalid priority (use: low | medium | high | urgent)"
+	case errors.Is(err, data.ErrInvalidParent), errors.Is(err, data.ErrInvalidBlocker),
+		errors.Is(err, data.ErrInvalidLabels), errors.Is(err, data.ErrInvalidAssignee),
+		errors.Is(err, data.ErrInvalidRecurrence), errors.Is(err, data.ErrInvalidTimeZone),
+		errors.Is(err, data.ErrInvalidTransition):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, data.ErrBlocked):
+		return http.StatusConflict, err.Error()
+	default:
+		return http.StatusInternalServerError, "internal error"
+	}
 }
 
-func parseID(s string) (int64, error) {
-	return strconv.ParseInt(s, 10, 64)
+// updateStatus maps an Update error to its response status and message.
+func updateStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, data.ErrNotFound):
+		return http.StatusNotFound, "task not found"
+	case errors.Is(err, data.ErrVersionMismatch):
+		return http.StatusPreconditionFailed, err.Error()
+	case errors.Is(err, data.ErrInvalidStatus):
+		return http.StatusBadRequest, invalidStatusMsg()
+	case errors.Is(err, data.ErrInvalidDate):
+		return http.StatusBadRequest, "invalid due_date (use RFC3339, e.g. 2025-12-31T23:59:59Z)"
+	case errors.Is(err, data.ErrInvalidPriority):
+		return http.StatusBadRequest, "invalid priority (use: low | medium | high | urgent)"
+	case errors.Is(err, data.ErrInvalidParent), errors.Is(err, data.ErrParentCycle),
+		errors.Is(err, data.ErrInvalidBlocker), errors.Is(err, data.ErrDependencyCycle),
+		errors.Is(err, data.ErrInvalidLabels), errors.Is(err, data.ErrInvalidAssignee),
+		errors.Is(err, data.ErrInvalidRecurrence), errors.Is(err, data.ErrInvalidTimeZone):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, data.ErrOpenSubtasks), errors.Is(err, data.ErrBlocked),
+		errors.Is(err, data.ErrInvalidTransition):
+		return http.StatusConflict, err.Error()
+	default:
+		return http.StatusInternalServerError, "internal error"
+	}
+}
+
+// patchStatus maps a PatchTask error to its response status and message.
+// Errors from the patch itself are handled here, the rest like Update's.
+func patchStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, patch.ErrTestFailed):
+		return http.StatusConflict, err.Error()
+	case errors.Is(err, patch.ErrInvalid), errors.Is(err, data.ErrInvalidPatch):
+		return http.StatusBadRequest, err.Error()
+	default:
+		return updateStatus(err)
+	}
+}
+
+// deleteStatus maps a Delete error to its response status and message.
+func deleteStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, data.ErrNotFound):
+		return http.StatusNotFound, "task not found"
+	case errors.Is(err, data.ErrHasSubtasks):
+		return http.StatusConflict, err.Error()
+	case errors.Is(err, data.ErrVersionMismatch):
+		return http.StatusPreconditionFailed, err.Error()
+	default:
+		return http.StatusInternalServerError, "internal error"
+	}
 }
 
 func errorMsg(m string) gin.H { return gin.H{"error": m} }
+
+// fail answers with an error message. A 5xx hides its cause from the
+// client, so the cause goes to the access log instead.
+func fail(ctx *gin.Context, code int, msg string, err error) {
+	logCause(ctx, code, err)
+	ctx.JSON(code, errorMsg(msg))
+}
+
+// logCause attaches err to the request for the access log when code is a
+// 5xx.
+func logCause(ctx *gin.Context, code int, err error) {
+	if code >= http.StatusInternalServerError && err != nil {
+		_ = ctx.Error(err)
+	}
+}
+
+// invalidStatusMsg lists the statuses of the configured workflow.
+func invalidStatusMsg() string {
+	return "invalid status (use: " + data.StatusList(models.CurrentWorkflow().Names()) + ")"
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"task_manager/data"
+	"task_manager/models"
+)
+
+// parseTaskQuery reads GET /tasks query parameters:
+//
+//	status=pending,done         one or more statuses
+//	title=report                case-insensitive substring of the title
+//	priority=high,urgent        one or more priorities
+//	label=bug,backend           tasks carrying all of these labels
+//	assignee=alice              tasks assigned to this user
+//	due_from, due_to            RFC3339 bounds, inclusive (also created_*, updated_*)
+//	sort=-due_date              any task field, "-" for descending
+//	limit, offset               page size and start
+//	cursor                      next_cursor from the previous page
+func parseTaskQuery(ctx *gin.Context) (models.TaskQuery, error) {
+	q := models.TaskQuery{
+		Title:    ctx.Query("title"),
+		Assignee: ctx.Query("assignee"),
+		Cursor:   ctx.Query("cursor"),
+	}
+
+	if v := ctx.Query("status"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			q.Statuses = append(q.Statuses, models.TaskStatus(strings.TrimSpace(s)))
+		}
+	}
+	if v := ctx.Query("priority"); v != "" {
+		for _, p := range strings.Split(v, ",") {
+			q.Priorities = append(q.Priorities, models.TaskPriority(strings.TrimSpace(p)))
+		}
+	}
+	if v := ctx.Query("label"); v != "" {
+		q.Labels = strings.Split(v, ",")
+	}
+
+	bounds := []struct {
+		param string
+		dst   **time.Time
+	}{
+		{"due_from", &q.DueFrom}, {"due_to", &q.DueTo},
+		{"created_from", &q.CreatedFrom}, {"created_to", &q.CreatedTo},
+		{"updated_from", &q.UpdatedFrom}, {"updated_to", &q.UpdatedTo},
+	}
+	for _, b := range bounds {
+		v := ctx.Query(b.param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return q, fmt.Errorf("%w: %s must be RFC3339", data.ErrInvalidQuery, b.param)
+		}
+		*b.dst = &t
+	}
+
+	if v := ctx.Query("sort"); v != "" {
+		q.SortDesc = strings.HasPrefix(v, "-")
+		q.SortBy = strings.TrimPrefix(v, "-")
+	}
+
+	for _, p := range []struct {
+		param string
+		dst   *int
+	}{{"limit", &q.Limit}, {"offset", &q.Offset}} {
+		v := ctx.Query(p.param)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return q, fmt.Errorf("%w: %s must be an integer", data.ErrInvalidQuery, p.param)
+		}
+		*p.dst = n
+	}
+	return q, nil
+}
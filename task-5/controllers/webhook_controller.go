@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"task_manager/data"
+	"task_manager/models"
+)
+
+type WebhookController struct {
+	Service data.WebhookRepository
+}
+
+func NewWebhookController(s data.WebhookRepository) *WebhookController {
+	return &WebhookController{Service: s}
+}
+
+func (c *WebhookController) Register(r *gin.RouterGroup) {
+	r.GET("/webhooks", c.List)
+	r.GET("/webhooks/:id", c.Get)
+	r.POST("/webhooks", c.Create)
+	r.PUT("/webhooks/:id", c.Update)
+	r.DELETE("/webhooks/:id", c.Delete)
+	r.GET("/webhooks/:id/deliveries", c.Deliveries)
+	r.POST("/webhooks/:id/deliveries/:delivery/redeliver", c.Redeliver)
+}
+
+func (c *WebhookController) List(ctx *gin.Context) {
+	hooks, err := c.Service.ListWebhooks(ctx.Request.Context())
+	if err != nil {
+		fail(ctx, http.StatusInternalServerError, "internal error", err)
+		return
+	}
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": hooks})
+}
+
+func (c *WebhookController) Get(ctx *gin.Context) {
+	hook, err := c.Service.GetWebhook(ctx.Request.Context(), ctx.Param("id"))
+	if err != nil {
+		code, msg := webhookStatus(err)
+		fail(ctx, code, msg, err)
+		return
+	}
+	hook.Secret = ""
+	ctx.JSON(http.StatusOK, gin.H{"data": hook})
+}
+
+// Create answers with the webhook's secret, which is not shown again.
+func (c *WebhookController) Create(ctx *gin.Context) {
+	var dto models.WebhookDTO
+	if err := ctx.ShouldBindJSON(&dto); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorMsg("invalid request body"))
+		return
+	}
+	hook, err := c.Service.CreateWebhook(ctx.Request.Context(), dto)
+	if err != nil {
+		code, msg := webhookStatus(err)
+		fail(ctx, code, msg, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, gin.H{"data": hook})
+}
+
+func (c *WebhookController) Update(ctx *gin.Context) {
+	var dto models.WebhookDTO
+	if err := ctx.ShouldBindJSON(&dto); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorMsg("invalid request body"))
+		return
+	}
+	hook, err := c.Service.UpdateWebhook(ctx.Request.Context(), ctx.Param("id"), dto)
+	if err != nil {
+		code, msg := webhookStatus(err)
+		fail(ctx, code, msg, err)
+		return
+	}
+	hook.Secret = ""
+	ctx.JSON(http.StatusOK, gin.H{"data": hook})
+}
+
+func (c *WebhookController) Delete(ctx *gin.Context) {
+	if err := c.Service.DeleteWebhook(ctx.Request.Context(), ctx.Param("id")); err != nil {
+		code, msg := webhookStatus(err)
+		fail(ctx, code, msg, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// Deliveries lists a webhook's delivery log, newest first. status=failed
+// gives the dead letters.
+func (c *WebhookController) Deliveries(ctx *gin.Context) {
+	status := models.DeliveryStatus(ctx.Query("status"))
+	if status != "" && !models.IsValidDeliveryStatus(status) {
+		ctx.JSON(http.StatusBadRequest, errorMsg("invalid status (use: pending | succeeded | failed)"))
+		return
+	}
+	deliveries, err := c.Service.Deliveries(ctx.Request.Context(), ctx.Param("id"), status)
+	if err != nil {
+		code, msg := webhookStatus(err)
+		fail(ctx, code, msg, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": deliveries})
+}
+
+// Redeliver queues a delivery again with a fresh set of attempts.
+func (c *WebhookController) Redeliver(ctx *gin.Context) {
+	delivery, err := c.Service.Redeliver(ctx.Request.Context(), ctx.Param("id"), ctx.Param("delivery"))
+	if err != nil {
+		code, msg := webhookStatus(err)
+		fail(ctx, code, msg, err)
+		return
+	}
+	ctx.JSON(http.StatusAccepted, gin.H{"data": delivery})
+}
+
+func webhookStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, data.ErrWebhookNotFound), errors.Is(err, data.ErrDeliveryNotFound):
+		return http.StatusNotFound, err.Error()
+	case errors.Is(err, data.ErrInvalidWebhookURL), errors.Is(err, data.ErrInvalidWebhookEvent):
+		return http.StatusBadRequest, err.Error()
+	default:
+		return http.StatusInternalServerError, "internal error"
+	}
+}
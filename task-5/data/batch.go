@@ -0,0 +1,50 @@
+package data
+
+import (
+	"fmt"
+
+	"task_manager/models"
+)
+
+// BatchOp is one checked operation of a batch. Op is one of the
+// models.Batch* kinds; Create or Update holds its payload.
+type BatchOp struct {
+	Op      string
+	ID      string
+	Version int64
+	Cascade bool
+	Create  models.CreateTaskDTO
+	Update  models.UpdateTaskDTO
+}
+
+// BatchResult is the outcome of one operation. Task is zero for deletes
+// and failures.
+type BatchResult struct {
+	Task models.Task
+	Err  error
+}
+
+// BatchError is the operation that stopped an atomic batch.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string { return fmt.Sprintf("operations[%d]: %v", e.Index, e.Err) }
+
+func (e *BatchError) Unwrap() error { return e.Err }
+
+// runBatch applies ops in order. An atomic run stops at the first failure
+// and returns it as a *BatchError; undoing what came before is up to the
+// caller.
+func runBatch(ops []BatchOp, atomic bool, apply func(BatchOp) (models.Task, error)) ([]BatchResult, error) {
+	results := make([]BatchResult, len(ops))
+	for i, op := range ops {
+		t, err := apply(op)
+		if err != nil && atomic {
+			return nil, &BatchError{Index: i, Err: err}
+		}
+		results[i] = BatchResult{Task: t, Err: err}
+	}
+	return results, nil
+}
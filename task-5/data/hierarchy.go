@@ -0,0 +1,45 @@
+package data
+
+import (
+	"errors"
+
+	"task_manager/models"
+)
+
+var (
+	ErrInvalidParent = errors.New("parent task not found")
+	ErrParentCycle   = errors.New("a task cannot be nested under itself or one of its subtasks")
+	ErrOpenSubtasks  = errors.New("task has subtasks that are not done")
+	ErrHasSubtasks   = errors.New("task has subtasks; delete them first or cascade")
+)
+
+// buildTree nests descendants under root by parent ID. Children keep the
+// order they arrive in.
+func buildTree(root models.Task, descendants []models.Task) models.TaskNode {
+	byParent := make(map[int64][]models.Task)
+	for _, t := range descendants {
+		byParent[t.ParentID] = append(byParent[t.ParentID], t)
+	}
+	var build func(t models.Task) models.TaskNode
+	build = func(t models.Task) models.TaskNode {
+		node := models.TaskNode{Task: t, Children: []models.TaskNode{}}
+		for _, c := range byParent[t.ID] {
+			node.Children = append(node.Children, build(c))
+		}
+		node.RollupStatus = rollup(node)
+		return node
+	}
+	return build(root)
+}
+
+// rollup is the shared status when the task and all its subtasks agree, and
+// the workflow's reopen status (in progress by default) otherwise.
+func rollup(n models.TaskNode) models.TaskStatus {
+	status := n.Status
+	for _, c := range n.Children {
+		if c.RollupStatus != status {
+			return models.CurrentWorkflow().Reopen
+		}
+	}
+	return status
+}
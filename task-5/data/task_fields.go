@@ -0,0 +1,69 @@
+package data
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"unicode"
+
+	"task_manager/models"
+)
+
+var (
+	ErrInvalidPriority = errors.New("invalid task priority")
+	ErrInvalidLabels   = errors.New("use at most 20 labels of 1-32 characters, without commas")
+	ErrInvalidAssignee = errors.New("assignee must be a user name of at most 64 characters, without spaces")
+)
+
+const (
+	maxLabels      = 20
+	maxLabelLen    = 32
+	maxAssigneeLen = 64
+)
+
+// createPriority applies the default to an unset priority.
+func createPriority(p models.TaskPriority) (models.TaskPriority, error) {
+	if p == "" {
+		return models.DefaultPriority, nil
+	}
+	if !models.IsValidPriority(p) {
+		return "", ErrInvalidPriority
+	}
+	return p, nil
+}
+
+// withDefaults fills in fields that tasks logged before they existed lack.
+func withDefaults(t models.Task) models.Task {
+	if t.Priority == "" {
+		t.Priority = models.DefaultPriority
+	}
+	return t
+}
+
+// normalizeLabels trims and lower-cases labels and returns them as a sorted
+// set, so "Bug" and "bug " are the same label.
+func normalizeLabels(labels []string) ([]string, error) {
+	var out []string
+	for _, l := range labels {
+		l = strings.ToLower(strings.TrimSpace(l))
+		if l == "" || len(l) > maxLabelLen || strings.Contains(l, ",") {
+			return nil, ErrInvalidLabels
+		}
+		out = append(out, l)
+	}
+	slices.Sort(out)
+	out = slices.Compact(out)
+	if len(out) > maxLabels {
+		return nil, ErrInvalidLabels
+	}
+	return out, nil
+}
+
+// normalizeAssignee trims the assignee; "" means unassigned.
+func normalizeAssignee(a string) (string, error) {
+	a = strings.TrimSpace(a)
+	if len(a) > maxAssigneeLen || strings.ContainsFunc(a, unicode.IsSpace) {
+		return "", ErrInvalidAssignee
+	}
+	return a, nil
+}
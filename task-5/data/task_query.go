@@ -0,0 +1,213 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"task_manager/models"
+)
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+// pageCursor marks the last task of a page: its value in the sort field and
+// its ID, so the next page starts strictly after it.
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+func sortKey(q models.TaskQuery) string {
+	if q.SortDesc {
+		return "-" + q.SortBy
+	}
+	return q.SortBy
+}
+
+func encodeCursor(q models.TaskQuery, t models.Task) string {
+	c := pageCursor{Sort: sortKey(q), Value: fieldValue(t, q.SortBy), ID: t.ID}
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(q models.TaskQuery) (models.Task, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return models.Task{}, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	var c pageCursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return models.Task{}, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	if c.Sort != sortKey(q) {
+		return models.Task{}, fmt.Errorf("%w: cursor was issued for sort=%s", ErrInvalidQuery, c.Sort)
+	}
+	pivot := models.Task{ID: c.ID}
+	if err := setFieldValue(&pivot, q.SortBy, c.Value); err != nil {
+		return models.Task{}, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	return pivot, nil
+}
+
+func fieldValue(t models.Task, field string) string {
+	switch field {
+	case "title":
+		return t.Title
+	case "description":
+		return t.Description
+	case "status":
+		return string(t.Status)
+	case "due_date":
+		return t.DueDate.Format(time.RFC3339Nano)
+	case "created_at":
+		return t.CreatedAt.Format(time.RFC3339Nano)
+	case "updated_at":
+		return t.UpdatedAt.Format(time.RFC3339Nano)
+	default:
+		return strconv.FormatInt(t.ID, 10)
+	}
+}
+
+func setFieldValue(t *models.Task, field, v string) error {
+	var err error
+	switch field {
+	case "title":
+		t.Title = v
+	case "description":
+		t.Description = v
+	case "status":
+		t.Status = models.TaskStatus(v)
+	case "due_date":
+		t.DueDate, err = time.Parse(time.RFC3339Nano, v)
+	case "created_at":
+		t.CreatedAt, err = time.Parse(time.RFC3339Nano, v)
+	case "updated_at":
+		t.UpdatedAt, err = time.Parse(time.RFC3339Nano, v)
+	}
+	return err
+}
+
+// compareTasks orders by the query's sort field, then by ID, honouring the
+// direction for both so the order is total and cursors are stable.
+func compareTasks(a, b models.Task, q models.TaskQuery) int {
+	var c int
+	switch q.SortBy {
+	case "title":
+		c = strings.Compare(a.Title, b.Title)
+	case "description":
+		c = strings.Compare(a.Description, b.Description)
+	case "status":
+		c = strings.Compare(string(a.Status), string(b.Status))
+	case "due_date":
+		c = a.DueDate.Compare(b.DueDate)
+	case "created_at":
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	case "updated_at":
+		c = a.UpdatedAt.Compare(b.UpdatedAt)
+	}
+	if c == 0 {
+		c = cmp.Compare(a.ID, b.ID)
+	}
+	if q.SortDesc {
+		return -c
+	}
+	return c
+}
+
+func matchesQuery(t models.Task, q models.TaskQuery) bool {
+	if len(q.Statuses) > 0 && !slices.Contains(q.Statuses, t.Status) {
+		return false
+	}
+	if q.Title != "" && !strings.Contains(strings.ToLower(t.Title), strings.ToLower(q.Title)) {
+		return false
+	}
+	if len(q.Priorities) > 0 && !slices.Contains(q.Priorities, t.Priority) {
+		return false
+	}
+	for _, l := range q.Labels {
+		if !slices.Contains(t.Labels, l) {
+			return false
+		}
+	}
+	if q.Assignee != "" && t.Assignee != q.Assignee {
+		return false
+	}
+	return inRange(t.DueDate, q.DueFrom, q.DueTo) &&
+		inRange(t.CreatedAt, q.CreatedFrom, q.CreatedTo) &&
+		inRange(t.UpdatedAt, q.UpdatedFrom, q.UpdatedTo)
+}
+
+func inRange(t time.Time, from, to *time.Time) bool {
+	if from != nil && t.Before(*from) {
+		return false
+	}
+	if to != nil && t.After(*to) {
+		return false
+	}
+	return true
+}
+
+// normalizeQuery fills in defaults and rejects combinations we can't serve.
+func normalizeQuery(q models.TaskQuery) (models.TaskQuery, error) {
+	if q.SortBy == "" {
+		q.SortBy = "id"
+	}
+	if !models.SortableFields[q.SortBy] {
+		return q, fmt.Errorf("%w: cannot sort by %q", ErrInvalidQuery, q.SortBy)
+	}
+	if q.Limit <= 0 {
+		q.Limit = models.DefaultPageLimit
+	}
+	if q.Limit > models.MaxPageLimit {
+		q.Limit = models.MaxPageLimit
+	}
+	if q.Offset < 0 {
+		return q, fmt.Errorf("%w: offset must not be negative", ErrInvalidQuery)
+	}
+	if q.Cursor != "" && q.Offset > 0 {
+		return q, fmt.Errorf("%w: use either cursor or offset, not both", ErrInvalidQuery)
+	}
+	for _, s := range q.Statuses {
+		if !models.IsValidStatus(s) {
+			return q, ErrInvalidStatus
+		}
+	}
+	for _, p := range q.Priorities {
+		if !models.IsValidPriority(p) {
+			return q, ErrInvalidPriority
+		}
+	}
+	labels, err := normalizeLabels(q.Labels)
+	if err != nil {
+		return q, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+	q.Labels = labels
+	q.Assignee = strings.TrimSpace(q.Assignee)
+	return q, nil
+}
+
+// AllTasks returns every task matching q in q's sort order, reading it
+// page by page; q's paging fields are ignored.
+func AllTasks(ctx context.Context, repo TaskRepository, q models.TaskQuery) ([]models.Task, error) {
+	q.Limit, q.Offset, q.Cursor = models.MaxPageLimit, 0, ""
+	var out []models.Task
+	for {
+		page, err := repo.List(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, page.Data...)
+		if page.NextCursor == "" {
+			return out, nil
+		}
+		q.Cursor = page.NextCursor
+	}
+}
@@ -1,7 +1,13 @@
 package data
 
 import (
+	"cmp"
+	"context"
 	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
 	"sync"
 	"time"
 
@@ -9,56 +15,145 @@ import (
 )
 
 var (
-	ErrNotFound      = errors.New("task not found")
-	ErrInvalidStatus = errors.New("invalid task status")
-	ErrInvalidDate   = errors.New("invalid due date (use RFC3339)")
+	ErrNotFound        = errors.New("task not found")
+	ErrInvalidStatus   = errors.New("invalid task status")
+	ErrInvalidDate     = errors.New("invalid due date (use RFC3339)")
+	ErrVersionMismatch = errors.New("task has been modified since it was read")
 )
 
-// InMemoryTaskService provides a thread-safe in-memory store.
+// InMemoryTaskService provides a thread-safe in-memory store. When created
+// with NewDurableTaskService every change is also written to a log on disk.
 type InMemoryTaskService struct {
-	mu    sync.RWMutex
-	seq   int64
-	tasks map[int64]models.Task
+	mu     sync.RWMutex
+	seq    int64
+	tasks  map[int64]models.Task
+	wal    *taskLog
+	events *EventHub
+
+	// pending and pendingEvents collect the log records and events of an
+	// atomic batch until it commits.
+	pending       []walRecord
+	pendingEvents []TaskEvent
 }
 
 func NewInMemoryTaskService() *InMemoryTaskService {
 	return &InMemoryTaskService{
-		tasks: make(map[int64]models.Task),
+		tasks:  make(map[int64]models.Task),
+		events: NewEventHub(EventReplaySize),
 	}
 }
 
-func (s *InMemoryTaskService) List() []models.Task {
+func (s *InMemoryTaskService) Events() *EventHub { return s.events }
+
+// List returns one page of the tasks matching q, in q's sort order.
+func (s *InMemoryTaskService) List(ctx context.Context, q models.TaskQuery) (models.TaskPage, error) {
+	q, err := normalizeQuery(q)
+	if err != nil {
+		return models.TaskPage{}, err
+	}
+
 	s.mu.RLock()
-	defer s.mu.RUnlock()
-	out := make([]models.Task, 0, len(s.tasks))
+	matched := make([]models.Task, 0, len(s.tasks))
 	for _, t := range s.tasks {
-		out = append(out, t)
+		if matchesQuery(t, q) {
+			matched = append(matched, t)
+		}
 	}
-	return out
+	s.mu.RUnlock()
+
+	slices.SortFunc(matched, func(a, b models.Task) int { return compareTasks(a, b, q) })
+
+	start := q.Offset
+	if q.Cursor != "" {
+		pivot, err := decodeCursor(q)
+		if err != nil {
+			return models.TaskPage{}, err
+		}
+		start, _ = slices.BinarySearchFunc(matched, pivot, func(t, p models.Task) int {
+			if compareTasks(t, p, q) <= 0 {
+				return -1
+			}
+			return 1
+		})
+	}
+	start = min(start, len(matched))
+	end := min(start+q.Limit, len(matched))
+
+	page := models.TaskPage{
+		Data:   matched[start:end],
+		Total:  int64(len(matched)),
+		Limit:  q.Limit,
+		Offset: start,
+	}
+	if end < len(matched) && end > start {
+		page.NextCursor = encodeCursor(q, matched[end-1])
+	}
+	return page, nil
 }
 
-func (s *InMemoryTaskService) Get(id int64) (models.Task, error) {
+func (s *InMemoryTaskService) Get(ctx context.Context, id string) (models.Task, error) {
+	key, ok := parseID(id)
+	if !ok {
+		return models.Task{}, ErrNotFound
+	}
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	t, ok := s.tasks[id]
+	t, ok := s.tasks[key]
 	if !ok {
 		return models.Task{}, ErrNotFound
 	}
 	return t, nil
 }
 
-func (s *InMemoryTaskService) Create(dto models.CreateTaskDTO) (models.Task, error) {
-	if !models.IsValidStatus(dto.Status) {
-		return models.Task{}, ErrInvalidStatus
+func (s *InMemoryTaskService) Create(ctx context.Context, dto models.CreateTaskDTO) (models.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	task, err := s.create(dto)
+	if err != nil {
+		return models.Task{}, err
+	}
+	slog.DebugContext(ctx, "task created", "task_id", task.ID)
+	s.maybeCompact(ctx)
+	return task, nil
+}
+
+// create adds the task described by dto. Callers hold s.mu.
+func (s *InMemoryTaskService) create(dto models.CreateTaskDTO) (models.Task, error) {
+	if err := checkInitial(dto.Status); err != nil {
+		return models.Task{}, err
 	}
 	due, err := time.Parse(time.RFC3339, dto.DueDate)
 	if err != nil {
 		return models.Task{}, ErrInvalidDate
 	}
+	priority, err := createPriority(dto.Priority)
+	if err != nil {
+		return models.Task{}, err
+	}
+	labels, err := normalizeLabels(dto.Labels)
+	if err != nil {
+		return models.Task{}, err
+	}
+	assignee, err := normalizeAssignee(dto.Assignee)
+	if err != nil {
+		return models.Task{}, err
+	}
+	recurrence, zone, err := normalizeRecurrence(dto.Recurrence, dto.TimeZone)
+	if err != nil {
+		return models.Task{}, err
+	}
 
 	now := time.Now()
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	if _, ok := s.tasks[dto.ParentID]; dto.ParentID != 0 && !ok {
+		return models.Task{}, ErrInvalidParent
+	}
+	blockers, err := s.checkBlockers(0, dto.BlockedBy)
+	if err != nil {
+		return models.Task{}, err
+	}
+	if startsWork(dto.Status) && s.hasOpenBlocker(blockers) {
+		return models.Task{}, ErrBlocked
+	}
 	s.seq++
 	task := models.Task{
 		ID:          s.seq,
@@ -66,20 +161,56 @@ func (s *InMemoryTaskService) Create(dto models.CreateTaskDTO) (models.Task, err
 		Description: dto.Description,
 		DueDate:     due,
 		Status:      dto.Status,
+		ParentID:    dto.ParentID,
+		BlockedBy:   blockers,
+		Priority:    priority,
+		Labels:      labels,
+		Assignee:    assignee,
+		Recurrence:  recurrence,
+		TimeZone:    zone,
+		Version:     1,
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
+	if recurrence != "" {
+		task.SeriesID, task.SeriesStart = task.ID, &due
+	}
+	if err := s.persist(walRecord{Op: walPut, ID: task.ID, Task: &task}); err != nil {
+		s.seq--
+		return models.Task{}, err
+	}
 	s.tasks[task.ID] = task
+	if err := s.reopenAncestors(task); err != nil {
+		return models.Task{}, err
+	}
 	return task, nil
 }
 
-func (s *InMemoryTaskService) Update(id int64, dto models.UpdateTaskDTO) (models.Task, error) {
+func (s *InMemoryTaskService) Update(ctx context.Context, id string, dto models.UpdateTaskDTO, version int64) (models.Task, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	task, ok := s.tasks[id]
+	task, err := s.update(id, dto, version)
+	if err != nil {
+		return models.Task{}, err
+	}
+	slog.DebugContext(ctx, "task updated", "task_id", task.ID, "version", task.Version)
+	s.maybeCompact(ctx)
+	return task, nil
+}
+
+// update applies dto to task id. Callers hold s.mu.
+func (s *InMemoryTaskService) update(id string, dto models.UpdateTaskDTO, version int64) (models.Task, error) {
+	key, ok := parseID(id)
 	if !ok {
 		return models.Task{}, ErrNotFound
 	}
+	task, ok := s.tasks[key]
+	if !ok {
+		return models.Task{}, ErrNotFound
+	}
+	if version != AnyVersion && version != task.Version {
+		return models.Task{}, ErrVersionMismatch
+	}
 
 	if dto.Title != nil {
 		task.Title = *dto.Title
@@ -87,9 +218,10 @@ func (s *InMemoryTaskService) Update(id int64, dto models.UpdateTaskDTO) (models
 	if dto.Description != nil {
 		task.Description = *dto.Description
 	}
+	wasStatus := task.Status
 	if dto.Status != nil {
-		if !models.IsValidStatus(*dto.Status) {
-			return models.Task{}, ErrInvalidStatus
+		if err := checkTransition(task.Status, *dto.Status); err != nil {
+			return models.Task{}, err
 		}
 		task.Status = *dto.Status
 	}
@@ -100,17 +232,468 @@ func (s *InMemoryTaskService) Update(id int64, dto models.UpdateTaskDTO) (models
 		}
 		task.DueDate = d
 	}
+	if dto.Recurrence != nil || dto.TimeZone != nil {
+		rule, zone := task.Recurrence, task.TimeZone
+		if dto.Recurrence != nil {
+			rule = *dto.Recurrence
+		}
+		if dto.TimeZone != nil {
+			zone = *dto.TimeZone
+		}
+		rule, zone, err := normalizeRecurrence(rule, zone)
+		if err != nil {
+			return models.Task{}, err
+		}
+		// A new rule or zone starts a new series at this task.
+		if rule != "" && (rule != task.Recurrence || zone != task.TimeZone) {
+			start := task.DueDate
+			task.SeriesID, task.SeriesStart = key, &start
+		}
+		task.Recurrence, task.TimeZone = rule, zone
+	}
+	if dto.Priority != nil {
+		if !models.IsValidPriority(*dto.Priority) {
+			return models.Task{}, ErrInvalidPriority
+		}
+		task.Priority = *dto.Priority
+	}
+	if dto.Labels != nil {
+		labels, err := normalizeLabels(*dto.Labels)
+		if err != nil {
+			return models.Task{}, err
+		}
+		task.Labels = labels
+	}
+	if dto.Assignee != nil {
+		assignee, err := normalizeAssignee(*dto.Assignee)
+		if err != nil {
+			return models.Task{}, err
+		}
+		task.Assignee = assignee
+	}
+	if dto.ParentID != nil && *dto.ParentID != task.ParentID {
+		if err := s.checkParent(key, *dto.ParentID); err != nil {
+			return models.Task{}, err
+		}
+		task.ParentID = *dto.ParentID
+	}
+	if dto.BlockedBy != nil {
+		blockers, err := s.checkBlockers(key, *dto.BlockedBy)
+		if err != nil {
+			return models.Task{}, err
+		}
+		task.BlockedBy = blockers
+	}
+	if models.IsDone(task.Status) && s.hasOpenChild(key) {
+		return models.Task{}, ErrOpenSubtasks
+	}
+	if task.Status != wasStatus && startsWork(task.Status) && s.hasOpenBlocker(task.BlockedBy) {
+		return models.Task{}, ErrBlocked
+	}
+	task.Version++
 	task.UpdatedAt = time.Now()
-	s.tasks[id] = task
+	if err := s.persist(walRecord{Op: walPut, ID: key, Task: &task}); err != nil {
+		return models.Task{}, err
+	}
+	s.tasks[key] = task
+	if err := s.reopenAncestors(task); err != nil {
+		return models.Task{}, err
+	}
+	if models.IsDone(task.Status) && !models.IsDone(wasStatus) {
+		if due, ok := nextDue(task.Recurrence, task.TimeZone, task.SeriesStart, task.DueDate); ok && !s.hasOccurrence(task.SeriesID, due) {
+			if _, err := s.addOccurrence(task, due, task.UpdatedAt); err != nil {
+				return models.Task{}, err
+			}
+		}
+	}
 	return task, nil
 }
 
-func (s *InMemoryTaskService) Delete(id int64) error {
+func (s *InMemoryTaskService) Delete(ctx context.Context, id string, version int64, cascade bool) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if _, ok := s.tasks[id]; !ok {
+	if err := s.remove(id, version, cascade); err != nil {
+		return err
+	}
+	slog.DebugContext(ctx, "task deleted", "task_id", id, "cascade", cascade)
+	s.maybeCompact(ctx)
+	return nil
+}
+
+// remove deletes task id, and its subtree if cascade is set. Callers hold
+// s.mu.
+func (s *InMemoryTaskService) remove(id string, version int64, cascade bool) error {
+	key, ok := parseID(id)
+	if !ok {
+		return ErrNotFound
+	}
+	task, ok := s.tasks[key]
+	if !ok {
 		return ErrNotFound
 	}
-	delete(s.tasks, id)
+	if version != AnyVersion && version != task.Version {
+		return ErrVersionMismatch
+	}
+	sub := s.descendants(key)
+	if len(sub) > 0 && !cascade {
+		return ErrHasSubtasks
+	}
+	// The root goes first so a crash part-way leaves only orphans of a
+	// deleted parent, never a parent with its subtree half gone.
+	for _, t := range append([]models.Task{task}, sub...) {
+		if err := s.persist(walRecord{Op: walDelete, ID: t.ID}); err != nil {
+			return err
+		}
+		delete(s.tasks, t.ID)
+	}
+	return s.dropBlockers(time.Now())
+}
+
+// Batch applies ops in order under one lock. An atomic batch is written to
+// the log as a single record, so after a failure or a crash either all of
+// it applies or none does. Its events go out once it has committed.
+func (s *InMemoryTaskService) Batch(ctx context.Context, ops []BatchOp, atomic bool) ([]BatchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !atomic {
+		results, _ := runBatch(ops, false, s.apply)
+		slog.DebugContext(ctx, "batch applied", "operations", len(ops), "atomic", false)
+		s.maybeCompact(ctx)
+		return results, nil
+	}
+	tasks, seq := maps.Clone(s.tasks), s.seq
+	s.pending = []walRecord{}
+	results, err := runBatch(ops, true, s.apply)
+	pending, events := s.pending, s.pendingEvents
+	s.pending, s.pendingEvents = nil, nil
+	if err == nil && len(pending) > 0 {
+		err = s.writeLog(walRecord{Op: walBatch, Records: pending})
+	}
+	if err != nil {
+		s.tasks, s.seq = tasks, seq
+		return nil, err
+	}
+	for _, ev := range events {
+		s.events.Publish(ev)
+	}
+	slog.DebugContext(ctx, "batch applied", "operations", len(ops), "atomic", true)
+	s.maybeCompact(ctx)
+	return results, nil
+}
+
+// apply runs one batch operation. Callers hold s.mu.
+func (s *InMemoryTaskService) apply(op BatchOp) (models.Task, error) {
+	switch op.Op {
+	case models.BatchCreate:
+		return s.create(op.Create)
+	case models.BatchUpdate:
+		return s.update(op.ID, op.Update, op.Version)
+	default:
+		return models.Task{}, s.remove(op.ID, op.Version, op.Cascade)
+	}
+}
+
+// MigrateStatuses rewrites statuses listed under the workflow's migrate
+// map, logging each change, and fails if any task is still in a status the
+// workflow doesn't define.
+func (s *InMemoryTaskService) MigrateStatuses(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := models.CurrentWorkflow()
+	now := time.Now()
+	var unknown []models.TaskStatus
+	for id, t := range s.tasks {
+		if to, ok := w.Migrate[t.Status]; ok && to != t.Status {
+			t.Status = to
+			t.Version++
+			t.UpdatedAt = now
+			if err := s.persist(walRecord{Op: walPut, ID: id, Task: &t}); err != nil {
+				return err
+			}
+			s.tasks[id] = t
+		}
+		if !models.IsValidStatus(t.Status) && !slices.Contains(unknown, t.Status) {
+			unknown = append(unknown, t.Status)
+		}
+	}
+	if len(unknown) > 0 {
+		slices.Sort(unknown)
+		return unknownStatuses(unknown)
+	}
+	s.maybeCompact(ctx)
 	return nil
 }
+
+func (s *InMemoryTaskService) CountByStatus(ctx context.Context) (map[models.TaskStatus]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	counts := make(map[models.TaskStatus]int64)
+	for _, t := range s.tasks {
+		counts[t.Status]++
+	}
+	return counts, nil
+}
+
+// ScheduleOccurrences extends every series up to until.
+func (s *InMemoryTaskService) ScheduleOccurrences(ctx context.Context, until time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	latest := make(map[int64]models.Task)
+	for _, t := range s.tasks {
+		l, ok := latest[t.SeriesID]
+		if t.SeriesID != 0 && (!ok || t.DueDate.After(l.DueDate) || t.DueDate.Equal(l.DueDate) && t.ID > l.ID) {
+			latest[t.SeriesID] = t
+		}
+	}
+	series := slices.SortedFunc(maps.Values(latest), func(a, b models.Task) int { return cmp.Compare(a.ID, b.ID) })
+	now := time.Now()
+	created := 0
+	for _, t := range series {
+		for range maxScheduled {
+			due, ok := nextDue(t.Recurrence, t.TimeZone, t.SeriesStart, t.DueDate)
+			if !ok || due.After(until) {
+				break
+			}
+			next, err := s.addOccurrence(t, due, now)
+			if err != nil {
+				return created, err
+			}
+			t = next
+			created++
+		}
+	}
+	s.maybeCompact(ctx)
+	return created, nil
+}
+
+// Children returns the direct subtasks of id in creation order.
+func (s *InMemoryTaskService) Children(ctx context.Context, id string) ([]models.Task, error) {
+	key, ok := parseID(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.tasks[key]; !ok {
+		return nil, ErrNotFound
+	}
+	children := []models.Task{}
+	for _, t := range s.tasks {
+		if t.ParentID == key {
+			children = append(children, t)
+		}
+	}
+	slices.SortFunc(children, func(a, b models.Task) int { return cmp.Compare(a.ID, b.ID) })
+	return children, nil
+}
+
+func (s *InMemoryTaskService) Tree(ctx context.Context, id string) (models.TaskNode, error) {
+	key, ok := parseID(id)
+	if !ok {
+		return models.TaskNode{}, ErrNotFound
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	root, ok := s.tasks[key]
+	if !ok {
+		return models.TaskNode{}, ErrNotFound
+	}
+	return buildTree(root, s.descendants(key)), nil
+}
+
+// Blockers returns every task id transitively waits on, by ID.
+func (s *InMemoryTaskService) Blockers(ctx context.Context, id string) ([]models.Task, error) {
+	key, ok := parseID(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	task, ok := s.tasks[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	out := []models.Task{}
+	for b := range s.blockerClosure(task.BlockedBy) {
+		out = append(out, s.tasks[b])
+	}
+	slices.SortFunc(out, func(a, b models.Task) int { return cmp.Compare(a.ID, b.ID) })
+	return out, nil
+}
+
+// blockerClosure collects ids and everything they transitively wait on.
+// Callers hold s.mu.
+func (s *InMemoryTaskService) blockerClosure(ids []int64) map[int64]bool {
+	seen := make(map[int64]bool)
+	ids = slices.Clone(ids)
+	for len(ids) > 0 {
+		id := ids[len(ids)-1]
+		ids = ids[:len(ids)-1]
+		if t, ok := s.tasks[id]; ok && !seen[id] {
+			seen[id] = true
+			ids = append(ids, t.BlockedBy...)
+		}
+	}
+	return seen
+}
+
+// checkBlockers vets blockers as the new BlockedBy of id (0 for a task not
+// yet created) and returns them deduplicated. Callers hold s.mu.
+func (s *InMemoryTaskService) checkBlockers(id int64, blockers []int64) ([]int64, error) {
+	var out []int64
+	for _, b := range blockers {
+		if _, ok := s.tasks[b]; !ok {
+			return nil, ErrInvalidBlocker
+		}
+		if !slices.Contains(out, b) {
+			out = append(out, b)
+		}
+	}
+	if id != 0 && s.blockerClosure(out)[id] {
+		return nil, ErrDependencyCycle
+	}
+	return out, nil
+}
+
+func (s *InMemoryTaskService) hasOpenBlocker(blockers []int64) bool {
+	for _, b := range blockers {
+		if !models.IsDone(s.tasks[b].Status) {
+			return true
+		}
+	}
+	return false
+}
+
+// dropBlockers removes edges to tasks that no longer exist, logging each
+// changed dependent. Callers hold s.mu.
+func (s *InMemoryTaskService) dropBlockers(now time.Time) error {
+	for id, t := range s.tasks {
+		kept := slices.DeleteFunc(slices.Clone(t.BlockedBy), func(b int64) bool {
+			_, ok := s.tasks[b]
+			return !ok
+		})
+		if len(kept) == len(t.BlockedBy) {
+			continue
+		}
+		t.BlockedBy = kept
+		t.Version++
+		t.UpdatedAt = now
+		if err := s.persist(walRecord{Op: walPut, ID: id, Task: &t}); err != nil {
+			return err
+		}
+		s.tasks[id] = t
+	}
+	return nil
+}
+
+// descendants lists the whole subtree below id, in creation order. Callers
+// hold s.mu.
+func (s *InMemoryTaskService) descendants(id int64) []models.Task {
+	var out []models.Task
+	for _, t := range s.tasks {
+		for p := t.ParentID; p != 0; p = s.tasks[p].ParentID {
+			if p == id {
+				out = append(out, t)
+				break
+			}
+		}
+	}
+	slices.SortFunc(out, func(a, b models.Task) int { return cmp.Compare(a.ID, b.ID) })
+	return out
+}
+
+// checkParent vets moving id under parent. Callers hold s.mu.
+func (s *InMemoryTaskService) checkParent(id, parent int64) error {
+	if parent == 0 {
+		return nil
+	}
+	if _, ok := s.tasks[parent]; !ok {
+		return ErrInvalidParent
+	}
+	for p := parent; p != 0; p = s.tasks[p].ParentID {
+		if p == id {
+			return ErrParentCycle
+		}
+	}
+	return nil
+}
+
+func (s *InMemoryTaskService) hasOpenChild(id int64) bool {
+	for _, t := range s.tasks {
+		if t.ParentID == id && !models.IsDone(t.Status) {
+			return true
+		}
+	}
+	return false
+}
+
+// reopenAncestors keeps "done means every subtask is done" true after t was
+// written: while t is open, each done ancestor goes back to the workflow's
+// reopen status, whatever its transitions say. Callers hold s.mu.
+func (s *InMemoryTaskService) reopenAncestors(t models.Task) error {
+	if models.IsDone(t.Status) {
+		return nil
+	}
+	for p := t.ParentID; p != 0; {
+		parent := s.tasks[p]
+		if !models.IsDone(parent.Status) {
+			return nil
+		}
+		parent.Status = models.CurrentWorkflow().Reopen
+		parent.Version++
+		parent.UpdatedAt = t.UpdatedAt
+		if err := s.persist(walRecord{Op: walPut, ID: p, Task: &parent}); err != nil {
+			return err
+		}
+		s.tasks[p] = parent
+		p = parent.ParentID
+	}
+	return nil
+}
+
+func (s *InMemoryTaskService) hasOccurrence(series int64, due time.Time) bool {
+	for _, t := range s.tasks {
+		if t.SeriesID == series && t.DueDate.Equal(due) {
+			return true
+		}
+	}
+	return false
+}
+
+// addOccurrence creates the task due at due that follows t in its series.
+// It starts in the workflow's first initial status and takes everything
+// else but its blockers from t. Callers hold s.mu.
+func (s *InMemoryTaskService) addOccurrence(t models.Task, due, now time.Time) (models.Task, error) {
+	s.seq++
+	next := models.Task{
+		ID:          s.seq,
+		Title:       t.Title,
+		Description: t.Description,
+		DueDate:     due,
+		Status:      models.CurrentWorkflow().InitialStatuses()[0],
+		ParentID:    t.ParentID,
+		Priority:    t.Priority,
+		Labels:      slices.Clone(t.Labels),
+		Assignee:    t.Assignee,
+		Recurrence:  t.Recurrence,
+		TimeZone:    t.TimeZone,
+		SeriesID:    t.SeriesID,
+		SeriesStart: t.SeriesStart,
+		Version:     1,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.persist(walRecord{Op: walPut, ID: next.ID, Task: &next}); err != nil {
+		s.seq--
+		return models.Task{}, err
+	}
+	s.tasks[next.ID] = next
+	return next, s.reopenAncestors(next)
+}
+
+// parseID turns an API ID into a map key. Anything that isn't one of our
+// sequence numbers simply doesn't exist.
+func parseID(id string) (int64, bool) {
+	n, err := strconv.ParseInt(id, 10, 64)
+	return n, err == nil
+}
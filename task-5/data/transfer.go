@@ -0,0 +1,233 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"task_manager/models"
+)
+
+var (
+	ErrDuplicateRecord = errors.New("id appears more than once in the file")
+	ErrRecordCycle     = errors.New("parent_id and blocked_by form a cycle within the file")
+	ErrRecordDependent = errors.New("parent_id or blocked_by names a task of the file that was not imported")
+)
+
+// ExportTasks returns every task matching q as export records. A recurring
+// series keeps its rule only on its latest task, so importing the records
+// continues the series instead of starting one per occurrence.
+func ExportTasks(ctx context.Context, repo TaskRepository, q models.TaskQuery) ([]models.TaskRecord, error) {
+	tasks, err := AllTasks(ctx, repo, q)
+	if err != nil {
+		return nil, err
+	}
+	latest := make(map[int64]models.Task)
+	for _, t := range tasks {
+		if l, ok := latest[t.SeriesID]; t.SeriesID != 0 && (!ok || t.DueDate.After(l.DueDate)) {
+			latest[t.SeriesID] = t
+		}
+	}
+	records := make([]models.TaskRecord, len(tasks))
+	for i, t := range tasks {
+		r := models.TaskRecord{
+			ID:          recordID(t.ID),
+			Title:       t.Title,
+			Description: t.Description,
+			DueDate:     t.DueDate.Format(time.RFC3339),
+			Status:      t.Status,
+			ParentID:    recordID(t.ParentID),
+			Priority:    t.Priority,
+			Labels:      t.Labels,
+			Assignee:    t.Assignee,
+		}
+		for _, b := range t.BlockedBy {
+			r.BlockedBy = append(r.BlockedBy, recordID(b))
+		}
+		if t.SeriesID == 0 || latest[t.SeriesID].ID == t.ID {
+			r.Recurrence, r.TimeZone = t.Recurrence, t.TimeZone
+		}
+		records[i] = r
+	}
+	return records, nil
+}
+
+func recordID(id int64) models.RecordID {
+	if id == 0 {
+		return ""
+	}
+	return models.RecordID(strconv.FormatInt(id, 10))
+}
+
+// ImportResult is the outcome of importing one record. Task is the stored
+// task it became or, when skipped, kept; it is zero on failure.
+type ImportResult struct {
+	Action string // one of models.Import*
+	Task   models.Task
+	Err    error
+}
+
+// ImportTasks stores records one by one; a failure only affects its own
+// record and the records naming it. A record whose id is already taken is
+// handled by policy, other records become new tasks.
+//
+// ParentID and BlockedBy that name another record of the file point to the
+// task that record became, so parents and blockers are imported before the
+// records naming them; other IDs are taken as IDs of stored tasks.
+func ImportTasks(ctx context.Context, repo TaskRepository, records []models.TaskRecord, policy models.ConflictPolicy) []ImportResult {
+	results := make([]ImportResult, len(records))
+	byID := make(map[models.RecordID]int, len(records))
+	for i, r := range records {
+		if _, dup := byID[r.ID]; dup && r.ID != "" {
+			results[i] = ImportResult{Action: models.ImportFailed, Err: ErrDuplicateRecord}
+			continue
+		}
+		if r.ID != "" {
+			byID[r.ID] = i
+		}
+	}
+
+	// stored maps the records imported so far to the ID of their task.
+	stored := make(map[int]string, len(records))
+	// 0 unvisited, 1 on the current path, 2 done
+	state := make([]int, len(records))
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case 1:
+			return ErrRecordCycle
+		case 2:
+			if results[i].Err != nil {
+				return ErrRecordDependent
+			}
+			return nil
+		}
+		state[i] = 1
+		defer func() { state[i] = 2 }()
+		if results[i].Err != nil {
+			return ErrRecordDependent
+		}
+
+		r := records[i]
+		resolve := func(ref models.RecordID) (string, error) {
+			j, ok := byID[ref]
+			if !ok {
+				return string(ref), nil
+			}
+			if err := visit(j); err != nil {
+				return "", err
+			}
+			return stored[j], nil
+		}
+		var refs []string
+		for _, ref := range append([]models.RecordID{r.ParentID}, r.BlockedBy...) {
+			id, err := resolve(ref)
+			if err != nil {
+				if !errors.Is(err, ErrRecordCycle) {
+					err = ErrRecordDependent
+				}
+				results[i] = ImportResult{Action: models.ImportFailed, Err: err}
+				return err
+			}
+			refs = append(refs, id)
+		}
+		results[i] = importRecord(ctx, repo, r, refs[0], refs[1:], policy)
+		if results[i].Err != nil {
+			return ErrRecordDependent
+		}
+		stored[i] = strconv.FormatInt(results[i].Task.ID, 10)
+		return nil
+	}
+	for i := range records {
+		_ = visit(i)
+	}
+	return results
+}
+
+// importRecord stores one record, its references already resolved.
+func importRecord(ctx context.Context, repo TaskRepository, r models.TaskRecord, parent string, blockers []string, policy models.ConflictPolicy) ImportResult {
+	dto, err := recordDTO(r, parent, blockers)
+	if err != nil {
+		return ImportResult{Action: models.ImportFailed, Err: err}
+	}
+	if r.ID != "" && policy != models.ConflictNewID {
+		existing, err := repo.Get(ctx, string(r.ID))
+		switch {
+		case errors.Is(err, ErrNotFound):
+		case err != nil:
+			return ImportResult{Action: models.ImportFailed, Err: err}
+		case policy == models.ConflictSkip:
+			return ImportResult{Action: models.ImportSkipped, Task: existing}
+		default:
+			t, err := repo.Update(ctx, string(r.ID), replaceDTO(dto), AnyVersion)
+			if err != nil {
+				return ImportResult{Action: models.ImportFailed, Err: err}
+			}
+			return ImportResult{Action: models.ImportUpdated, Task: t}
+		}
+	}
+	t, err := repo.Create(ctx, dto)
+	if err != nil {
+		return ImportResult{Action: models.ImportFailed, Err: err}
+	}
+	return ImportResult{Action: models.ImportCreated, Task: t}
+}
+
+func recordDTO(r models.TaskRecord, parent string, blockers []string) (models.CreateTaskDTO, error) {
+	dto := models.CreateTaskDTO{
+		Title:       r.Title,
+		Description: r.Description,
+		DueDate:     r.DueDate,
+		Status:      r.Status,
+		Priority:    r.Priority,
+		Labels:      r.Labels,
+		Assignee:    r.Assignee,
+		Recurrence:  r.Recurrence,
+		TimeZone:    r.TimeZone,
+	}
+	if parent != "" {
+		id, ok := parseID(parent)
+		if !ok {
+			return dto, ErrInvalidParent
+		}
+		dto.ParentID = id
+	}
+	for _, b := range blockers {
+		id, ok := parseID(b)
+		if !ok {
+			return dto, ErrInvalidBlocker
+		}
+		dto.BlockedBy = append(dto.BlockedBy, id)
+	}
+	return dto, nil
+}
+
+// replaceDTO sets every field of a task to what dto says.
+func replaceDTO(dto models.CreateTaskDTO) models.UpdateTaskDTO {
+	blockedBy := dto.BlockedBy
+	if blockedBy == nil {
+		blockedBy = []int64{}
+	}
+	labels := dto.Labels
+	if labels == nil {
+		labels = []string{}
+	}
+	priority := dto.Priority
+	if priority == "" {
+		priority = models.DefaultPriority
+	}
+	return models.UpdateTaskDTO{
+		Title:       &dto.Title,
+		Description: &dto.Description,
+		DueDate:     &dto.DueDate,
+		Status:      &dto.Status,
+		ParentID:    &dto.ParentID,
+		BlockedBy:   &blockedBy,
+		Priority:    &priority,
+		Labels:      &labels,
+		Assignee:    &dto.Assignee,
+		Recurrence:  &dto.Recurrence,
+		TimeZone:    &dto.TimeZone,
+	}
+}
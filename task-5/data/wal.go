@@ -0,0 +1,345 @@
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"task_manager/models"
+)
+
+const (
+	walFile      = "tasks.wal"
+	snapshotFile = "tasks.snapshot.json"
+
+	// DefaultCompactEvery is how many log records accumulate before the log
+	// is folded into a fresh snapshot.
+	DefaultCompactEvery = 1000
+)
+
+type walOp string
+
+const (
+	walPut    walOp = "put"
+	walDelete walOp = "delete"
+	walBatch  walOp = "batch"
+)
+
+// walRecord is one logged mutation. Puts carry the whole task so replay is
+// idempotent and a snapshot followed by an overlapping log stays correct. A
+// batch holds the puts and deletes of an atomic batch, which replay together
+// or not at all.
+type walRecord struct {
+	Op      walOp        `json:"op"`
+	ID      int64        `json:"id"`
+	Task    *models.Task `json:"task,omitempty"`
+	Records []walRecord  `json:"records,omitempty"`
+}
+
+type snapshot struct {
+	Seq   int64         `json:"seq"`
+	Tasks []models.Task `json:"tasks"`
+}
+
+// taskLog is the write-ahead log behind a durable InMemoryTaskService. Each
+// line is "<crc32 hex> <json>\n"; the checksum lets recovery tell a torn
+// final write from real corruption.
+type taskLog struct {
+	dir          string
+	f            *os.File
+	records      int
+	compactEvery int
+}
+
+// NewDurableTaskService opens (or creates) a task store persisted in dir.
+// Existing data is recovered from the latest snapshot plus the log written
+// after it. compactEvery <= 0 uses DefaultCompactEvery.
+func NewDurableTaskService(dir string, compactEvery int) (*InMemoryTaskService, error) {
+	if compactEvery <= 0 {
+		compactEvery = DefaultCompactEvery
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := NewInMemoryTaskService()
+	if err := s.loadSnapshot(filepath.Join(dir, snapshotFile)); err != nil {
+		return nil, err
+	}
+	records, err := s.replayLog(filepath.Join(dir, walFile))
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, walFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s.wal = &taskLog{dir: dir, f: f, records: records, compactEvery: compactEvery}
+	return s, nil
+}
+
+// Close flushes nothing (every write is already synced) and releases the log.
+func (s *InMemoryTaskService) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.wal == nil {
+		return nil
+	}
+	err := s.wal.f.Close()
+	s.wal = nil
+	return err
+}
+
+func (s *InMemoryTaskService) loadSnapshot(path string) error {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var snap snapshot
+	if err := json.Unmarshal(raw, &snap); err != nil {
+		return fmt.Errorf("read snapshot: %w", err)
+	}
+	s.seq = snap.Seq
+	for _, t := range snap.Tasks {
+		s.tasks[t.ID] = withDefaults(t)
+	}
+	return nil
+}
+
+// replayLog applies every intact record and truncates a torn tail left by a
+// crash mid-write. A bad record followed by good ones is corruption and is
+// reported rather than skipped.
+func (s *InMemoryTaskService) replayLog(path string) (int, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	records, good := 0, 0
+	sc := bufio.NewScanner(bytes.NewReader(raw))
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := sc.Bytes()
+		end := good + len(line) + 1
+		rec, err := decodeWALLine(line)
+		if err != nil || end > len(raw) {
+			if bytes.IndexByte(raw[min(end, len(raw)):], '\n') >= 0 {
+				return 0, fmt.Errorf("task log corrupted at byte %d: %v", good, err)
+			}
+			break // torn tail: everything after good is discarded
+		}
+		s.applyWAL(rec)
+		records++
+		good = end
+	}
+	if err := sc.Err(); err != nil {
+		return 0, err
+	}
+	if good < len(raw) {
+		if err := os.Truncate(path, int64(good)); err != nil {
+			return 0, err
+		}
+	}
+	return records, nil
+}
+
+func (s *InMemoryTaskService) applyWAL(rec walRecord) {
+	switch rec.Op {
+	case walPut:
+		s.tasks[rec.Task.ID] = withDefaults(*rec.Task)
+	case walDelete:
+		delete(s.tasks, rec.ID)
+	case walBatch:
+		for _, r := range rec.Records {
+			s.applyWAL(r)
+		}
+	}
+	if rec.ID > s.seq {
+		s.seq = rec.ID
+	}
+}
+
+func encodeWALLine(rec walRecord) ([]byte, error) {
+	body, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	line := make([]byte, 0, len(body)+10)
+	line = fmt.Appendf(line, "%08x ", crc32.ChecksumIEEE(body))
+	line = append(line, body...)
+	return append(line, '\n'), nil
+}
+
+func decodeWALLine(line []byte) (walRecord, error) {
+	var rec walRecord
+	if len(line) < 10 || line[8] != ' ' {
+		return rec, errors.New("short record")
+	}
+	sum, err := strconv.ParseUint(string(line[:8]), 16, 32)
+	if err != nil {
+		return rec, errors.New("bad checksum field")
+	}
+	body := line[9:]
+	if crc32.ChecksumIEEE(body) != uint32(sum) {
+		return rec, errors.New("checksum mismatch")
+	}
+	if err := json.Unmarshal(body, &rec); err != nil {
+		return rec, err
+	}
+	if !wellFormed(rec) {
+		return rec, errors.New("malformed record")
+	}
+	return rec, nil
+}
+
+func wellFormed(rec walRecord) bool {
+	switch rec.Op {
+	case walPut:
+		return rec.Task != nil
+	case walDelete:
+		return true
+	case walBatch:
+		for _, r := range rec.Records {
+			if r.Op == walBatch || !wellFormed(r) {
+				return false
+			}
+		}
+		return len(rec.Records) > 0
+	}
+	return false
+}
+
+// persist makes a mutation durable before it is applied in memory, then
+// publishes its event. Callers hold s.mu. While an atomic batch is open the
+// record and event are only queued.
+func (s *InMemoryTaskService) persist(rec walRecord) error {
+	ev := s.event(rec)
+	if s.pending != nil {
+		s.pending = append(s.pending, rec)
+		s.pendingEvents = append(s.pendingEvents, ev)
+		return nil
+	}
+	if err := s.writeLog(rec); err != nil {
+		return err
+	}
+	s.events.Publish(ev)
+	return nil
+}
+
+// event describes the change rec is about to make.
+func (s *InMemoryTaskService) event(rec walRecord) TaskEvent {
+	if rec.Op == walDelete {
+		return TaskEvent{Type: EventDeleted, Task: s.tasks[rec.ID]}
+	}
+	if prev, ok := s.tasks[rec.ID]; ok {
+		return TaskEvent{Type: EventUpdated, Task: *rec.Task, Before: &prev}
+	}
+	return TaskEvent{Type: EventCreated, Task: *rec.Task}
+}
+
+// writeLog appends rec to the log. It is a no-op for a purely in-memory
+// service.
+func (s *InMemoryTaskService) writeLog(rec walRecord) error {
+	if s.wal == nil {
+		return nil
+	}
+	line, err := encodeWALLine(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := s.wal.f.Write(line); err != nil {
+		return err
+	}
+	if err := s.wal.f.Sync(); err != nil {
+		return err
+	}
+	s.wal.records++
+	return nil
+}
+
+// maybeCompact folds the log into a snapshot once enough records have piled
+// up. Callers hold s.mu and have already applied the latest mutation. The
+// snapshot is written and synced before the log is emptied, so a crash at any
+// point leaves a recoverable pair. A failed compaction leaves the log intact
+// and is retried on the next write, so it is only logged.
+func (s *InMemoryTaskService) maybeCompact(ctx context.Context) {
+	if s.wal == nil || s.wal.records < s.wal.compactEvery {
+		return
+	}
+	if err := s.compact(); err != nil {
+		slog.ErrorContext(ctx, "compacting task log", "dir", s.wal.dir, "error", err)
+	}
+}
+
+func (s *InMemoryTaskService) compact() error {
+	snap := snapshot{Seq: s.seq, Tasks: make([]models.Task, 0, len(s.tasks))}
+	for _, t := range s.tasks {
+		snap.Tasks = append(snap.Tasks, t)
+	}
+	raw, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(s.wal.dir, snapshotFile, raw); err != nil {
+		return err
+	}
+
+	if err := s.wal.f.Truncate(0); err != nil {
+		return err
+	}
+	if err := s.wal.f.Sync(); err != nil {
+		return err
+	}
+	s.wal.records = 0
+	return nil
+}
+
+// writeFileAtomic replaces dir/name with raw so that a crash leaves either
+// the old file or the new one.
+func writeFileAtomic(dir, name string, raw []byte) error {
+	path := filepath.Join(dir, name)
+	tmp, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
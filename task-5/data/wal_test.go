@@ -0,0 +1,204 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"task_manager/models"
+)
+
+func newTask(t *testing.T, s *InMemoryTaskService, title string) models.Task {
+	t.Helper()
+	task, err := s.Create(context.Background(), models.CreateTaskDTO{
+		Title:   title,
+		DueDate: "2025-12-31T23:59:59Z",
+		Status:  models.StatusPending,
+	})
+	if err != nil {
+		t.Fatalf("create %q: %v", title, err)
+	}
+	return task
+}
+
+func idOf(task models.Task) string { return strconv.FormatInt(task.ID, 10) }
+
+func reopen(t *testing.T, s *InMemoryTaskService, dir string, compactEvery int) *InMemoryTaskService {
+	t.Helper()
+	if s != nil {
+		if err := s.Close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+	}
+	s, err := NewDurableTaskService(dir, compactEvery)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestDurableServiceRecoversTasksAndSeq(t *testing.T) {
+	dir := t.TempDir()
+	s := reopen(t, nil, dir, 0)
+
+	newTask(t, s, "one")
+	two := newTask(t, s, "two")
+	three := newTask(t, s, "three")
+	title := "two, renamed"
+	if _, err := s.Update(context.Background(), idOf(two), models.UpdateTaskDTO{Title: &title}, AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(context.Background(), idOf(three), AnyVersion, false); err != nil {
+		t.Fatal(err)
+	}
+
+	s = reopen(t, s, dir, 0)
+
+	got, err := s.Get(context.Background(), idOf(two))
+	if err != nil || got.Title != title {
+		t.Fatalf("task two after recovery = %+v, %v", got, err)
+	}
+	if _, err := s.Get(context.Background(), idOf(three)); err != ErrNotFound {
+		t.Fatalf("deleted task came back: %v", err)
+	}
+	// The deleted task's ID must not be handed out again.
+	if four := newTask(t, s, "four"); four.ID != three.ID+1 {
+		t.Fatalf("next ID = %d, want %d", four.ID, three.ID+1)
+	}
+}
+
+func TestDurableServiceToleratesTruncatedTail(t *testing.T) {
+	dir := t.TempDir()
+	s := reopen(t, nil, dir, 0)
+	newTask(t, s, "kept")
+	newTask(t, s, "torn")
+	s.Close()
+
+	path := filepath.Join(dir, walFile)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Chop the last record in half, as a crash mid-write would.
+	if err := os.WriteFile(path, raw[:len(raw)-20], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s = reopen(t, nil, dir, 0)
+	page, err := s.List(context.Background(), models.TaskQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 || page.Data[0].Title != "kept" {
+		t.Fatalf("recovered %+v, want only the intact task", page.Data)
+	}
+
+	// New writes must land on a clean line and survive another restart.
+	next := newTask(t, s, "after crash")
+	if next.ID != 2 {
+		t.Fatalf("next ID = %d, want 2", next.ID)
+	}
+	s = reopen(t, s, dir, 0)
+	if _, err := s.Get(context.Background(), idOf(next)); err != nil {
+		t.Fatalf("task written after recovery lost: %v", err)
+	}
+}
+
+func TestDurableServiceRejectsCorruptionBeforeTail(t *testing.T) {
+	dir := t.TempDir()
+	s := reopen(t, nil, dir, 0)
+	newTask(t, s, "one")
+	newTask(t, s, "two")
+	s.Close()
+
+	path := filepath.Join(dir, walFile)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw[12] ^= 0xff // flip a byte inside the first record
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewDurableTaskService(dir, 0); err == nil {
+		t.Fatal("expected an error for a corrupted record followed by valid ones")
+	}
+}
+
+func TestDurableServiceCompactsIntoSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	s := reopen(t, nil, dir, 3)
+
+	var last models.Task
+	for _, title := range []string{"a", "b", "c", "d"} {
+		last = newTask(t, s, title)
+	}
+	if err := s.Delete(context.Background(), idOf(last), AnyVersion, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, snapshotFile)); err != nil {
+		t.Fatalf("no snapshot written: %v", err)
+	}
+	if s.wal.records != 2 {
+		t.Fatalf("log holds %d records after compaction, want 2", s.wal.records)
+	}
+
+	s = reopen(t, s, dir, 3)
+	page, err := s.List(context.Background(), models.TaskQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 3 {
+		t.Fatalf("recovered %d tasks, want 3", page.Total)
+	}
+	if next := newTask(t, s, "e"); next.ID != last.ID+1 {
+		t.Fatalf("next ID = %d, want %d", next.ID, last.ID+1)
+	}
+}
+
+func TestDurableServiceBatchIsAllOrNothing(t *testing.T) {
+	dir := t.TempDir()
+	s := reopen(t, nil, dir, 0)
+	kept := newTask(t, s, "kept")
+
+	create := BatchOp{Op: models.BatchCreate, Create: models.CreateTaskDTO{
+		Title:   "batched",
+		DueDate: "2025-12-31T23:59:59Z",
+		Status:  models.StatusPending,
+	}}
+	missing := BatchOp{Op: models.BatchDelete, ID: "99", Version: AnyVersion}
+	_, err := s.Batch(context.Background(), []BatchOp{create, missing}, true)
+	var failed *BatchError
+	if !errors.As(err, &failed) || failed.Index != 1 || !errors.Is(err, ErrNotFound) {
+		t.Fatalf("failed batch = %v, want operations[1] not found", err)
+	}
+	if page, _ := s.List(context.Background(), models.TaskQuery{}); page.Total != 1 {
+		t.Fatalf("failed batch left %d tasks, want 1", page.Total)
+	}
+
+	remove := BatchOp{Op: models.BatchDelete, ID: idOf(kept), Version: AnyVersion}
+	if _, err := s.Batch(context.Background(), []BatchOp{create, create, remove}, true); err != nil {
+		t.Fatal(err)
+	}
+	if s.wal.records != 2 {
+		t.Fatalf("log holds %d records, want the batch as one", s.wal.records)
+	}
+
+	s = reopen(t, s, dir, 0)
+	page, err := s.List(context.Background(), models.TaskQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 || page.Data[0].Title != "batched" {
+		t.Fatalf("recovered %+v, want the two batched tasks", page.Data)
+	}
+	if next := newTask(t, s, "after"); next.ID != 4 {
+		t.Fatalf("next ID = %d, want 4", next.ID)
+	}
+}
@@ -0,0 +1,249 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"task_manager/models"
+)
+
+const (
+	// WebhookMaxAttempts is how often a delivery is tried before it is
+	// marked failed.
+	WebhookMaxAttempts = 8
+
+	webhookRetryBase = 10 * time.Second // doubled after every failed attempt
+	webhookRetryMax  = time.Hour
+	webhookTimeout   = 10 * time.Second
+	webhookPoll      = 5 * time.Second
+	webhookLease     = time.Minute // a claimed delivery is due again after this
+	webhookWorkers   = 4
+	webhookLogBody   = 512 // bytes of each response kept in the log
+)
+
+// webhookPayload is the body POSTed to a webhook.
+type webhookPayload struct {
+	Event      string      `json:"event"`
+	EventID    string      `json:"event_id"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Task       models.Task `json:"task"`
+}
+
+// WebhookDispatcher turns task events into deliveries and sends them in
+// the background, so no request waits on a receiver.
+type WebhookDispatcher struct {
+	store  WebhookRepository
+	hub    *EventHub
+	client *http.Client
+	wake   chan struct{}
+}
+
+func NewWebhookDispatcher(store WebhookRepository, hub *EventHub) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		store:  store,
+		hub:    hub,
+		client: &http.Client{Timeout: webhookTimeout},
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Start queues a delivery for every event a webhook wants and sends
+// whatever is due, in the background until ctx is done. Events published
+// once Start returns are not missed.
+func (d *WebhookDispatcher) Start(ctx context.Context) {
+	go d.listen(ctx, d.hub.Subscribe(""))
+	go d.run(ctx)
+}
+
+func (d *WebhookDispatcher) run(ctx context.Context) {
+	tick := time.NewTicker(webhookPoll)
+	defer tick.Stop()
+	sem := make(chan struct{}, webhookWorkers)
+	for {
+		d.drain(ctx, sem)
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// listen turns the events on sub into deliveries.
+func (d *WebhookDispatcher) listen(ctx context.Context, sub *Subscription) {
+	last := ""
+	for {
+		select {
+		case <-ctx.Done():
+			sub.Close()
+			return
+		case ev, ok := <-sub.C:
+			if ok {
+				d.enqueue(ctx, ev)
+				last = ev.ID
+				continue
+			}
+			// Cut off for falling behind: catch up from the replay buffer.
+			sub = d.hub.Subscribe(last)
+			if sub.Missed {
+				slog.WarnContext(ctx, "webhooks missed task events", "after", last)
+			}
+			for _, ev := range sub.Replay {
+				d.enqueue(ctx, ev)
+				last = ev.ID
+			}
+		}
+	}
+}
+
+// enqueue records a pending delivery of ev for each webhook that wants it.
+func (d *WebhookDispatcher) enqueue(ctx context.Context, ev TaskEvent) {
+	hooks, err := d.store.ListWebhooks(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "loading webhooks", "error", err)
+		return
+	}
+	event := "task." + string(ev.Type)
+	now := time.Now().UTC()
+	var payload []byte
+	for _, h := range hooks {
+		if !wants(h, event) {
+			continue
+		}
+		if payload == nil {
+			payload, _ = json.Marshal(webhookPayload{Event: event, EventID: ev.ID, OccurredAt: now, Task: ev.Task})
+		}
+		dl := models.WebhookDelivery{
+			WebhookID: h.ID, Event: event, Payload: payload, Status: models.DeliveryPending,
+			NextAttempt: &now, Attempts: []models.DeliveryAttempt{}, CreatedAt: now, UpdatedAt: now,
+		}
+		if err := d.store.AddDelivery(ctx, dl); err != nil {
+			slog.WarnContext(ctx, "queueing webhook delivery", "error", err)
+		}
+	}
+	if payload != nil {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// drain sends the due deliveries, up to one per slot in sem at a time. Each
+// is claimed in the store before it is sent, so another server sharing the
+// store skips it, and it comes due again if this one stops mid-send.
+func (d *WebhookDispatcher) drain(ctx context.Context, sem chan struct{}) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sem <- struct{}{}:
+		}
+		now := time.Now().UTC()
+		dl, err := d.store.ClaimDelivery(ctx, now, now.Add(webhookLease))
+		if err != nil {
+			<-sem
+			if !errors.Is(err, ErrDeliveryNotFound) {
+				slog.WarnContext(ctx, "claiming webhook delivery", "error", err)
+			}
+			return
+		}
+		go func() {
+			defer func() { <-sem }()
+			d.send(ctx, dl)
+		}()
+	}
+}
+
+// send makes one attempt at dl and records the outcome: succeeded on a 2xx
+// answer, otherwise another try after a backoff, or failed once
+// WebhookMaxAttempts is reached.
+func (d *WebhookDispatcher) send(ctx context.Context, dl models.WebhookDelivery) {
+	hook, err := d.store.GetWebhook(ctx, strconv.FormatInt(dl.WebhookID, 10))
+	if errors.Is(err, ErrWebhookNotFound) {
+		return // deleted along with its deliveries
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "loading webhook", "webhook_id", dl.WebhookID, "error", err)
+		return
+	}
+
+	attempt := d.post(ctx, hook, dl)
+	now := time.Now().UTC()
+	dl.Attempts = append(dl.Attempts, attempt)
+	dl.Tries++
+	dl.UpdatedAt = now
+	switch {
+	case attempt.StatusCode >= 200 && attempt.StatusCode < 300:
+		dl.Status = models.DeliverySucceeded
+		dl.NextAttempt = nil
+	case dl.Tries >= WebhookMaxAttempts:
+		dl.Status = models.DeliveryFailed
+		dl.NextAttempt = nil
+		slog.WarnContext(ctx, "webhook delivery failed", "webhook_id", dl.WebhookID, "delivery_id", dl.ID, "attempts", dl.Tries)
+	default:
+		next := now.Add(retryDelay(dl.Tries))
+		dl.NextAttempt = &next
+	}
+	if err := d.store.SaveDelivery(ctx, dl); err != nil && !errors.Is(err, ErrDeliveryNotFound) {
+		slog.WarnContext(ctx, "saving webhook delivery", "delivery_id", dl.ID, "error", err)
+	}
+}
+
+// post sends the payload, signed with the webhook's secret.
+func (d *WebhookDispatcher) post(ctx context.Context, hook models.Webhook, dl models.WebhookDelivery) (attempt models.DeliveryAttempt) {
+	start := time.Now().UTC()
+	attempt.At = start
+	defer func() { attempt.DurationMS = time.Since(start).Milliseconds() }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(dl.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "task-manager-webhooks")
+	req.Header.Set("X-Webhook-Event", dl.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(dl.ID, 10))
+	req.Header.Set("X-Webhook-Signature", "sha256="+sign(hook.Secret, dl.Payload))
+	res, err := d.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(res.Body, webhookLogBody))
+	attempt.StatusCode = res.StatusCode
+	attempt.Response = string(body)
+	return attempt
+}
+
+// sign is the hex HMAC-SHA256 of payload under secret.
+func sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryDelay is the wait after the given number of failed tries, doubling
+// each time up to webhookRetryMax, with up to 10% jitter so receivers that
+// come back are not hit all at once.
+func retryDelay(tries int) time.Duration {
+	delay := webhookRetryMax
+	if tries < 20 {
+		delay = min(webhookRetryBase<<(tries-1), webhookRetryMax)
+	}
+	return delay + rand.N(delay/10)
+}
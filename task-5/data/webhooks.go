@@ -0,0 +1,331 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"task_manager/models"
+)
+
+var (
+	ErrWebhookNotFound     = errors.New("webhook not found")
+	ErrDeliveryNotFound    = errors.New("delivery not found")
+	ErrInvalidWebhookURL   = errors.New("invalid webhook url (use an absolute http or https URL)")
+	ErrInvalidWebhookEvent = errors.New("invalid webhook event (use: task.created | task.updated | task.deleted)")
+)
+
+const webhooksFile = "webhooks.json"
+
+// deliveryLogSize is how many finished deliveries are kept per webhook.
+const deliveryLogSize = 1000
+
+// WebhookRepository stores webhook subscriptions and the log of their
+// deliveries. IDs are opaque strings, as in TaskRepository.
+//
+// Deleting a webhook drops its deliveries. ClaimDelivery takes the pending
+// delivery whose next attempt has been due by now the longest and, in the
+// same step, moves that attempt to until, so no one else takes it meanwhile;
+// it returns ErrDeliveryNotFound when nothing is due. Redeliver puts a
+// delivery back in that queue with a fresh set of attempts.
+type WebhookRepository interface {
+	ListWebhooks(ctx context.Context) ([]models.Webhook, error)
+	GetWebhook(ctx context.Context, id string) (models.Webhook, error)
+	CreateWebhook(ctx context.Context, dto models.WebhookDTO) (models.Webhook, error)
+	UpdateWebhook(ctx context.Context, id string, dto models.WebhookDTO) (models.Webhook, error)
+	DeleteWebhook(ctx context.Context, id string) error
+
+	AddDelivery(ctx context.Context, d models.WebhookDelivery) error
+	SaveDelivery(ctx context.Context, d models.WebhookDelivery) error
+	ClaimDelivery(ctx context.Context, now, until time.Time) (models.WebhookDelivery, error)
+	Deliveries(ctx context.Context, webhookID string, status models.DeliveryStatus) ([]models.WebhookDelivery, error)
+	Redeliver(ctx context.Context, webhookID, id string) (models.WebhookDelivery, error)
+}
+
+var _ WebhookRepository = (*InMemoryWebhookService)(nil)
+
+// applyWebhookDTO checks dto and copies it onto w.
+func applyWebhookDTO(w *models.Webhook, dto models.WebhookDTO) error {
+	u, err := url.Parse(dto.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidWebhookURL
+	}
+	for _, e := range dto.Events {
+		if !models.IsValidWebhookEvent(e) {
+			return ErrInvalidWebhookEvent
+		}
+	}
+	w.URL = dto.URL
+	w.Events = slices.Compact(slices.Sorted(slices.Values(dto.Events)))
+	switch {
+	case dto.Secret != "":
+		w.Secret = dto.Secret
+	case w.Secret == "":
+		w.Secret = rand.Text()
+	}
+	w.Active = dto.Active == nil || *dto.Active
+	return nil
+}
+
+// wants reports whether w is subscribed to event.
+func wants(w models.Webhook, event string) bool {
+	return w.Active && (len(w.Events) == 0 || slices.Contains(w.Events, event))
+}
+
+// InMemoryWebhookService keeps webhooks and deliveries in memory. When
+// created with NewDurableWebhookService the webhooks, though not the
+// delivery log, are also saved to a file.
+type InMemoryWebhookService struct {
+	mu         sync.Mutex
+	seq        int64
+	hooks      map[int64]models.Webhook
+	dseq       int64
+	deliveries map[int64]models.WebhookDelivery
+	dir        string // "" when nothing is saved
+}
+
+type webhookFile struct {
+	Seq      int64            `json:"seq"`
+	Webhooks []models.Webhook `json:"webhooks"`
+}
+
+func NewInMemoryWebhookService() *InMemoryWebhookService {
+	return &InMemoryWebhookService{
+		hooks:      make(map[int64]models.Webhook),
+		deliveries: make(map[int64]models.WebhookDelivery),
+	}
+}
+
+// NewDurableWebhookService opens (or creates) a webhook store saved in dir,
+// next to the task log.
+func NewDurableWebhookService(dir string) (*InMemoryWebhookService, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := NewInMemoryWebhookService()
+	s.dir = dir
+	raw, err := os.ReadFile(filepath.Join(dir, webhooksFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file webhookFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("read webhooks: %w", err)
+	}
+	s.seq = file.Seq
+	for _, w := range file.Webhooks {
+		s.hooks[w.ID] = w
+	}
+	return s, nil
+}
+
+// save writes every webhook out; the caller holds the lock.
+func (s *InMemoryWebhookService) save() error {
+	if s.dir == "" {
+		return nil
+	}
+	raw, err := json.Marshal(webhookFile{Seq: s.seq, Webhooks: slices.Collect(maps.Values(s.hooks))})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.dir, webhooksFile, raw)
+}
+
+func (s *InMemoryWebhookService) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := slices.Collect(maps.Values(s.hooks))
+	slices.SortFunc(out, func(a, b models.Webhook) int { return cmp.Compare(a.ID, b.ID) })
+	return out, nil
+}
+
+func (s *InMemoryWebhookService) GetWebhook(ctx context.Context, id string) (models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := parseID(id)
+	w, found := s.hooks[n]
+	if !ok || !found {
+		return models.Webhook{}, ErrWebhookNotFound
+	}
+	return w, nil
+}
+
+func (s *InMemoryWebhookService) CreateWebhook(ctx context.Context, dto models.WebhookDTO) (models.Webhook, error) {
+	var w models.Webhook
+	if err := applyWebhookDTO(&w, dto); err != nil {
+		return models.Webhook{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	w.ID = s.seq
+	w.CreatedAt = time.Now().UTC()
+	w.UpdatedAt = w.CreatedAt
+	s.hooks[w.ID] = w
+	if err := s.save(); err != nil {
+		delete(s.hooks, w.ID)
+		return models.Webhook{}, err
+	}
+	return w, nil
+}
+
+func (s *InMemoryWebhookService) UpdateWebhook(ctx context.Context, id string, dto models.WebhookDTO) (models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := parseID(id)
+	old, found := s.hooks[n]
+	if !ok || !found {
+		return models.Webhook{}, ErrWebhookNotFound
+	}
+	w := old
+	if err := applyWebhookDTO(&w, dto); err != nil {
+		return models.Webhook{}, err
+	}
+	w.UpdatedAt = time.Now().UTC()
+	s.hooks[n] = w
+	if err := s.save(); err != nil {
+		s.hooks[n] = old
+		return models.Webhook{}, err
+	}
+	return w, nil
+}
+
+func (s *InMemoryWebhookService) DeleteWebhook(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := parseID(id)
+	old, found := s.hooks[n]
+	if !ok || !found {
+		return ErrWebhookNotFound
+	}
+	delete(s.hooks, n)
+	if err := s.save(); err != nil {
+		s.hooks[n] = old
+		return err
+	}
+	for did, d := range s.deliveries {
+		if d.WebhookID == n {
+			delete(s.deliveries, did)
+		}
+	}
+	return nil
+}
+
+func (s *InMemoryWebhookService) AddDelivery(ctx context.Context, d models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dseq++
+	d.ID = s.dseq
+	s.deliveries[d.ID] = d
+	return nil
+}
+
+func (s *InMemoryWebhookService) SaveDelivery(ctx context.Context, d models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.deliveries[d.ID]; !ok {
+		return ErrDeliveryNotFound
+	}
+	s.deliveries[d.ID] = d
+	if d.Status != models.DeliveryPending {
+		s.trimLog(d.WebhookID)
+	}
+	return nil
+}
+
+// trimLog drops the oldest finished deliveries of a webhook beyond
+// deliveryLogSize.
+func (s *InMemoryWebhookService) trimLog(webhookID int64) {
+	var done []int64
+	for id, d := range s.deliveries {
+		if d.WebhookID == webhookID && d.Status != models.DeliveryPending {
+			done = append(done, id)
+		}
+	}
+	if len(done) <= deliveryLogSize {
+		return
+	}
+	slices.Sort(done)
+	for _, id := range done[:len(done)-deliveryLogSize] {
+		delete(s.deliveries, id)
+	}
+}
+
+func (s *InMemoryWebhookService) ClaimDelivery(ctx context.Context, now, until time.Time) (models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due *models.WebhookDelivery
+	for _, d := range s.deliveries {
+		if d.Status != models.DeliveryPending || d.NextAttempt == nil || d.NextAttempt.After(now) {
+			continue
+		}
+		if due == nil || cmp.Or(d.NextAttempt.Compare(*due.NextAttempt), cmp.Compare(d.ID, due.ID)) < 0 {
+			due = &d
+		}
+	}
+	if due == nil {
+		return models.WebhookDelivery{}, ErrDeliveryNotFound
+	}
+	due.NextAttempt = &until
+	s.deliveries[due.ID] = *due
+	return cloneDelivery(*due), nil
+}
+
+// Deliveries returns a webhook's deliveries, newest first, optionally only
+// those with status.
+func (s *InMemoryWebhookService) Deliveries(ctx context.Context, webhookID string, status models.DeliveryStatus) ([]models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := parseID(webhookID)
+	if _, found := s.hooks[n]; !ok || !found {
+		return nil, ErrWebhookNotFound
+	}
+	out := []models.WebhookDelivery{}
+	for _, d := range s.deliveries {
+		if d.WebhookID == n && (status == "" || d.Status == status) {
+			out = append(out, cloneDelivery(d))
+		}
+	}
+	slices.SortFunc(out, func(a, b models.WebhookDelivery) int { return cmp.Compare(b.ID, a.ID) })
+	return out, nil
+}
+
+func (s *InMemoryWebhookService) Redeliver(ctx context.Context, webhookID, id string) (models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wid, ok := parseID(webhookID)
+	if _, found := s.hooks[wid]; !ok || !found {
+		return models.WebhookDelivery{}, ErrWebhookNotFound
+	}
+	n, ok := parseID(id)
+	d, found := s.deliveries[n]
+	if !ok || !found || d.WebhookID != wid {
+		return models.WebhookDelivery{}, ErrDeliveryNotFound
+	}
+	now := time.Now().UTC()
+	d.Status = models.DeliveryPending
+	d.Tries = 0
+	d.NextAttempt = &now
+	d.UpdatedAt = now
+	s.deliveries[n] = d
+	return cloneDelivery(d), nil
+}
+
+// cloneDelivery copies the attempt log so callers can append to it.
+func cloneDelivery(d models.WebhookDelivery) models.WebhookDelivery {
+	d.Attempts = slices.Clone(d.Attempts)
+	return d
+}
@@ -0,0 +1,80 @@
+// Package ical writes iCalendar data (RFC 5545): content lines with
+// escaping and line folding. What goes into a calendar is up to the caller.
+package ical
+
+import (
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// lineLimit is the longest content line allowed before folding, in octets.
+const lineLimit = 75
+
+// Writer emits content lines. Errors are sticky: after the first failed
+// write nothing more is written and Err reports it.
+type Writer struct {
+	w   io.Writer
+	err error
+}
+
+func NewWriter(w io.Writer) *Writer { return &Writer{w: w} }
+
+func (w *Writer) Begin(component string) { w.Line("BEGIN", component) }
+
+func (w *Writer) End(component string) { w.Line("END", component) }
+
+// Line writes name:value with value as is. name may carry parameters,
+// e.g. "DTSTART;VALUE=DATE".
+func (w *Writer) Line(name, value string) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = io.WriteString(w.w, fold(name+":"+value))
+}
+
+// Text writes a TEXT value, escaping what RFC 5545 requires.
+func (w *Writer) Text(name, value string) { w.Line(name, Escape(value)) }
+
+// Time writes a DATE-TIME value in UTC.
+func (w *Writer) Time(name string, t time.Time) {
+	w.Line(name, t.UTC().Format("20060102T150405Z"))
+}
+
+// List writes a multi-valued TEXT property such as CATEGORIES.
+func (w *Writer) List(name string, values []string) {
+	escaped := make([]string, len(values))
+	for i, v := range values {
+		escaped[i] = Escape(v)
+	}
+	w.Line(name, strings.Join(escaped, ","))
+}
+
+func (w *Writer) Err() error { return w.err }
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// Escape makes s safe as a TEXT value.
+func Escape(s string) string { return escaper.Replace(s) }
+
+// fold splits a content line into CRLF-terminated pieces of at most
+// lineLimit octets, continuation lines starting with a space. UTF-8
+// sequences are never split.
+func fold(line string) string {
+	var b strings.Builder
+	limit := lineLimit
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = lineLimit - 1 // the leading space counts
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
@@ -0,0 +1,73 @@
+// Package logging sets up structured JSON logging with log/slog and carries
+// request IDs through contexts, so every line logged while serving a
+// request, down to the data services, names the request it belongs to.
+package logging
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx that carries id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID ctx carries, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Setup makes a JSON logger on stderr the default for slog and for the log
+// package, and sends Gin's debug output through it. LOG_LEVEL sets the
+// lowest level written: debug, info (the default), warn or error.
+func Setup() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cmp.Or(os.Getenv("LOG_LEVEL"), "info"))); err != nil {
+		return fmt.Errorf("LOG_LEVEL: %w", err)
+	}
+	slog.SetDefault(slog.New(NewHandler(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level}))))
+
+	gin.DebugPrintRouteFunc = func(method, path, handler string, handlers int) {
+		slog.Debug("route", "method", method, "path", path, "handler", handler)
+	}
+	gin.DebugPrintFunc = func(format string, values ...any) {
+		msg := strings.TrimSpace(fmt.Sprintf(format, values...))
+		if rest, ok := strings.CutPrefix(msg, "[WARNING] "); ok {
+			slog.Warn(rest)
+			return
+		}
+		slog.Debug(msg)
+	}
+	return nil
+}
+
+// NewHandler wraps h so records logged with a context carrying a request
+// ID get a request_id attribute.
+func NewHandler(h slog.Handler) slog.Handler { return contextHandler{h} }
+
+type contextHandler struct{ slog.Handler }
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
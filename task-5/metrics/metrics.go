@@ -0,0 +1,132 @@
+// Package metrics exposes the server's metrics in the Prometheus text
+// format. Labels only take values from bounded sets (methods, route templates,
+// status codes and workflow statuses), so the number of series doesn't grow
+// with traffic.
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"task_manager/models"
+)
+
+// unmatched labels requests that match no route, so unknown paths share one
+// series.
+const unmatched = "unmatched"
+
+// otherMethod labels requests whose method isn't one of HTTP's own, since
+// clients may send any token there.
+const otherMethod = "other"
+
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return method
+	}
+	return otherMethod
+}
+
+// Metrics holds the collectors of one server. Each has its own registry,
+// so building a second router, as tests do, doesn't clash with the first.
+type Metrics struct {
+	reg      *prometheus.Registry
+	requests *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	inFlight prometheus.Gauge
+}
+
+// New registers the HTTP collectors along with the Go runtime and process
+// ones.
+func New() *Metrics {
+	m := &Metrics{
+		reg: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests served, by method, route template and status.",
+		}, []string{"method", "route", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Time taken to serve HTTP requests, by method, route template and status.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "HTTP requests being served, including open event streams.",
+		}),
+	}
+	m.reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.latency, m.inFlight,
+	)
+	return m
+}
+
+// Middleware counts and times every request once it has been served.
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatched
+		}
+		method, status := methodLabel(c.Request.Method), strconv.Itoa(c.Writer.Status())
+		m.requests.WithLabelValues(method, route, status).Inc()
+		m.latency.WithLabelValues(method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(m.reg, promhttp.HandlerOpts{}))
+}
+
+// TaskCounter counts tasks by status; data.TaskRepository implements it.
+type TaskCounter interface {
+	CountByStatus(ctx context.Context) (map[models.TaskStatus]int64, error)
+}
+
+// WatchTasks adds a gauge of the tasks in each status of the workflow,
+// counted by tc on every scrape.
+func (m *Metrics) WatchTasks(tc TaskCounter) {
+	m.reg.MustRegister(taskCollector{tc})
+}
+
+var tasksDesc = prometheus.NewDesc("tasks", "Stored tasks, by workflow status.", []string{"status"}, nil)
+
+// countTimeout bounds the count made for a scrape.
+const countTimeout = 5 * time.Second
+
+type taskCollector struct{ tc TaskCounter }
+
+func (t taskCollector) Describe(ch chan<- *prometheus.Desc) { ch <- tasksDesc }
+
+// Collect reports every status of the workflow, zero when no task has it.
+// When counting fails the gauge is left out of the scrape rather than
+// failing it.
+func (t taskCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), countTimeout)
+	defer cancel()
+	counts, err := t.tc.CountByStatus(ctx)
+	if err != nil {
+		slog.Warn("counting tasks for metrics", "error", err)
+		return
+	}
+	for _, st := range models.CurrentWorkflow().Names() {
+		ch <- prometheus.MustNewConstMetric(tasksDesc, prometheus.GaugeValue, float64(counts[st]), string(st))
+	}
+}
@@ -0,0 +1,45 @@
+package models
+
+import "encoding/json"
+
+// MaxBatchSize caps the operations in one POST /tasks/batch.
+const MaxBatchSize = 500
+
+type BatchMode string
+
+const (
+	BatchAtomic     BatchMode = "atomic"      // all operations apply or none do
+	BatchBestEffort BatchMode = "best_effort" // each operation stands alone
+)
+
+// Batch operation kinds.
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+// BatchRequest is the body of POST /tasks/batch.
+type BatchRequest struct {
+	Mode       BatchMode        `json:"mode"` // optional, defaults to atomic
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BatchOperation is one write in a batch. Task holds a CreateTaskDTO for a
+// create and an UpdateTaskDTO for an update; deletes take none.
+type BatchOperation struct {
+	Op      string          `json:"op"`
+	ID      int64           `json:"id"`      // update and delete
+	Version *int64          `json:"version"` // optional, checked like If-Match
+	Cascade bool            `json:"cascade"` // delete only
+	Task    json.RawMessage `json:"task"`
+}
+
+// BatchResult reports one operation. Status is what the single-task
+// endpoint would have answered.
+type BatchResult struct {
+	Index  int    `json:"index"`
+	Status int    `json:"status"`
+	Data   *Task  `json:"data,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
@@ -10,37 +10,130 @@ const (
 	StatusDone        TaskStatus = "done"
 )
 
-func IsValidStatus(s TaskStatus) bool {
-	switch s {
-	case StatusPending, StatusInProgress, StatusDone:
-		return true
-	default:
-		return false
-	}
-}
+// The constants above are the default workflow; see workflow.go for others.
 
 type Task struct {
-	ID          int64      `json:"id"`
-	Title       string     `json:"title"`
-	Description string     `json:"description"`
-	DueDate     time.Time  `json:"due_date"` // RFC3339 in/out
-	Status      TaskStatus `json:"status"`
+	ID          int64        `json:"id"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	DueDate     time.Time    `json:"due_date"` // RFC3339 in/out
+	Status      TaskStatus   `json:"status"`
+	ParentID    int64        `json:"parent_id,omitempty"`  // 0 for a top-level task
+	BlockedBy   []int64      `json:"blocked_by,omitempty"` // tasks that must be done first
+	Priority    TaskPriority `json:"priority"`
+	Labels      []string     `json:"labels,omitempty"`
+	Assignee    string       `json:"assignee,omitempty"` // user name
+	Recurrence  string       `json:"recurrence,omitempty"`
+	TimeZone    string       `json:"time_zone,omitempty"`
+	SeriesID    int64        `json:"series_id,omitempty"`    // first task of the series
+	SeriesStart *time.Time   `json:"series_start,omitempty"` // where the rule starts counting
+	Version     int64        `json:"version"`                // bumped on every change; served as the ETag
 
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+type TaskPriority string
+
+const (
+	PriorityLow    TaskPriority = "low"
+	PriorityMedium TaskPriority = "medium"
+	PriorityHigh   TaskPriority = "high"
+	PriorityUrgent TaskPriority = "urgent"
+
+	DefaultPriority = PriorityMedium
+)
+
+func IsValidPriority(p TaskPriority) bool {
+	switch p {
+	case PriorityLow, PriorityMedium, PriorityHigh, PriorityUrgent:
+		return true
+	default:
+		return false
+	}
+}
+
 // Payloads used for create/update (to validate input cleanly)
 type CreateTaskDTO struct {
-	Title       string     `json:"title" binding:"required"`
-	Description string     `json:"description"`
-	DueDate     string     `json:"due_date" binding:"required"` // RFC3339 string
-	Status      TaskStatus `json:"status" binding:"required"`
+	Title       string       `json:"title" binding:"required"`
+	Description string       `json:"description"`
+	DueDate     string       `json:"due_date" binding:"required"` // RFC3339 string
+	Status      TaskStatus   `json:"status" binding:"required"`
+	ParentID    int64        `json:"parent_id"`  // optional
+	BlockedBy   []int64      `json:"blocked_by"` // optional
+	Priority    TaskPriority `json:"priority"`   // optional, defaults to medium
+	Labels      []string     `json:"labels"`     // optional
+	Assignee    string       `json:"assignee"`   // optional
+	Recurrence  string       `json:"recurrence"` // optional RRULE, e.g. FREQ=WEEKLY;BYDAY=MO
+	TimeZone    string       `json:"time_zone"`  // optional IANA zone the rule runs in, defaults to UTC
 }
 
 type UpdateTaskDTO struct {
-	Title       *string     `json:"title"`       // optional
-	Description *string     `json:"description"` // optional
-	DueDate     *string     `json:"due_date"`    // optional, RFC3339
-	Status      *TaskStatus `json:"status"`      // optional
+	Title       *string       `json:"title"`       // optional
+	Description *string       `json:"description"` // optional
+	DueDate     *string       `json:"due_date"`    // optional, RFC3339
+	Status      *TaskStatus   `json:"status"`      // optional
+	ParentID    *int64        `json:"parent_id"`   // optional, 0 detaches from the parent
+	BlockedBy   *[]int64      `json:"blocked_by"`  // optional, replaces the whole set
+	Priority    *TaskPriority `json:"priority"`    // optional
+	Labels      *[]string     `json:"labels"`      // optional, replaces the whole set
+	Assignee    *string       `json:"assignee"`    // optional, "" unassigns
+	Recurrence  *string       `json:"recurrence"`  // optional, "" ends the series
+	TimeZone    *string       `json:"time_zone"`   // optional
+}
+
+// TaskNode is a task with its subtasks nested under it. RollupStatus sums up
+// the whole subtree: done only when every task in it is done.
+type TaskNode struct {
+	Task
+	RollupStatus TaskStatus `json:"rollup_status"`
+	Children     []TaskNode `json:"children"`
+}
+
+// Fields GET /tasks can sort on, by their JSON name.
+var SortableFields = map[string]bool{
+	"id":          true,
+	"title":       true,
+	"description": true,
+	"due_date":    true,
+	"status":      true,
+	"created_at":  true,
+	"updated_at":  true,
+}
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 500
+)
+
+// TaskQuery narrows, orders and pages a task listing. Zero values mean "no
+// filter"; time bounds are inclusive.
+type TaskQuery struct {
+	Statuses    []TaskStatus
+	Title       string // case-insensitive substring
+	DueFrom     *time.Time
+	DueTo       *time.Time
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	UpdatedFrom *time.Time
+	UpdatedTo   *time.Time
+	Priorities  []TaskPriority
+	Labels      []string // tasks must carry all of them
+	Assignee    string
+
+	SortBy   string // one of SortableFields; defaults to "id"
+	SortDesc bool
+
+	Limit  int
+	Offset int
+	Cursor string // opaque, from a previous page's next_cursor
+}
+
+// TaskPage is the response envelope for GET /tasks.
+type TaskPage struct {
+	Data       []Task `json:"data"`
+	Total      int64  `json:"total"`
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	NextCursor string `json:"next_cursor,omitempty"`
 }
@@ -0,0 +1,20 @@
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uiPage is a self-contained docs page: it loads the document from
+// openapi.json next to it and lets readers try each operation.
+//
+//go:embed ui.html
+var uiPage []byte
+
+// UI serves the docs page. Mount it next to the document, e.g. at /docs
+// for /openapi.json.
+func UI(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", uiPage)
+}
@@ -1,36 +1,163 @@
 package router
 
 import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"task_manager/controllers"
 	"task_manager/data"
+	"task_manager/metrics"
+	"task_manager/middleware"
+	"task_manager/models"
 )
 
 func Setup() *gin.Engine {
-	r := gin.Default()
-
-	// Simple CORS for local testing; adjust as needed
-	r.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-		c.Next()
-	})
+	m := metrics.New()
+	r := gin.New()
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		fatal("TRUSTED_PROXIES", err)
+	}
+	r.Use(middleware.RequestID(), middleware.AccessLog(), m.Middleware(), middleware.Recovery())
+
+	cors, err := middleware.CORS(corsConfig([]string{"*"}))
+	if err != nil {
+		fatal("CORS", err)
+	}
+	r.Use(cors)
 
-	api := r.Group("/")
+	// Task and webhook routes share one budget per client IP.
+	limiter := middleware.NewRateLimiter(middleware.NewMemoryRateStore())
+	limiter.Limits["api"] = rateLimit("RATE_LIMIT_API", "300/1m")
+	api := r.Group("/", limiter.Limit("api", middleware.ByIP))
 
+	// TASK_DATA_DIR turns on the write-ahead log and saves webhooks next to
+	// it; without it everything lives in memory only.
+	loadWorkflow()
 	taskService := data.NewInMemoryTaskService()
+	webhookService := data.NewInMemoryWebhookService()
+	if dir := os.Getenv("TASK_DATA_DIR"); dir != "" {
+		durable, err := data.NewDurableTaskService(dir, 0)
+		if err != nil {
+			fatal("open task store", err)
+		}
+		if err := durable.MigrateStatuses(context.Background()); err != nil {
+			fatal("migrate task statuses", err)
+		}
+		taskService = durable
+		if webhookService, err = data.NewDurableWebhookService(dir); err != nil {
+			fatal("open webhook store", err)
+		}
+	}
+	m.WatchTasks(taskService)
+	startScheduler(taskService)
+	data.NewWebhookDispatcher(webhookService, taskService.Events()).Start(context.Background())
 	taskController := controllers.NewTaskController(taskService)
 	taskController.Register(api)
+	controllers.NewWebhookController(webhookService).Register(api)
 
 	// Health endpoint (handy in Postman)
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
+	r.GET("/metrics", m.Handler())
+
+	// API docs, built from the routes above; keep this last.
+	controllers.RegisterDocs(r)
 
 	return r
 }
+
+// loadWorkflow swaps in the workflow from the JSON file named by
+// TASK_WORKFLOW; without it tasks use pending, in_progress and done.
+func loadWorkflow() {
+	path := os.Getenv("TASK_WORKFLOW")
+	if path == "" {
+		return
+	}
+	w, err := models.LoadWorkflow(path)
+	if err != nil {
+		fatal("load workflow", err)
+	}
+	models.SetWorkflow(w)
+}
+
+// startScheduler pre-creates recurring tasks in the background.
+// TASK_RECURRENCE_INTERVAL sets how often it runs (0 turns it off) and
+// TASK_RECURRENCE_HORIZON how far ahead it creates occurrences.
+func startScheduler(repo data.TaskRepository) {
+	interval, err := time.ParseDuration(getenv("TASK_RECURRENCE_INTERVAL", "1h"))
+	if err != nil {
+		fatal("TASK_RECURRENCE_INTERVAL", err)
+	}
+	horizon, err := time.ParseDuration(getenv("TASK_RECURRENCE_HORIZON", "168h"))
+	if err != nil {
+		fatal("TASK_RECURRENCE_HORIZON", err)
+	}
+	if interval > 0 {
+		go data.RunScheduler(context.Background(), repo, interval, horizon)
+	}
+}
+
+// fatal logs why the server can't start and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// rateLimit reads the limit in k, like 60/1m or off, defaulting to def.
+func rateLimit(k, def string) middleware.Limit {
+	l, err := middleware.ParseLimit(getenv(k, def))
+	if err != nil {
+		fatal(k, err)
+	}
+	return l
+}
+
+// trustedProxies lists the proxies, from the comma-separated IPs or CIDRs
+// in TRUSTED_PROXIES, whose X-Forwarded-For gives a client's IP. There are
+// none by default, so a client can't pick the IP it is limited by.
+func trustedProxies() []string {
+	return splitList(os.Getenv("TRUSTED_PROXIES"))
+}
+
+// corsConfig reads the CORS policy from the JSON file named by CORS_CONFIG.
+// CORS_ALLOWED_ORIGINS, comma-separated, replaces its allowed origins;
+// without either the origins are def.
+func corsConfig(def []string) middleware.CORSConfig {
+	var cfg middleware.CORSConfig
+	if path := os.Getenv("CORS_CONFIG"); path != "" {
+		var err error
+		if cfg, err = middleware.LoadCORSConfig(path); err != nil {
+			fatal("load CORS config", err)
+		}
+	}
+	if origins := splitList(os.Getenv("CORS_ALLOWED_ORIGINS")); origins != nil {
+		cfg.AllowedOrigins = origins
+	}
+	if cfg.AllowedOrigins == nil {
+		cfg.AllowedOrigins = def
+	}
+	return cfg
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for item := range strings.SplitSeq(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func getenv(k, def string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,154 @@
+package router
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"task_manager/controllers"
+)
+
+func setup(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("TASK_DATA_DIR", "")
+	t.Setenv("TASK_RECURRENCE_INTERVAL", "0")
+	return Setup()
+}
+
+// TestAPISpecMatchesRoutes fails when a route is added without documenting
+// it in controllers.APISpec, or an operation outlives its route.
+func TestAPISpecMatchesRoutes(t *testing.T) {
+	r := setup(t)
+	if _, err := controllers.APISpec().Build(r.Routes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	r := setup(t)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json: %d", w.Code)
+	}
+	var doc struct {
+		OpenAPI    string                    `json:"openapi"`
+		Paths      map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("openapi = %q, want 3.x", doc.OpenAPI)
+	}
+	if _, ok := doc.Paths["/tasks/{id}"]["patch"]; !ok {
+		t.Errorf("PATCH /tasks/{id} missing from paths")
+	}
+
+	var refs []string
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, x := range v {
+				if s, ok := x.(string); ok && k == "$ref" {
+					refs = append(refs, s)
+				}
+				walk(x)
+			}
+		case []any:
+			for _, x := range v {
+				walk(x)
+			}
+		}
+	}
+	var raw any
+	json.Unmarshal(w.Body.Bytes(), &raw)
+	walk(raw)
+	if len(refs) == 0 {
+		t.Fatal("no $ref in the document")
+	}
+	for _, ref := range refs {
+		name, ok := strings.CutPrefix(ref, "#/components/schemas/")
+		if _, found := doc.Components.Schemas[name]; !ok || !found {
+			t.Errorf("$ref %q does not resolve", ref)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "openapi.json") {
+		t.Errorf("GET /docs: %d, want the docs page", w.Code)
+	}
+}
+
+// TestEventsFollowTaskOutOfFilter checks that a filtered event stream hears
+// about a task that leaves its filter, so the client can drop it.
+func TestEventsFollowTaskOutOfFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		update string
+	}{
+		{"status", "status=pending", `{"status":"done"}`},
+		{"assignee", "assignee=alice", `{"assignee":"bob"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(setup(t))
+			defer srv.Close()
+
+			var task struct {
+				Data struct {
+					ID json.Number `json:"id"`
+				} `json:"data"`
+			}
+			res, err := http.Post(srv.URL+"/tasks", "application/json", strings.NewReader(
+				`{"title":"Write docs","due_date":"2030-01-01T00:00:00Z","status":"pending","assignee":"alice"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			json.NewDecoder(res.Body).Decode(&task)
+			res.Body.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/tasks/events?"+tt.filter, nil)
+			stream, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stream.Body.Close()
+			lines := bufio.NewScanner(stream.Body)
+			lines.Scan() // the retry line, sent once the subscription is in place
+
+			req, _ = http.NewRequest(http.MethodPut, srv.URL+"/tasks/"+task.Data.ID.String(), strings.NewReader(tt.update))
+			req.Header.Set("Content-Type", "application/json")
+			res, err = http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				t.Fatalf("PUT: %d", res.StatusCode)
+			}
+
+			for lines.Scan() {
+				if lines.Text() == "event: updated" {
+					return
+				}
+			}
+			t.Fatalf("no updated event: %v", lines.Err())
+		})
+	}
+}
@@ -0,0 +1,499 @@
+// Package rrule parses iCalendar recurrence rules (RFC 5545, section
+// 3.3.10) and expands them into occurrences.
+//
+// DAILY, WEEKLY, MONTHLY and YEARLY rules are supported with INTERVAL,
+// COUNT, UNTIL, BYDAY, BYMONTHDAY, BYMONTH, BYSETPOS and WKST.
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	// Recurring tasks name IANA zones; embed the database so they resolve
+	// on hosts without one.
+	_ "time/tzdata"
+)
+
+var ErrInvalid = errors.New("invalid recurrence rule")
+
+type Frequency int
+
+const (
+	Daily Frequency = iota
+	Weekly
+	Monthly
+	Yearly
+)
+
+var freqNames = map[string]Frequency{
+	"DAILY":   Daily,
+	"WEEKLY":  Weekly,
+	"MONTHLY": Monthly,
+	"YEARLY":  Yearly,
+}
+
+var dayNames = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// WeekdayNum is a BYDAY entry: every Day of the period when N is 0,
+// otherwise the Nth one, counting from the end when N is negative.
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+// Rule is a parsed RRULE.
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	Count    int
+	// Until is the last moment an occurrence may fall on; zero when unset.
+	// When UntilFloating is set its wall clock is read in the series' zone
+	// instead of as an instant.
+	Until         time.Time
+	UntilFloating bool
+	untilDate     bool
+
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	ByMonth    []int
+	BySetPos   []int
+	WeekStart  time.Weekday
+}
+
+// Parse reads a rule such as "FREQ=WEEKLY;BYDAY=MO,WE". A leading "RRULE:"
+// is accepted.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "RRULE:")
+	r := &Rule{Interval: 1, WeekStart: time.Monday}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("%w: %q is not NAME=VALUE", ErrInvalid, part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%w: %s given twice", ErrInvalid, name)
+		}
+		seen[name] = true
+		var err error
+		switch name {
+		case "FREQ":
+			f, ok := freqNames[value]
+			if !ok {
+				return nil, fmt.Errorf("%w: FREQ must be DAILY, WEEKLY, MONTHLY or YEARLY", ErrInvalid)
+			}
+			r.Freq = f
+		case "INTERVAL":
+			r.Interval, err = parseInt(name, value, 1, 1000)
+		case "COUNT":
+			r.Count, err = parseInt(name, value, 1, 10000)
+		case "UNTIL":
+			err = r.parseUntil(value)
+		case "BYDAY":
+			r.ByDay, err = parseByDay(value)
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = parseList(name, value, 1, 31)
+		case "BYMONTH":
+			r.ByMonth, err = parseList(name, value, 1, 12)
+			if err == nil && slices.ContainsFunc(r.ByMonth, func(m int) bool { return m < 0 }) {
+				err = fmt.Errorf("%w: BYMONTH must be 1-12", ErrInvalid)
+			}
+		case "BYSETPOS":
+			r.BySetPos, err = parseList(name, value, 1, 366)
+		case "WKST":
+			d := slices.Index(dayNames, value)
+			if d < 0 {
+				return nil, fmt.Errorf("%w: WKST must be a weekday (MO, TU, ...)", ErrInvalid)
+			}
+			r.WeekStart = time.Weekday(d)
+		default:
+			return nil, fmt.Errorf("%w: %s is not supported", ErrInvalid, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case !seen["FREQ"]:
+		return nil, fmt.Errorf("%w: FREQ is required", ErrInvalid)
+	case r.Count > 0 && !r.Until.IsZero():
+		return nil, fmt.Errorf("%w: use either COUNT or UNTIL, not both", ErrInvalid)
+	case r.Freq == Weekly && len(r.ByMonthDay) > 0:
+		return nil, fmt.Errorf("%w: BYMONTHDAY does not apply to WEEKLY rules", ErrInvalid)
+	case len(r.BySetPos) > 0 && len(r.ByDay)+len(r.ByMonthDay)+len(r.ByMonth) == 0:
+		return nil, fmt.Errorf("%w: BYSETPOS needs another BY rule", ErrInvalid)
+	}
+	for _, d := range r.ByDay {
+		if d.N != 0 && r.Freq != Monthly && r.Freq != Yearly {
+			return nil, fmt.Errorf("%w: numbered BYDAY only applies to MONTHLY and YEARLY rules", ErrInvalid)
+		}
+		if d.N != 0 && r.Freq == Yearly && len(r.ByMonthDay) > 0 {
+			return nil, fmt.Errorf("%w: numbered BYDAY cannot be combined with BYMONTHDAY", ErrInvalid)
+		}
+	}
+	slices.Sort(r.ByMonth)
+	return r, nil
+}
+
+func parseInt(name, value string, lo, hi int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < lo || n > hi {
+		return 0, fmt.Errorf("%w: %s must be %d-%d", ErrInvalid, name, lo, hi)
+	}
+	return n, nil
+}
+
+// parseList reads comma-separated numbers of magnitude lo-hi; negative
+// values count from the end.
+func parseList(name, value string, lo, hi int) ([]int, error) {
+	var out []int
+	for _, v := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(v)
+		if err != nil || abs(n) < lo || abs(n) > hi {
+			return nil, fmt.Errorf("%w: %s must be %d-%d or -%d to -%d", ErrInvalid, name, lo, hi, lo, hi)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+func parseByDay(value string) ([]WeekdayNum, error) {
+	var out []WeekdayNum
+	for _, v := range strings.Split(value, ",") {
+		if len(v) < 2 {
+			return nil, fmt.Errorf("%w: BYDAY entries look like MO or -1FR", ErrInvalid)
+		}
+		d := slices.Index(dayNames, v[len(v)-2:])
+		if d < 0 {
+			return nil, fmt.Errorf("%w: BYDAY entries look like MO or -1FR", ErrInvalid)
+		}
+		wd := WeekdayNum{Day: time.Weekday(d)}
+		if num := v[:len(v)-2]; num != "" {
+			n, err := strconv.Atoi(num)
+			if err != nil || n == 0 || abs(n) > 53 {
+				return nil, fmt.Errorf("%w: BYDAY numbers must be 1-53 or -1 to -53", ErrInvalid)
+			}
+			wd.N = n
+		}
+		out = append(out, wd)
+	}
+	return out, nil
+}
+
+func (r *Rule) parseUntil(value string) error {
+	for _, f := range []struct {
+		layout         string
+		floating, date bool
+	}{
+		{"20060102T150405Z", false, false},
+		{"20060102T150405", true, false},
+		{"20060102", true, true},
+	} {
+		t, err := time.Parse(f.layout, value)
+		if err != nil {
+			continue
+		}
+		if f.date {
+			t = t.Add(24*time.Hour - time.Second)
+		}
+		r.Until, r.UntilFloating, r.untilDate = t, f.floating, f.date
+		return nil
+	}
+	return fmt.Errorf("%w: UNTIL must look like 20251231, 20251231T170000 or 20251231T170000Z", ErrInvalid)
+}
+
+// String formats the rule in a canonical order, without the "RRULE:"
+// prefix.
+func (r *Rule) String() string {
+	var parts []string
+	for name, f := range freqNames {
+		if f == r.Freq {
+			parts = append(parts, "FREQ="+name)
+		}
+	}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	switch {
+	case r.Until.IsZero():
+	case r.untilDate:
+		parts = append(parts, "UNTIL="+r.Until.Format("20060102"))
+	case r.UntilFloating:
+		parts = append(parts, "UNTIL="+r.Until.Format("20060102T150405"))
+	default:
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, d := range r.ByDay {
+			days[i] = dayNames[d.Day]
+			if d.N != 0 {
+				days[i] = strconv.Itoa(d.N) + days[i]
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		parts = append(parts, "BYMONTHDAY="+joinInts(r.ByMonthDay))
+	}
+	if len(r.ByMonth) > 0 {
+		parts = append(parts, "BYMONTH="+joinInts(r.ByMonth))
+	}
+	if len(r.BySetPos) > 0 {
+		parts = append(parts, "BYSETPOS="+joinInts(r.BySetPos))
+	}
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+dayNames[r.WeekStart])
+	}
+	return strings.Join(parts, ";")
+}
+
+func joinInts(ns []int) string {
+	s := make([]string, len(ns))
+	for i, n := range ns {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ",")
+}
+
+// Next returns the first occurrence after after in the series that starts
+// at start, or false once the series has ended. start is the first
+// occurrence. Every occurrence keeps start's wall-clock time in start's
+// location, so a 09:00 task stays at 09:00 across DST changes; a time that
+// falls into a DST gap moves forward by the length of the gap.
+func (r *Rule) Next(start, after time.Time) (time.Time, bool) {
+	var next time.Time
+	found := false
+	r.each(start, func(t time.Time) bool {
+		if t.After(after) {
+			next, found = t, true
+			return false
+		}
+		return true
+	})
+	return next, found
+}
+
+// gregorianCycle is how many years it takes the calendar, weekdays
+// included, to repeat. A rule that matches nothing for that long, such as
+// FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30, never will again.
+const gregorianCycle = 400
+
+// each calls fn with the occurrences in order until fn returns false or the
+// series ends.
+func (r *Rule) each(start time.Time, fn func(time.Time) bool) {
+	loc := start.Location()
+	until := r.Until
+	if r.UntilFloating {
+		until = time.Date(until.Year(), until.Month(), until.Day(), until.Hour(), until.Minute(), until.Second(), 0, loc)
+	}
+	n := 0
+	emit := func(t time.Time) bool {
+		if !r.Until.IsZero() && t.After(until) {
+			return false
+		}
+		n++
+		return fn(t) && (r.Count == 0 || n < r.Count)
+	}
+	if !emit(start) {
+		return
+	}
+	h, m, s := start.Clock()
+	last := start
+	for p := 0; ; p++ {
+		days := r.period(start, p)
+		if len(days) == 0 {
+			if r.periodStart(start, p).After(last.AddDate(gregorianCycle, 0, 0)) {
+				return
+			}
+			continue
+		}
+		last = days[len(days)-1]
+		for _, d := range days {
+			t := wallClock(d, h, m, s, start.Nanosecond(), loc)
+			if !t.After(start) {
+				continue
+			}
+			if !emit(t) {
+				return
+			}
+		}
+	}
+}
+
+// wallClock is time.Date for date d, except that a time skipped by a DST
+// change moves forward by the length of the gap instead of being left to
+// time.Date's choice.
+func wallClock(d time.Time, h, m, s, ns int, loc *time.Location) time.Time {
+	t := time.Date(d.Year(), d.Month(), d.Day(), h, m, s, ns, loc)
+	if t.Hour() == h && t.Minute() == m {
+		return t
+	}
+	_, before := t.Add(-24 * time.Hour).Zone()
+	wall := time.Date(d.Year(), d.Month(), d.Day(), h, m, s, ns, time.UTC)
+	return wall.Add(-time.Duration(before) * time.Second).In(loc)
+}
+
+// day makes a calendar date; noon UTC keeps date arithmetic clear of zone
+// changes.
+func day(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 12, 0, 0, 0, time.UTC)
+}
+
+// periodStart is the first day of the p-th period of the series.
+func (r *Rule) periodStart(start time.Time, p int) time.Time {
+	y, m, d := start.Date()
+	switch r.Freq {
+	case Daily:
+		return day(y, m, d+p*r.Interval)
+	case Weekly:
+		back := (int(start.Weekday()) - int(r.WeekStart) + 7) % 7
+		return day(y, m, d-back+7*p*r.Interval)
+	case Monthly:
+		return day(y, m+time.Month(p*r.Interval), 1)
+	default:
+		return day(y+p*r.Interval, 1, 1)
+	}
+}
+
+// period lists the dates matched in the p-th period of the series, in
+// order.
+func (r *Rule) period(start time.Time, p int) []time.Time {
+	_, m, d := start.Date()
+	first := r.periodStart(start, p)
+	var days []time.Time
+	switch r.Freq {
+	case Daily:
+		if r.inMonth(first) && r.onMonthDay(first) && r.onWeekday(first) {
+			days = append(days, first)
+		}
+	case Weekly:
+		for i := range 7 {
+			t := first.AddDate(0, 0, i)
+			match := t.Weekday() == start.Weekday()
+			if len(r.ByDay) > 0 {
+				match = r.onWeekday(t)
+			}
+			if match && r.inMonth(t) {
+				days = append(days, t)
+			}
+		}
+	case Monthly:
+		if r.inMonth(first) {
+			days = r.monthDays(first.Year(), first.Month(), d)
+		}
+	case Yearly:
+		yr := first.Year()
+		if len(r.ByDay) > 0 && len(r.ByMonth) == 0 && len(r.ByMonthDay) == 0 {
+			days = r.spanDays(day(yr, 1, 1), day(yr+1, 1, 1))
+			break
+		}
+		months := r.ByMonth
+		if len(months) == 0 {
+			months = []int{int(m)}
+			if len(r.ByMonthDay) > 0 {
+				months = []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+			}
+		}
+		for _, mo := range months {
+			days = append(days, r.monthDays(yr, time.Month(mo), d)...)
+		}
+	}
+	return r.setPos(days)
+}
+
+// monthDays lists the matching days of one month. Without BYDAY or
+// BYMONTHDAY that is the start's day of the month, if the month has it.
+func (r *Rule) monthDays(y int, m time.Month, startDay int) []time.Time {
+	if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 {
+		if t := day(y, m, startDay); t.Month() == m {
+			return []time.Time{t}
+		}
+		return nil
+	}
+	var days []time.Time
+	for _, t := range r.spanDays(day(y, m, 1), day(y, m+1, 1)) {
+		if r.onMonthDay(t) {
+			days = append(days, t)
+		}
+	}
+	return days
+}
+
+// spanDays lists the days in [from, to) that match BYDAY, with numbered
+// entries counted within the span.
+func (r *Rule) spanDays(from, to time.Time) []time.Time {
+	n := int(to.Sub(from).Hours()+1) / 24
+	var days []time.Time
+	for i := range n {
+		t := from.AddDate(0, 0, i)
+		if len(r.ByDay) == 0 {
+			days = append(days, t)
+			continue
+		}
+		fromStart, fromEnd := i/7+1, -((n-1-i)/7 + 1)
+		for _, wd := range r.ByDay {
+			if wd.Day == t.Weekday() && (wd.N == 0 || wd.N == fromStart || wd.N == fromEnd) {
+				days = append(days, t)
+				break
+			}
+		}
+	}
+	return days
+}
+
+func (r *Rule) inMonth(t time.Time) bool {
+	return len(r.ByMonth) == 0 || slices.Contains(r.ByMonth, int(t.Month()))
+}
+
+func (r *Rule) onMonthDay(t time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	last := day(t.Year(), t.Month()+1, 0).Day()
+	for _, md := range r.ByMonthDay {
+		if md == t.Day() || md < 0 && last+md+1 == t.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) onWeekday(t time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(r.ByDay, func(wd WeekdayNum) bool { return wd.Day == t.Weekday() })
+}
+
+// setPos keeps the BYSETPOS positions of days.
+func (r *Rule) setPos(days []time.Time) []time.Time {
+	if len(r.BySetPos) == 0 || len(days) == 0 {
+		return days
+	}
+	var out []time.Time
+	for i, t := range days {
+		for _, pos := range r.BySetPos {
+			if pos == i+1 || pos == i-len(days) {
+				out = append(out, t)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
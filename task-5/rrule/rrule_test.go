@@ -0,0 +1,125 @@
+package rrule
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// occurrences lists the first n occurrences of rule in the series starting
+// at start, read as a wall clock in zone.
+func occurrences(t *testing.T, rule, zone, start string, n int) []string {
+	t.Helper()
+	r, err := Parse(rule)
+	if err != nil {
+		t.Fatalf("parse %s: %v", rule, err)
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := time.ParseInLocation("2006-01-02T15:04", start, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for at := first; len(out) < n; {
+		next, ok := r.Next(first, at)
+		if !ok {
+			break
+		}
+		out = append(out, next.Format(time.RFC3339))
+		at = next
+	}
+	return out
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  string
+		zone  string
+		start string
+		want  []string
+		// ends says the series has no occurrences after want.
+		ends bool
+	}{
+		{
+			name: "DST gap moves forward by its length",
+			rule: "FREQ=DAILY", zone: "America/New_York", start: "2025-03-08T02:30",
+			want: []string{"2025-03-09T03:30:00-04:00", "2025-03-10T02:30:00-04:00"},
+		},
+		{
+			name: "DST overlap happens once",
+			rule: "FREQ=DAILY", zone: "America/New_York", start: "2025-11-01T01:30",
+			want: []string{"2025-11-02T01:30:00-04:00", "2025-11-03T01:30:00-05:00"},
+		},
+		{
+			name: "weekly keeps its wall clock across DST",
+			rule: "FREQ=WEEKLY", zone: "Europe/Berlin", start: "2025-03-24T09:00",
+			want: []string{"2025-03-31T09:00:00+02:00", "2025-04-07T09:00:00+02:00"},
+		},
+		{
+			name: "gap on a day the rule picks",
+			rule: "FREQ=MONTHLY;BYDAY=2SU", zone: "America/New_York", start: "2025-02-09T02:15",
+			want: []string{"2025-03-09T03:15:00-04:00", "2025-04-13T02:15:00-04:00"},
+		},
+		{
+			name: "BYSETPOS picks the last weekday of the month",
+			rule: "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1", zone: "UTC", start: "2025-01-31T09:00",
+			want: []string{"2025-02-28T09:00:00Z", "2025-03-31T09:00:00Z", "2025-04-30T09:00:00Z", "2025-05-30T09:00:00Z"},
+		},
+		{
+			name: "BYSETPOS with several positions",
+			rule: "FREQ=MONTHLY;BYDAY=MO;BYSETPOS=1,-1", zone: "UTC", start: "2025-06-02T09:00",
+			want: []string{"2025-06-30T09:00:00Z", "2025-07-07T09:00:00Z", "2025-07-28T09:00:00Z"},
+		},
+		{
+			name: "negative BYMONTHDAY counts from the end",
+			rule: "FREQ=MONTHLY;BYMONTHDAY=-1", zone: "UTC", start: "2024-01-31T09:00",
+			want: []string{"2024-02-29T09:00:00Z", "2024-03-31T09:00:00Z", "2024-04-30T09:00:00Z"},
+		},
+		{
+			name: "second to last day",
+			rule: "FREQ=MONTHLY;BYMONTHDAY=-2", zone: "UTC", start: "2025-01-30T09:00",
+			want: []string{"2025-02-27T09:00:00Z", "2025-03-30T09:00:00Z"},
+		},
+		{
+			name: "daily leap day waits years between matches",
+			rule: "FREQ=DAILY;BYMONTH=2;BYMONTHDAY=29", zone: "UTC", start: "2024-02-29T09:00",
+			want: []string{"2028-02-29T09:00:00Z", "2032-02-29T09:00:00Z"},
+		},
+		{
+			name: "yearly leap day skips 2100",
+			rule: "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29", zone: "UTC", start: "2096-02-29T09:00",
+			want: []string{"2104-02-29T09:00:00Z"},
+		},
+		{
+			name: "yearly rule that never matches ends",
+			rule: "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30", zone: "UTC", start: "2025-01-01T09:00",
+			ends: true,
+		},
+		{
+			name: "daily rule that never matches ends",
+			rule: "FREQ=DAILY;BYMONTH=2;BYMONTHDAY=30", zone: "UTC", start: "2025-01-01T09:00",
+			ends: true,
+		},
+		{
+			name: "COUNT includes the start",
+			rule: "FREQ=DAILY;COUNT=3", zone: "UTC", start: "2025-01-01T09:00",
+			want: []string{"2025-01-02T09:00:00Z", "2025-01-03T09:00:00Z"},
+			ends: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := occurrences(t, tt.rule, tt.zone, tt.start, len(tt.want)+1)
+			if !tt.ends && len(got) > len(tt.want) {
+				got = got[:len(tt.want)]
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got  %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
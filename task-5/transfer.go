@@ -0,0 +1,120 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"task_manager/models"
+	"task_manager/taskio"
+)
+
+// runTransfer runs the export and import commands. They talk to a running
+// server, so its rules apply and its events and webhooks fire:
+//
+//	task_manager export [-server URL] [-format json|csv|yaml] [-query 'status=done'] [-o FILE]
+//	task_manager import [-server URL] [-format json|csv|yaml] [-on-conflict skip|overwrite|new_id] [FILE]
+//
+// The format defaults to the file's extension, else json. Without a FILE
+// they use stdout and stdin.
+func runTransfer(cmd string, args []string) error {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	server := fs.String("server", cmp.Or(os.Getenv("TASK_SERVER"), "http://localhost:8080"), "server URL (env TASK_SERVER)")
+	format := fs.String("format", "", "file format: json, csv or yaml")
+	if cmd == "export" {
+		query := fs.String("query", "", "GET /tasks filters, e.g. 'status=done&label=bug'")
+		out := fs.String("o", "", "file to write instead of stdout")
+		fs.Parse(args)
+		return runExport(*server, cmp.Or(*format, taskio.FormatOf(*out), models.FormatJSON), *query, *out)
+	}
+	policy := fs.String("on-conflict", string(models.DefaultConflictPolicy), "for tasks whose id is taken: skip, overwrite or new_id")
+	fs.Parse(args)
+	return runImport(*server, cmp.Or(*format, taskio.FormatOf(fs.Arg(0)), models.FormatJSON), *policy, fs.Arg(0))
+}
+
+func runExport(server, format, query, out string) error {
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return fmt.Errorf("invalid -query: %w", err)
+	}
+	params.Set("format", format)
+	res, err := http.Get(strings.TrimRight(server, "/") + "/tasks/export?" + params.Encode())
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return apiError(res)
+	}
+
+	if out == "" {
+		_, err = io.Copy(os.Stdout, res.Body)
+		return err
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, res.Body); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func runImport(server, format, policy, in string) error {
+	r := os.Stdin
+	if in != "" && in != "-" {
+		f, err := os.Open(in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	params := url.Values{"format": {format}, "on_conflict": {policy}}
+	res, err := http.Post(strings.TrimRight(server, "/")+"/tasks/import?"+params.Encode(), taskio.ContentType(format), r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return apiError(res)
+	}
+
+	var body struct {
+		Data models.ImportReport `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return err
+	}
+	report := body.Data
+	for _, r := range report.Results {
+		if r.Action == models.ImportFailed {
+			fmt.Fprintf(os.Stderr, "tasks[%d] (id %q): %s\n", r.Index, r.ID, r.Error)
+		}
+	}
+	fmt.Printf("created %d, updated %d, skipped %d, failed %d\n", report.Created, report.Updated, report.Skipped, report.Failed)
+	if report.Failed > 0 {
+		return fmt.Errorf("%d of %d tasks failed", report.Failed, len(report.Results))
+	}
+	return nil
+}
+
+// apiError turns an error answer into an error.
+func apiError(res *http.Response) error {
+	var body struct {
+		Error string `json:"error"`
+	}
+	if json.NewDecoder(res.Body).Decode(&body) != nil || body.Error == "" {
+		return errors.New(res.Status)
+	}
+	return fmt.Errorf("%s: %s", res.Status, body.Error)
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"task_manager/data"
+	"task_manager/ical"
+	"task_manager/models"
+)
+
+// calendarRefresh is how often calendar apps are asked to reload the feed.
+const calendarRefresh = "PT15M"
+
+// Calendar serves the tasks matching the GET /tasks filters as an
+// iCalendar feed, one entry per task due at its due_date. as=todo renders
+// VTODOs instead of VEVENTs, which many calendar apps don't show.
+func (c *TaskController) Calendar(ctx *gin.Context) {
+	q, err := parseTaskQuery(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorMsg(err.Error()))
+		return
+	}
+	as := ctx.DefaultQuery("as", "event")
+	if as != "event" && as != "todo" {
+		ctx.JSON(http.StatusBadRequest, errorMsg("invalid as (use: event | todo)"))
+		return
+	}
+	tasks, err := data.AllTasks(ctx.Request.Context(), c.Service, q)
+	if err != nil {
+		code, msg := listStatus(err)
+		fail(ctx, code, msg, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := writeCalendar(&buf, tasks, as == "todo"); err != nil {
+		fail(ctx, http.StatusInternalServerError, "internal error", err)
+		return
+	}
+	tag := fmt.Sprintf(`"%x"`, sha256.Sum256(buf.Bytes()))
+	ctx.Header("ETag", tag)
+	if notModified(ctx, tag) {
+		ctx.Status(http.StatusNotModified)
+		return
+	}
+	ctx.Data(http.StatusOK, "text/calendar; charset=utf-8", buf.Bytes())
+}
+
+func writeCalendar(buf *bytes.Buffer, tasks []models.TaskOut, todo bool) error {
+	w := ical.NewWriter(buf)
+	w.Begin("VCALENDAR")
+	w.Line("VERSION", "2.0")
+	w.Line("PRODID", "-//task_manager//Tasks//EN")
+	w.Line("CALSCALE", "GREGORIAN")
+	w.Line("METHOD", "PUBLISH")
+	w.Text("X-WR-CALNAME", "Tasks")
+	w.Line("REFRESH-INTERVAL;VALUE=DURATION", calendarRefresh)
+	w.Line("X-PUBLISHED-TTL", calendarRefresh)
+	for _, t := range tasks {
+		writeCalendarTask(w, t, todo)
+	}
+	w.End("VCALENDAR")
+	return w.Err()
+}
+
+// writeCalendarTask renders t. The UID only depends on the task's ID and
+// SEQUENCE counts its changes, so clients update entries in place.
+func writeCalendarTask(w *ical.Writer, t models.TaskOut, todo bool) {
+	component := "VEVENT"
+	if todo {
+		component = "VTODO"
+	}
+	w.Begin(component)
+	w.Line("UID", taskUID(t.ID))
+	w.Time("DTSTAMP", t.UpdatedAt)
+	w.Time("CREATED", t.CreatedAt)
+	w.Time("LAST-MODIFIED", t.UpdatedAt)
+	w.Line("SEQUENCE", fmt.Sprint(max(t.Version-1, 0)))
+	w.Text("SUMMARY", t.Title)
+	if t.Description != "" {
+		w.Text("DESCRIPTION", t.Description)
+	}
+	done := models.CurrentWorkflow().Category(t.Status) == models.CategoryDone
+	if todo {
+		w.Time("DUE", t.DueDate)
+		w.Line("STATUS", todoStatus(t.Status))
+		if done {
+			w.Line("PERCENT-COMPLETE", "100")
+		}
+	} else {
+		// A deadline is a moment, and shouldn't make anyone look busy.
+		w.Time("DTSTART", t.DueDate)
+		w.Line("TRANSP", "TRANSPARENT")
+		w.Line("STATUS", "CONFIRMED")
+	}
+	w.Line("PRIORITY", fmt.Sprint(icalPriority(t.Priority)))
+	if len(t.Labels) > 0 {
+		w.List("CATEGORIES", t.Labels)
+	}
+	if t.ParentID != "" {
+		w.Line("RELATED-TO", taskUID(t.ParentID))
+	}
+	w.Text("X-TASK-STATUS", string(t.Status))
+	w.End(component)
+}
+
+func taskUID(id string) string { return "task-" + id + "@task_manager" }
+
+// todoStatus maps a workflow status onto the VTODO statuses by category.
+func todoStatus(s models.TaskStatus) string {
+	switch models.CurrentWorkflow().Category(s) {
+	case models.CategoryDone:
+		return "COMPLETED"
+	case models.CategoryActive:
+		return "IN-PROCESS"
+	default:
+		return "NEEDS-ACTION"
+	}
+}
+
+// icalPriority maps task priorities onto RFC 5545's 1 (highest) to 9.
+func icalPriority(p models.TaskPriority) int {
+	switch p {
+	case models.PriorityUrgent:
+		return 1
+	case models.PriorityHigh:
+		return 3
+	case models.PriorityLow:
+		return 9
+	default:
+		return 5
+	}
+}
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"task_manager/data"
+)
+
+// etag renders a task version as a strong entity tag.
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// parseETag reverses etag. Weak tags never match under If-Match, so they are
+// rejected here.
+func parseETag(tag string) (int64, bool) {
+	if len(tag) < 3 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	return v, err == nil && v >= 0
+}
+
+// notModified applies If-None-Match (weak comparison) to the current tag.
+func notModified(ctx *gin.Context, tag string) bool {
+	header := ctx.GetHeader("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// expectedVersion turns If-Match into the version Update and Delete must
+// still find. A missing header or "*" writes unconditionally. ok is false
+// when the header names no tag we could have issued.
+func (c *TaskController) expectedVersion(ctx *gin.Context, id string) (version int64, ok bool) {
+	header := strings.TrimSpace(ctx.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return data.AnyVersion, true
+	}
+	var versions []int64
+	for _, t := range strings.Split(header, ",") {
+		if v, ok := parseETag(strings.TrimSpace(t)); ok {
+			versions = append(versions, v)
+		}
+	}
+	if len(versions) == 0 {
+		return 0, false
+	}
+	if len(versions) > 1 {
+		// Pick the listed version that is current; the write itself still
+		// fails if the task changes before it lands.
+		if task, err := c.Service.Get(ctx.Request.Context(), id); err == nil && slices.Contains(versions, task.Version) {
+			return task.Version, true
+		}
+	}
+	return versions[0], true
+}
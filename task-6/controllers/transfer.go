@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"task_manager/data"
+	"task_manager/models"
+	"task_manager/taskio"
+)
+
+// maxImportBytes caps the body of POST /tasks/import.
+const maxImportBytes = 32 << 20
+
+// Export serves the tasks matching the GET /tasks filters as a file:
+// format=json (the default), csv or yaml.
+func (c *TaskController) Export(ctx *gin.Context) {
+	format := ctx.DefaultQuery("format", models.FormatJSON)
+	if !models.IsValidFormat(format) {
+		ctx.JSON(http.StatusBadRequest, errorMsg("invalid format (use: json | csv | yaml)"))
+		return
+	}
+	q, err := parseTaskQuery(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorMsg(err.Error()))
+		return
+	}
+	records, err := data.ExportTasks(ctx.Request.Context(), c.Service, q)
+	if err != nil {
+		code, msg := listStatus(err)
+		fail(ctx, code, msg, err)
+		return
+	}
+	var buf bytes.Buffer
+	if err := taskio.Write(&buf, format, records); err != nil {
+		fail(ctx, http.StatusInternalServerError, "internal error", err)
+		return
+	}
+	ctx.Header("Content-Disposition", `attachment; filename="tasks.`+format+`"`)
+	ctx.Data(http.StatusOK, taskio.ContentType(format), buf.Bytes())
+}
+
+// Import stores the tasks of a file in the body, in the format named by
+// format or else by the Content-Type. on_conflict says what to do with a
+// task whose id is taken. A task missing a required field rejects the whole
+// file before anything is stored; any other failure only skips that task,
+// and the report says what happened to each one.
+func (c *TaskController) Import(ctx *gin.Context) {
+	format := cmp.Or(ctx.Query("format"), taskio.FormatOf(ctx.ContentType()), models.FormatJSON)
+	if !models.IsValidFormat(format) {
+		ctx.JSON(http.StatusBadRequest, errorMsg("invalid format (use: json | csv | yaml)"))
+		return
+	}
+	policy := models.ConflictPolicy(ctx.DefaultQuery("on_conflict", string(models.DefaultConflictPolicy)))
+	if !models.IsValidConflictPolicy(policy) {
+		ctx.JSON(http.StatusBadRequest, errorMsg("invalid on_conflict (use: skip | overwrite | new_id)"))
+		return
+	}
+	records, err := taskio.Read(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxImportBytes), format)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		ctx.JSON(http.StatusRequestEntityTooLarge, errorMsg(fmt.Sprintf("file too large (max %d bytes)", maxImportBytes)))
+		return
+	case errors.Is(err, taskio.ErrInvalidFile):
+		ctx.JSON(http.StatusBadRequest, errorMsg(err.Error()))
+		return
+	case err != nil:
+		ctx.JSON(http.StatusBadRequest, errorMsg("invalid request body"))
+		return
+	}
+	if len(records) == 0 || len(records) > models.MaxImportSize {
+		ctx.JSON(http.StatusBadRequest, errorMsg(fmt.Sprintf("an import takes 1 to %d tasks", models.MaxImportSize)))
+		return
+	}
+	for i := range records {
+		if binding.Validator.ValidateStruct(&records[i]) != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("tasks[%d]: task needs a title, due_date and status", i), "index": i})
+			return
+		}
+	}
+
+	results := data.ImportTasks(ctx.Request.Context(), c.Service, records, policy)
+	report := models.ImportReport{Results: make([]models.ImportResult, len(results))}
+	for i, r := range results {
+		out := models.ImportResult{Index: i, ID: records[i].ID, Action: r.Action, TaskID: r.Task.ID}
+		switch r.Action {
+		case models.ImportCreated:
+			report.Created++
+		case models.ImportUpdated:
+			report.Updated++
+		case models.ImportSkipped:
+			report.Skipped++
+		default:
+			report.Failed++
+			code, msg := importError(r.Err)
+			logCause(ctx, code, r.Err)
+			out.Error = msg
+		}
+		report.Results[i] = out
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": report})
+}
+
+// importError explains why one task of an import failed, with the status
+// the single-task endpoints would answer.
+func importError(err error) (int, string) {
+	if errors.Is(err, data.ErrDuplicateRecord) || errors.Is(err, data.ErrRecordCycle) || errors.Is(err, data.ErrRecordDependent) {
+		return http.StatusBadRequest, err.Error()
+	}
+	return updateStatus(err)
+}
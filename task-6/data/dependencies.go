@@ -0,0 +1,92 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"task_manager/models"
+)
+
+var (
+	ErrInvalidBlocker  = errors.New("blocking task not found")
+	ErrDependencyCycle = errors.New("dependency would create a cycle")
+	ErrBlocked         = errors.New("task is blocked by tasks that are not done")
+)
+
+// startsWork reports whether moving to status needs every blocker done.
+func startsWork(status models.TaskStatus) bool {
+	return models.IsStarted(status)
+}
+
+// AddBlocker records that id cannot start before blocker is done.
+func AddBlocker(ctx context.Context, repo TaskRepository, id, blocker string, version int64) (models.TaskOut, error) {
+	return updateFrom(ctx, repo, id, version, func(cur models.TaskOut) (models.UpdateTaskDTO, error) {
+		blockers := cur.BlockedBy
+		if !slices.Contains(blockers, blocker) {
+			blockers = append(slices.Clip(blockers), blocker)
+		}
+		return models.UpdateTaskDTO{BlockedBy: &blockers}, nil
+	})
+}
+
+// RemoveBlocker drops the edge from blocker to id. Removing an edge that
+// isn't there is not an error.
+func RemoveBlocker(ctx context.Context, repo TaskRepository, id, blocker string, version int64) (models.TaskOut, error) {
+	return updateFrom(ctx, repo, id, version, func(cur models.TaskOut) (models.UpdateTaskDTO, error) {
+		blockers := slices.DeleteFunc(slices.Clone(cur.BlockedBy), func(b string) bool { return b == blocker })
+		return models.UpdateTaskDTO{BlockedBy: &blockers}, nil
+	})
+}
+
+// DependencyOrder lists id and everything it transitively waits on so that
+// each task comes after all of its blockers; id itself is last. Ties go to
+// the lower ID.
+func DependencyOrder(ctx context.Context, repo TaskRepository, id string) ([]models.TaskOut, error) {
+	root, err := repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	blockers, err := repo.Blockers(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return topoSort(append(blockers, root)), nil
+}
+
+// topoSort orders tasks by Kahn's algorithm over the blocked_by edges that
+// stay inside the set.
+func topoSort(tasks []models.TaskOut) []models.TaskOut {
+	byID := make(map[string]models.TaskOut, len(tasks))
+	for _, t := range tasks {
+		byID[t.ID] = t
+	}
+	pending := make(map[string]int, len(tasks))
+	unblocks := make(map[string][]string)
+	var ready []string
+	for _, t := range tasks {
+		for _, b := range t.BlockedBy {
+			if _, ok := byID[b]; ok {
+				pending[t.ID]++
+				unblocks[b] = append(unblocks[b], t.ID)
+			}
+		}
+		if pending[t.ID] == 0 {
+			ready = append(ready, t.ID)
+		}
+	}
+
+	out := make([]models.TaskOut, 0, len(tasks))
+	for len(ready) > 0 {
+		slices.SortFunc(ready, compareIDs)
+		next := ready[0]
+		ready = ready[1:]
+		out = append(out, byID[next])
+		for _, d := range unblocks[next] {
+			if pending[d]--; pending[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,143 @@
+package data
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"task_manager/models"
+)
+
+// EventReplaySize is how many recent events a reconnecting stream can
+// resume from.
+const EventReplaySize = 1000
+
+// subscriberBuffer is how far a subscriber may fall behind before it is cut
+// off. It then reconnects and catches up from the replay buffer.
+const subscriberBuffer = 64
+
+type EventType string
+
+const (
+	EventCreated EventType = "created"
+	EventUpdated EventType = "updated"
+	EventDeleted EventType = "deleted"
+)
+
+// TaskEvent is one change to a task. A deleted event carries the task as
+// it was last stored, and an updated one, where the writer read it, the
+// task as it was before in Before, so a stream filtered by status or
+// assignee can tell its client that a task left the filter.
+type TaskEvent struct {
+	ID     string
+	Type   EventType
+	Task   models.TaskOut
+	Before *models.TaskOut
+}
+
+// EventHub fans task changes out to subscribers and keeps the latest ones
+// for resuming. Event IDs are "<epoch>-<n>": the epoch changes with every
+// start, so an ID from before a restart is recognised as stale.
+type EventHub struct {
+	mu     sync.Mutex
+	epoch  string
+	seq    uint64
+	size   int
+	recent []TaskEvent // oldest first, at most size
+	subs   map[chan TaskEvent]bool
+}
+
+func NewEventHub(size int) *EventHub {
+	return &EventHub{
+		epoch: strconv.FormatInt(time.Now().UnixNano(), 36),
+		size:  size,
+		subs:  make(map[chan TaskEvent]bool),
+	}
+}
+
+// Publish gives ev an ID, records it and hands it to every subscriber
+// without blocking; a subscriber whose buffer is full is dropped.
+func (h *EventHub) Publish(ev TaskEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	ev.ID = h.epoch + "-" + strconv.FormatUint(h.seq, 10)
+	h.recent = append(h.recent, ev)
+	if len(h.recent) > h.size {
+		h.recent = h.recent[len(h.recent)-h.size:]
+	}
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscription is a live feed of events. C is closed when the subscriber
+// falls behind.
+type Subscription struct {
+	C <-chan TaskEvent
+	// Replay holds the buffered events after the ID passed to Subscribe.
+	Replay []TaskEvent
+	// Missed is set when events after that ID are no longer buffered, so
+	// the subscriber has to reload instead.
+	Missed bool
+
+	hub *EventHub
+	ch  chan TaskEvent
+}
+
+// Subscribe starts a feed of new events. lastID is the last event the
+// caller saw, or "" to start from now.
+func (h *EventHub) Subscribe(lastID string) *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch := make(chan TaskEvent, subscriberBuffer)
+	h.subs[ch] = true
+	sub := &Subscription{C: ch, hub: h, ch: ch}
+	if lastID == "" {
+		return sub
+	}
+	epoch, n, _ := strings.Cut(lastID, "-")
+	seq, err := strconv.ParseUint(n, 10, 64)
+	behind := h.seq - seq
+	if err != nil || epoch != h.epoch || seq > h.seq || behind > uint64(len(h.recent)) {
+		sub.Missed = true
+		return sub
+	}
+	sub.Replay = slices.Clone(h.recent[len(h.recent)-int(behind):])
+	return sub
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	if s.hub.subs[s.ch] {
+		delete(s.hub.subs, s.ch)
+		close(s.ch)
+	}
+}
+
+type eventBufferKey struct{}
+
+// bufferEvents returns a context under which published events collect in
+// buf instead of going out, for writes that may still be rolled back.
+func bufferEvents(ctx context.Context, buf *[]TaskEvent) context.Context {
+	return context.WithValue(ctx, eventBufferKey{}, buf)
+}
+
+// publishCtx publishes ev on h, or buffers it if ctx asks for it.
+func (h *EventHub) publishCtx(ctx context.Context, ev TaskEvent) {
+	if buf, ok := ctx.Value(eventBufferKey{}).(*[]TaskEvent); ok {
+		*buf = append(*buf, ev)
+		return
+	}
+	h.Publish(ev)
+}
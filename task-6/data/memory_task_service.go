@@ -0,0 +1,704 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"task_manager/models"
+)
+
+// MemoryTaskService keeps tasks in process memory. It is handy for local
+// development and tests where running MongoDB is overkill; everything is
+// lost on restart. IDs are decimal sequence numbers.
+type MemoryTaskService struct {
+	mu     sync.RWMutex
+	seq    int64
+	tasks  map[string]models.TaskOut
+	events *EventHub
+
+	// pending collects the events of an atomic batch until it commits.
+	pending []TaskEvent
+}
+
+func NewMemoryTaskService() *MemoryTaskService {
+	return &MemoryTaskService{tasks: make(map[string]models.TaskOut), events: NewEventHub(EventReplaySize)}
+}
+
+func (s *MemoryTaskService) Events() *EventHub { return s.events }
+
+func (s *MemoryTaskService) List(ctx context.Context, q models.TaskQuery) (models.TaskPage, error) {
+	q, err := normalizeQuery(q)
+	if err != nil {
+		return models.TaskPage{}, err
+	}
+
+	s.mu.RLock()
+	matched := make([]models.TaskOut, 0, len(s.tasks))
+	for _, t := range s.tasks {
+		if matchesQuery(t, q) {
+			matched = append(matched, t)
+		}
+	}
+	s.mu.RUnlock()
+
+	slices.SortFunc(matched, func(a, b models.TaskOut) int { return compareTasks(a, b, q) })
+
+	start := q.Offset
+	if q.Cursor != "" {
+		pivot, err := cursorPivot(q)
+		if err != nil {
+			return models.TaskPage{}, err
+		}
+		start, _ = slices.BinarySearchFunc(matched, pivot, func(t, p models.TaskOut) int {
+			if compareTasks(t, p, q) <= 0 {
+				return -1
+			}
+			return 1
+		})
+	}
+	start = min(start, len(matched))
+	end := min(start+q.Limit, len(matched))
+
+	page := models.TaskPage{
+		Data:   matched[start:end],
+		Total:  int64(len(matched)),
+		Limit:  q.Limit,
+		Offset: start,
+	}
+	if end < len(matched) && end > start {
+		page.NextCursor = encodeCursor(q, matched[end-1])
+	}
+	return page, nil
+}
+
+func (s *MemoryTaskService) Get(ctx context.Context, id string) (models.TaskOut, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tasks[id]
+	if !ok {
+		return models.TaskOut{}, ErrNotFound
+	}
+	return t, nil
+}
+
+func (s *MemoryTaskService) Create(ctx context.Context, dto models.CreateTaskDTO) (models.TaskOut, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	task, err := s.create(dto)
+	if err != nil {
+		return models.TaskOut{}, err
+	}
+	slog.DebugContext(ctx, "task created", "task_id", task.ID)
+	return task, nil
+}
+
+// create adds the task described by dto. Callers hold s.mu.
+func (s *MemoryTaskService) create(dto models.CreateTaskDTO) (models.TaskOut, error) {
+	if err := checkInitial(dto.Status); err != nil {
+		return models.TaskOut{}, err
+	}
+	due, err := time.Parse(time.RFC3339, dto.DueDate)
+	if err != nil {
+		return models.TaskOut{}, ErrInvalidDate
+	}
+	priority, err := createPriority(dto.Priority)
+	if err != nil {
+		return models.TaskOut{}, err
+	}
+	labels, err := normalizeLabels(dto.Labels)
+	if err != nil {
+		return models.TaskOut{}, err
+	}
+	assignee, err := normalizeAssignee(dto.Assignee)
+	if err != nil {
+		return models.TaskOut{}, err
+	}
+	recurrence, zone, err := normalizeRecurrence(dto.Recurrence, dto.TimeZone)
+	if err != nil {
+		return models.TaskOut{}, err
+	}
+
+	now := time.Now()
+	if dto.ParentID != "" {
+		if _, ok := s.tasks[dto.ParentID]; !ok {
+			return models.TaskOut{}, ErrInvalidParent
+		}
+	}
+	blockers, err := s.checkBlockers("", dto.BlockedBy)
+	if err != nil {
+		return models.TaskOut{}, err
+	}
+	if startsWork(dto.Status) && s.hasOpenBlocker(blockers) {
+		return models.TaskOut{}, ErrBlocked
+	}
+	s.seq++
+	task := models.TaskOut{
+		ID:          strconv.FormatInt(s.seq, 10),
+		Title:       dto.Title,
+		Description: dto.Description,
+		DueDate:     due,
+		Status:      dto.Status,
+		ParentID:    dto.ParentID,
+		BlockedBy:   blockers,
+		Priority:    priority,
+		Labels:      labels,
+		Assignee:    assignee,
+		Recurrence:  recurrence,
+		TimeZone:    zone,
+		Version:     1,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if recurrence != "" {
+		task.SeriesID, task.SeriesStart = task.ID, &due
+	}
+	s.put(task)
+	s.reopenAncestors(task)
+	return task, nil
+}
+
+func (s *MemoryTaskService) Update(ctx context.Context, id string, dto models.UpdateTaskDTO, version int64) (models.TaskOut, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	task, err := s.update(id, dto, version)
+	if err != nil {
+		return models.TaskOut{}, err
+	}
+	slog.DebugContext(ctx, "task updated", "task_id", task.ID, "version", task.Version)
+	return task, nil
+}
+
+// update applies dto to task id. Callers hold s.mu.
+func (s *MemoryTaskService) update(id string, dto models.UpdateTaskDTO, version int64) (models.TaskOut, error) {
+	task, ok := s.tasks[id]
+	if !ok {
+		return models.TaskOut{}, ErrNotFound
+	}
+	if version != AnyVersion && version != task.Version {
+		return models.TaskOut{}, ErrVersionMismatch
+	}
+
+	if dto.Title != nil {
+		task.Title = *dto.Title
+	}
+	if dto.Description != nil {
+		task.Description = *dto.Description
+	}
+	wasStatus := task.Status
+	if dto.Status != nil {
+		if err := checkTransition(task.Status, *dto.Status); err != nil {
+			return models.TaskOut{}, err
+		}
+		task.Status = *dto.Status
+	}
+	if dto.DueDate != nil {
+		d, err := time.Parse(time.RFC3339, *dto.DueDate)
+		if err != nil {
+			return models.TaskOut{}, ErrInvalidDate
+		}
+		task.DueDate = d
+	}
+	if dto.Recurrence != nil || dto.TimeZone != nil {
+		rule, zone := task.Recurrence, task.TimeZone
+		if dto.Recurrence != nil {
+			rule = *dto.Recurrence
+		}
+		if dto.TimeZone != nil {
+			zone = *dto.TimeZone
+		}
+		rule, zone, err := normalizeRecurrence(rule, zone)
+		if err != nil {
+			return models.TaskOut{}, err
+		}
+		// A new rule or zone starts a new series at this task.
+		if rule != "" && (rule != task.Recurrence || zone != task.TimeZone) {
+			start := task.DueDate
+			task.SeriesID, task.SeriesStart = id, &start
+		}
+		task.Recurrence, task.TimeZone = rule, zone
+	}
+	if dto.Priority != nil {
+		if !models.IsValidPriority(*dto.Priority) {
+			return models.TaskOut{}, ErrInvalidPriority
+		}
+		task.Priority = *dto.Priority
+	}
+	if dto.Labels != nil {
+		labels, err := normalizeLabels(*dto.Labels)
+		if err != nil {
+			return models.TaskOut{}, err
+		}
+		task.Labels = labels
+	}
+	if dto.Assignee != nil {
+		assignee, err := normalizeAssignee(*dto.Assignee)
+		if err != nil {
+			return models.TaskOut{}, err
+		}
+		task.Assignee = assignee
+	}
+	if dto.ParentID != nil && *dto.ParentID != task.ParentID {
+		if err := s.checkParent(id, *dto.ParentID); err != nil {
+			return models.TaskOut{}, err
+		}
+		task.ParentID = *dto.ParentID
+	}
+	if dto.BlockedBy != nil {
+		blockers, err := s.checkBlockers(id, *dto.BlockedBy)
+		if err != nil {
+			return models.TaskOut{}, err
+		}
+		task.BlockedBy = blockers
+	}
+	if models.IsDone(task.Status) && s.hasOpenChild(id) {
+		return models.TaskOut{}, ErrOpenSubtasks
+	}
+	if task.Status != wasStatus && startsWork(task.Status) && s.hasOpenBlocker(task.BlockedBy) {
+		return models.TaskOut{}, ErrBlocked
+	}
+	task.Version++
+	task.UpdatedAt = time.Now()
+	s.put(task)
+	s.reopenAncestors(task)
+	if models.IsDone(task.Status) && !models.IsDone(wasStatus) {
+		if due, ok := nextDue(task.Recurrence, task.TimeZone, task.SeriesStart, task.DueDate); ok && !s.hasOccurrence(task.SeriesID, due) {
+			s.addOccurrence(task, due, task.UpdatedAt)
+		}
+	}
+	return task, nil
+}
+
+func (s *MemoryTaskService) Delete(ctx context.Context, id string, version int64, cascade bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.remove(id, version, cascade); err != nil {
+		return err
+	}
+	slog.DebugContext(ctx, "task deleted", "task_id", id, "cascade", cascade)
+	return nil
+}
+
+// remove deletes task id, and its subtree if cascade is set. Callers hold
+// s.mu.
+func (s *MemoryTaskService) remove(id string, version int64, cascade bool) error {
+	task, ok := s.tasks[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if version != AnyVersion && version != task.Version {
+		return ErrVersionMismatch
+	}
+	sub := s.descendants(id)
+	if len(sub) > 0 && !cascade {
+		return ErrHasSubtasks
+	}
+	s.drop(id)
+	for _, t := range sub {
+		s.drop(t.ID)
+	}
+	s.dropBlockers(time.Now())
+	return nil
+}
+
+// Batch applies ops in order under one lock, so no reader sees part of an
+// atomic batch. A failed atomic batch is undone by restoring the tasks as
+// they were before it.
+func (s *MemoryTaskService) Batch(ctx context.Context, ops []BatchOp, atomic bool) ([]BatchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !atomic {
+		results, _ := runBatch(ops, false, s.apply)
+		slog.DebugContext(ctx, "batch applied", "operations", len(ops), "atomic", false)
+		return results, nil
+	}
+	tasks, seq := maps.Clone(s.tasks), s.seq
+	s.pending = []TaskEvent{}
+	results, err := runBatch(ops, true, s.apply)
+	events := s.pending
+	s.pending = nil
+	if err != nil {
+		s.tasks, s.seq = tasks, seq
+		return nil, err
+	}
+	for _, ev := range events {
+		s.events.Publish(ev)
+	}
+	slog.DebugContext(ctx, "batch applied", "operations", len(ops), "atomic", true)
+	return results, nil
+}
+
+// apply runs one batch operation. Callers hold s.mu.
+func (s *MemoryTaskService) apply(op BatchOp) (models.TaskOut, error) {
+	switch op.Op {
+	case models.BatchCreate:
+		return s.create(op.Create)
+	case models.BatchUpdate:
+		return s.update(op.ID, op.Update, op.Version)
+	default:
+		return models.TaskOut{}, s.remove(op.ID, op.Version, op.Cascade)
+	}
+}
+
+func (s *MemoryTaskService) CountByStatus(ctx context.Context) (map[models.TaskStatus]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	counts := make(map[models.TaskStatus]int64)
+	for _, t := range s.tasks {
+		counts[t.Status]++
+	}
+	return counts, nil
+}
+
+// ScheduleOccurrences extends every series up to until.
+func (s *MemoryTaskService) ScheduleOccurrences(ctx context.Context, until time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	latest := make(map[string]models.TaskOut)
+	for _, t := range s.tasks {
+		l, ok := latest[t.SeriesID]
+		if t.SeriesID != "" && (!ok || t.DueDate.After(l.DueDate) || t.DueDate.Equal(l.DueDate) && compareIDs(t.ID, l.ID) > 0) {
+			latest[t.SeriesID] = t
+		}
+	}
+	series := slices.SortedFunc(maps.Values(latest), func(a, b models.TaskOut) int { return compareIDs(a.ID, b.ID) })
+	now := time.Now()
+	created := 0
+	for _, t := range series {
+		for range maxScheduled {
+			due, ok := nextDue(t.Recurrence, t.TimeZone, t.SeriesStart, t.DueDate)
+			if !ok || due.After(until) {
+				break
+			}
+			t = s.addOccurrence(t, due, now)
+			created++
+		}
+	}
+	return created, nil
+}
+
+func (s *MemoryTaskService) hasOccurrence(series string, due time.Time) bool {
+	for _, t := range s.tasks {
+		if t.SeriesID == series && t.DueDate.Equal(due) {
+			return true
+		}
+	}
+	return false
+}
+
+// addOccurrence creates the task due at due that follows t in its series.
+// It starts in the workflow's first initial status and takes everything
+// else but its blockers from t. Callers hold s.mu.
+func (s *MemoryTaskService) addOccurrence(t models.TaskOut, due, now time.Time) models.TaskOut {
+	s.seq++
+	next := models.TaskOut{
+		ID:          strconv.FormatInt(s.seq, 10),
+		Title:       t.Title,
+		Description: t.Description,
+		DueDate:     due,
+		Status:      models.CurrentWorkflow().InitialStatuses()[0],
+		ParentID:    t.ParentID,
+		Priority:    t.Priority,
+		Labels:      slices.Clone(t.Labels),
+		Assignee:    t.Assignee,
+		Recurrence:  t.Recurrence,
+		TimeZone:    t.TimeZone,
+		SeriesID:    t.SeriesID,
+		SeriesStart: t.SeriesStart,
+		Version:     1,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	s.put(next)
+	s.reopenAncestors(next)
+	return next
+}
+
+// Children returns the direct subtasks of id in creation order.
+func (s *MemoryTaskService) Children(ctx context.Context, id string) ([]models.TaskOut, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.tasks[id]; !ok {
+		return nil, ErrNotFound
+	}
+	children := []models.TaskOut{}
+	for _, t := range s.tasks {
+		if t.ParentID == id {
+			children = append(children, t)
+		}
+	}
+	slices.SortFunc(children, func(a, b models.TaskOut) int { return compareIDs(a.ID, b.ID) })
+	return children, nil
+}
+
+func (s *MemoryTaskService) Tree(ctx context.Context, id string) (models.TaskNode, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	root, ok := s.tasks[id]
+	if !ok {
+		return models.TaskNode{}, ErrNotFound
+	}
+	return buildTree(root, s.descendants(id)), nil
+}
+
+// Blockers returns every task id transitively waits on, by ID.
+func (s *MemoryTaskService) Blockers(ctx context.Context, id string) ([]models.TaskOut, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	task, ok := s.tasks[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	out := []models.TaskOut{}
+	for b := range s.blockerClosure(task.BlockedBy) {
+		out = append(out, s.tasks[b])
+	}
+	slices.SortFunc(out, func(a, b models.TaskOut) int { return compareIDs(a.ID, b.ID) })
+	return out, nil
+}
+
+// blockerClosure collects ids and everything they transitively wait on.
+// Callers hold s.mu.
+func (s *MemoryTaskService) blockerClosure(ids []string) map[string]bool {
+	seen := make(map[string]bool)
+	ids = slices.Clone(ids)
+	for len(ids) > 0 {
+		id := ids[len(ids)-1]
+		ids = ids[:len(ids)-1]
+		if t, ok := s.tasks[id]; ok && !seen[id] {
+			seen[id] = true
+			ids = append(ids, t.BlockedBy...)
+		}
+	}
+	return seen
+}
+
+// checkBlockers vets blockers as the new BlockedBy of id ("" for a task
+// not yet created) and returns them deduplicated. Callers hold s.mu.
+func (s *MemoryTaskService) checkBlockers(id string, blockers []string) ([]string, error) {
+	var out []string
+	for _, b := range blockers {
+		if _, ok := s.tasks[b]; !ok {
+			return nil, ErrInvalidBlocker
+		}
+		if !slices.Contains(out, b) {
+			out = append(out, b)
+		}
+	}
+	if id != "" && s.blockerClosure(out)[id] {
+		return nil, ErrDependencyCycle
+	}
+	return out, nil
+}
+
+func (s *MemoryTaskService) hasOpenBlocker(blockers []string) bool {
+	for _, b := range blockers {
+		if !models.IsDone(s.tasks[b].Status) {
+			return true
+		}
+	}
+	return false
+}
+
+// dropBlockers removes edges to tasks that no longer exist. Callers hold
+// s.mu.
+func (s *MemoryTaskService) dropBlockers(now time.Time) {
+	for _, t := range s.tasks {
+		kept := slices.DeleteFunc(slices.Clone(t.BlockedBy), func(b string) bool {
+			_, ok := s.tasks[b]
+			return !ok
+		})
+		if len(kept) != len(t.BlockedBy) {
+			t.BlockedBy = kept
+			t.Version++
+			t.UpdatedAt = now
+			s.put(t)
+		}
+	}
+}
+
+// descendants lists the whole subtree below id, in creation order. Callers
+// hold s.mu.
+func (s *MemoryTaskService) descendants(id string) []models.TaskOut {
+	var out []models.TaskOut
+	for _, t := range s.tasks {
+		for p := t.ParentID; p != ""; p = s.tasks[p].ParentID {
+			if p == id {
+				out = append(out, t)
+				break
+			}
+		}
+	}
+	slices.SortFunc(out, func(a, b models.TaskOut) int { return compareIDs(a.ID, b.ID) })
+	return out
+}
+
+// checkParent vets moving id under parent. Callers hold s.mu.
+func (s *MemoryTaskService) checkParent(id, parent string) error {
+	if parent == "" {
+		return nil
+	}
+	if _, ok := s.tasks[parent]; !ok {
+		return ErrInvalidParent
+	}
+	for p := parent; p != ""; p = s.tasks[p].ParentID {
+		if p == id {
+			return ErrParentCycle
+		}
+	}
+	return nil
+}
+
+func (s *MemoryTaskService) hasOpenChild(id string) bool {
+	for _, t := range s.tasks {
+		if t.ParentID == id && !models.IsDone(t.Status) {
+			return true
+		}
+	}
+	return false
+}
+
+// reopenAncestors keeps "done means every subtask is done" true after t was
+// written: while t is open, each done ancestor goes back to the workflow's
+// reopen status, whatever its transitions say. Callers hold s.mu.
+func (s *MemoryTaskService) reopenAncestors(t models.TaskOut) {
+	if models.IsDone(t.Status) {
+		return
+	}
+	for p := t.ParentID; p != ""; {
+		parent := s.tasks[p]
+		if !models.IsDone(parent.Status) {
+			return
+		}
+		parent.Status = models.CurrentWorkflow().Reopen
+		parent.Version++
+		parent.UpdatedAt = t.UpdatedAt
+		s.put(parent)
+		p = parent.ParentID
+	}
+}
+
+// put stores t and announces it. Callers hold s.mu.
+func (s *MemoryTaskService) put(t models.TaskOut) {
+	ev := TaskEvent{Type: EventCreated, Task: t}
+	if prev, ok := s.tasks[t.ID]; ok {
+		ev.Type, ev.Before = EventUpdated, &prev
+	}
+	s.tasks[t.ID] = t
+	s.emit(ev)
+}
+
+// drop removes task id and announces it. Callers hold s.mu.
+func (s *MemoryTaskService) drop(id string) {
+	t := s.tasks[id]
+	delete(s.tasks, id)
+	s.emit(TaskEvent{Type: EventDeleted, Task: t})
+}
+
+// emit publishes a change, or holds it back while an atomic batch is open.
+func (s *MemoryTaskService) emit(ev TaskEvent) {
+	if s.pending != nil {
+		s.pending = append(s.pending, ev)
+		return
+	}
+	s.events.Publish(ev)
+}
+
+// compareIDs orders IDs of equal length lexically and shorter ones first,
+// which is numeric order for sequence IDs and byte order for ObjectID hex.
+func compareIDs(a, b string) int {
+	if c := cmp.Compare(len(a), len(b)); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+// compareTasks orders by the query's sort field, then by ID, honouring the
+// direction for both so the order is total and cursors are stable.
+func compareTasks(a, b models.TaskOut, q models.TaskQuery) int {
+	var c int
+	switch q.SortBy {
+	case "title":
+		c = strings.Compare(a.Title, b.Title)
+	case "description":
+		c = strings.Compare(a.Description, b.Description)
+	case "status":
+		c = strings.Compare(string(a.Status), string(b.Status))
+	case "due_date":
+		c = a.DueDate.Compare(b.DueDate)
+	case "created_at":
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	case "updated_at":
+		c = a.UpdatedAt.Compare(b.UpdatedAt)
+	}
+	if c == 0 {
+		c = compareIDs(a.ID, b.ID)
+	}
+	if q.SortDesc {
+		return -c
+	}
+	return c
+}
+
+func matchesQuery(t models.TaskOut, q models.TaskQuery) bool {
+	if len(q.Statuses) > 0 && !slices.Contains(q.Statuses, t.Status) {
+		return false
+	}
+	if q.Title != "" && !strings.Contains(strings.ToLower(t.Title), strings.ToLower(q.Title)) {
+		return false
+	}
+	if len(q.Priorities) > 0 && !slices.Contains(q.Priorities, t.Priority) {
+		return false
+	}
+	for _, l := range q.Labels {
+		if !slices.Contains(t.Labels, l) {
+			return false
+		}
+	}
+	if q.Assignee != "" && t.Assignee != q.Assignee {
+		return false
+	}
+	return inRange(t.DueDate, q.DueFrom, q.DueTo) &&
+		inRange(t.CreatedAt, q.CreatedFrom, q.CreatedTo) &&
+		inRange(t.UpdatedAt, q.UpdatedFrom, q.UpdatedTo)
+}
+
+func inRange(t time.Time, from, to *time.Time) bool {
+	if from != nil && t.Before(*from) {
+		return false
+	}
+	if to != nil && t.After(*to) {
+		return false
+	}
+	return true
+}
+
+// cursorPivot rebuilds the last task of the previous page from a cursor.
+func cursorPivot(q models.TaskQuery) (models.TaskOut, error) {
+	c, err := decodeCursor(q)
+	if err != nil {
+		return models.TaskOut{}, err
+	}
+	pivot := models.TaskOut{ID: c.ID}
+	switch q.SortBy {
+	case "title":
+		pivot.Title = c.Value
+	case "description":
+		pivot.Description = c.Value
+	case "status":
+		pivot.Status = models.TaskStatus(c.Value)
+	case "due_date", "created_at", "updated_at":
+		t, err := time.Parse(time.RFC3339Nano, c.Value)
+		if err != nil {
+			return models.TaskOut{}, errBadCursor
+		}
+		pivot.DueDate, pivot.CreatedAt, pivot.UpdatedAt = t, t, t
+	}
+	return pivot, nil
+}
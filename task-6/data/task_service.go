@@ -1,8 +1,12 @@
 package data
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"log/slog"
+	"maps"
+	"slices"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -14,19 +18,25 @@ import (
 )
 
 var (
-	ErrNotFound      = errors.New("task not found")
-	ErrInvalidStatus = errors.New("invalid task status")
-	ErrInvalidDate   = errors.New("invalid due date (use RFC3339)")
+	ErrNotFound        = errors.New("task not found")
+	ErrInvalidStatus   = errors.New("invalid task status")
+	ErrInvalidDate     = errors.New("invalid due date (use RFC3339)")
+	ErrVersionMismatch = errors.New("task has been modified since it was read")
 )
 
 type TaskService struct {
-	col *mongo.Collection
+	col    *mongo.Collection
+	events *EventHub
 }
 
 func NewTaskService(col *mongo.Collection) *TaskService {
-	return &TaskService{col: col}
+	return &TaskService{col: col, events: NewEventHub(EventReplaySize)}
 }
 
+// Events carries the changes made through this service; writes by other
+// processes sharing the collection don't show up.
+func (s *TaskService) Events() *EventHub { return s.events }
+
 const defaultTimeout = 5 * time.Second
 
 func parseObjectID(id string) (primitive.ObjectID, error) {
@@ -35,39 +45,103 @@ func parseObjectID(id string) (primitive.ObjectID, error) {
 
 func toOut(doc models.TaskDB) models.TaskOut {
 	oid, _ := doc.ID.(primitive.ObjectID)
+	var parent string
+	if p, ok := doc.ParentID.(primitive.ObjectID); ok {
+		parent = p.Hex()
+	}
+	var blockers []string
+	for _, b := range doc.BlockedBy {
+		blockers = append(blockers, b.Hex())
+	}
+	var series string
+	if id, ok := doc.SeriesID.(primitive.ObjectID); ok {
+		series = id.Hex()
+	}
+	priority := doc.Priority
+	if priority == "" {
+		priority = models.DefaultPriority
+	}
 	return models.TaskOut{
 		ID:          oid.Hex(),
 		Title:       doc.Title,
 		Description: doc.Description,
 		DueDate:     doc.DueDate,
 		Status:      doc.Status,
+		ParentID:    parent,
+		BlockedBy:   blockers,
+		Priority:    priority,
+		Labels:      doc.Labels,
+		Assignee:    doc.Assignee,
+		Recurrence:  doc.Recurrence,
+		TimeZone:    doc.TimeZone,
+		SeriesID:    series,
+		SeriesStart: doc.SeriesStart,
+		Version:     doc.Version,
 		CreatedAt:   doc.CreatedAt,
 		UpdatedAt:   doc.UpdatedAt,
 	}
 }
 
-func (s *TaskService) List(ctx context.Context) ([]models.TaskOut, error) {
+// List returns one page of the tasks matching q, in q's sort order.
+func (s *TaskService) List(ctx context.Context, q models.TaskQuery) (models.TaskPage, error) {
+	q, err := normalizeQuery(q)
+	if err != nil {
+		return models.TaskPage{}, err
+	}
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
-	cur, err := s.col.Find(ctx, bson.D{}, nil)
+	filter := queryFilter(q)
+	total, err := s.col.CountDocuments(ctx, filter)
 	if err != nil {
-		return nil, err
+		return models.TaskPage{}, err
+	}
+
+	pageFilter := filter
+	offset := int64(q.Offset)
+	if q.Cursor != "" {
+		after, err := cursorFilter(q)
+		if err != nil {
+			return models.TaskPage{}, err
+		}
+		pageFilter = bson.M{"$and": bson.A{filter, after}}
+		remaining, err := s.col.CountDocuments(ctx, pageFilter)
+		if err != nil {
+			return models.TaskPage{}, err
+		}
+		offset = total - remaining
+	}
+
+	// Fetch one extra document to learn whether another page follows.
+	opts := options.Find().SetSort(querySort(q)).SetLimit(int64(q.Limit) + 1)
+	if q.Cursor == "" {
+		opts.SetSkip(offset)
+	}
+	cur, err := s.col.Find(ctx, pageFilter, opts)
+	if err != nil {
+		return models.TaskPage{}, err
 	}
 	defer cur.Close(ctx)
 
-	var results []models.TaskOut
+	results := []models.TaskOut{}
 	for cur.Next(ctx) {
 		var t models.TaskDB
 		if err := cur.Decode(&t); err != nil {
-			return nil, err
+			return models.TaskPage{}, err
 		}
 		results = append(results, toOut(t))
 	}
 	if err := cur.Err(); err != nil {
-		return nil, err
+		return models.TaskPage{}, err
 	}
-	return results, nil
+
+	page := models.TaskPage{Total: total, Limit: q.Limit, Offset: int(offset)}
+	if len(results) > q.Limit {
+		results = results[:q.Limit]
+		page.NextCursor = encodeCursor(q, results[len(results)-1])
+	}
+	page.Data = results
+	return page, nil
 }
 
 func (s *TaskService) Get(ctx context.Context, id string) (models.TaskOut, error) {
@@ -89,13 +163,29 @@ func (s *TaskService) Get(ctx context.Context, id string) (models.TaskOut, error
 }
 
 func (s *TaskService) Create(ctx context.Context, dto models.CreateTaskDTO) (models.TaskOut, error) {
-	if !models.IsValidStatus(dto.Status) {
-		return models.TaskOut{}, ErrInvalidStatus
+	if err := checkInitial(dto.Status); err != nil {
+		return models.TaskOut{}, err
 	}
 	due, err := time.Parse(time.RFC3339, dto.DueDate)
 	if err != nil {
 		return models.TaskOut{}, ErrInvalidDate
 	}
+	priority, err := createPriority(dto.Priority)
+	if err != nil {
+		return models.TaskOut{}, err
+	}
+	labels, err := normalizeLabels(dto.Labels)
+	if err != nil {
+		return models.TaskOut{}, err
+	}
+	assignee, err := normalizeAssignee(dto.Assignee)
+	if err != nil {
+		return models.TaskOut{}, err
+	}
+	recurrence, zone, err := normalizeRecurrence(dto.Recurrence, dto.TimeZone)
+	if err != nil {
+		return models.TaskOut{}, err
+	}
 
 	now := time.Now()
 	doc := models.TaskDB{
@@ -103,22 +193,70 @@ func (s *TaskService) Create(ctx context.Context, dto models.CreateTaskDTO) (mod
 		Description: dto.Description,
 		DueDate:     due,
 		Status:      dto.Status,
+		Priority:    priority,
+		Labels:      labels,
+		Assignee:    assignee,
+		Recurrence:  recurrence,
+		TimeZone:    zone,
+		Version:     1,
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
+	if recurrence != "" {
+		oid := primitive.NewObjectID()
+		doc.ID, doc.SeriesID, doc.SeriesStart = oid, oid, &due
+	}
 
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
+	if dto.ParentID != "" {
+		poid, err := parseObjectID(dto.ParentID)
+		if err != nil {
+			return models.TaskOut{}, ErrInvalidParent
+		}
+		if err := s.checkParent(ctx, primitive.NilObjectID, poid); err != nil {
+			return models.TaskOut{}, err
+		}
+		doc.ParentID = poid
+	}
+	if doc.BlockedBy, err = s.checkBlockers(ctx, primitive.NilObjectID, dto.BlockedBy); err != nil {
+		return models.TaskOut{}, err
+	}
+	if startsWork(dto.Status) {
+		if err := s.checkUnblocked(ctx, doc.BlockedBy); err != nil {
+			return models.TaskOut{}, err
+		}
+	}
+
 	res, err := s.col.InsertOne(ctx, doc)
 	if err != nil {
 		return models.TaskOut{}, err
 	}
 	doc.ID = res.InsertedID
-	return toOut(doc), nil
+	if doc.ParentID != nil {
+		// A parent deleted since checkParent would leave the task orphaned;
+		// take it back out.
+		n, err := s.col.CountDocuments(ctx, bson.M{"_id": doc.ParentID}, options.Count().SetLimit(1))
+		if err == nil && n == 0 {
+			if _, err = s.col.DeleteOne(ctx, bson.M{"_id": doc.ID}); err == nil {
+				err = ErrInvalidParent
+			}
+		}
+		if err != nil {
+			return models.TaskOut{}, err
+		}
+	}
+	s.events.publishCtx(ctx, TaskEvent{Type: EventCreated, Task: toOut(doc)})
+	if err := s.reopenAncestors(ctx, doc); err != nil {
+		return models.TaskOut{}, err
+	}
+	task := toOut(doc)
+	slog.DebugContext(ctx, "task created", "task_id", task.ID)
+	return task, nil
 }
 
-func (s *TaskService) Update(ctx context.Context, id string, dto models.UpdateTaskDTO) (models.TaskOut, error) {
+func (s *TaskService) Update(ctx context.Context, id string, dto models.UpdateTaskDTO, version int64) (models.TaskOut, error) {
 	oid, err := parseObjectID(id)
 	if err != nil {
 		return models.TaskOut{}, ErrNotFound
@@ -144,28 +282,209 @@ func (s *TaskService) Update(ctx context.Context, id string, dto models.UpdateTa
 		}
 		set["due_date"] = d
 	}
+	unset := bson.M{}
+	if dto.Priority != nil {
+		if !models.IsValidPriority(*dto.Priority) {
+			return models.TaskOut{}, ErrInvalidPriority
+		}
+		set["priority"] = *dto.Priority
+	}
+	if dto.Labels != nil {
+		labels, err := normalizeLabels(*dto.Labels)
+		if err != nil {
+			return models.TaskOut{}, err
+		}
+		if len(labels) == 0 {
+			unset["labels"] = ""
+		} else {
+			set["labels"] = labels
+		}
+	}
+	if dto.Assignee != nil {
+		assignee, err := normalizeAssignee(*dto.Assignee)
+		if err != nil {
+			return models.TaskOut{}, err
+		}
+		if assignee == "" {
+			unset["assignee"] = ""
+		} else {
+			set["assignee"] = assignee
+		}
+	}
 
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
-	after := options.After
-	var updated models.TaskDB
-	err = s.col.FindOneAndUpdate(ctx,
-		bson.M{"_id": oid},
-		bson.M{"$set": set},
-		options.FindOneAndUpdate().SetReturnDocument(after),
-	).Decode(&updated)
-	
+	var parent primitive.ObjectID
+	if dto.ParentID != nil {
+		if *dto.ParentID == "" {
+			unset["parent_id"] = ""
+		} else {
+			if parent, err = parseObjectID(*dto.ParentID); err != nil {
+				return models.TaskOut{}, ErrInvalidParent
+			}
+			if err := s.checkParent(ctx, oid, parent); err != nil {
+				return models.TaskOut{}, err
+			}
+			set["parent_id"] = parent
+		}
+	}
+	var blockers []primitive.ObjectID
+	if dto.BlockedBy != nil {
+		if blockers, err = s.checkBlockers(ctx, oid, *dto.BlockedBy); err != nil {
+			return models.TaskOut{}, err
+		}
+		if len(blockers) == 0 {
+			unset["blocked_by"] = ""
+		} else {
+			set["blocked_by"] = blockers
+		}
+	}
+	// The write is pinned to the version of the task the checks below and
+	// the event's Before saw, and to the one a new parent or blocker is put
+	// back to. Without If-Match, a concurrent write just means checking
+	// again, as PatchTask does.
+	newEdges := !parent.IsZero() || len(blockers) > 0
+	var cur, updated models.TaskDB
+	for attempt := 0; ; attempt++ {
+		set, unset := maps.Clone(set), maps.Clone(unset) // fresh for each attempt
+		if err := s.col.FindOne(ctx, bson.M{"_id": oid}).Decode(&cur); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return models.TaskOut{}, ErrNotFound
+			}
+			return models.TaskOut{}, err
+		}
+		if version != AnyVersion && cur.Version != version {
+			return models.TaskOut{}, ErrVersionMismatch
+		}
+		pinned := cur.Version
+		if dto.Recurrence != nil || dto.TimeZone != nil {
+			rule, zone := cur.Recurrence, cur.TimeZone
+			if dto.Recurrence != nil {
+				rule = *dto.Recurrence
+			}
+			if dto.TimeZone != nil {
+				zone = *dto.TimeZone
+			}
+			rule, zone, err := normalizeRecurrence(rule, zone)
+			if err != nil {
+				return models.TaskOut{}, err
+			}
+			setOrUnset(set, unset, "recurrence", rule)
+			setOrUnset(set, unset, "time_zone", zone)
+			// A new rule or zone starts a new series at this task.
+			if rule != "" && (rule != cur.Recurrence || zone != cur.TimeZone) {
+				start := cur.DueDate
+				if d, ok := set["due_date"].(time.Time); ok {
+					start = d
+				}
+				set["series_id"], set["series_start"] = oid, start
+			}
+		}
+		if dto.Status != nil {
+			if err := checkTransition(cur.Status, *dto.Status); err != nil {
+				return models.TaskOut{}, err
+			}
+			waitOn := blockers
+			if dto.BlockedBy == nil {
+				waitOn = cur.BlockedBy
+			}
+			if cur.Status != *dto.Status && startsWork(*dto.Status) {
+				if err := s.checkUnblocked(ctx, waitOn); err != nil {
+					return models.TaskOut{}, err
+				}
+			}
+		}
+		if dto.Status != nil && models.IsDone(*dto.Status) {
+			open, err := s.col.CountDocuments(ctx, bson.M{"parent_id": oid, "status": notDone()}, options.Count().SetLimit(1))
+			if err != nil {
+				return models.TaskOut{}, err
+			}
+			if open > 0 {
+				return models.TaskOut{}, ErrOpenSubtasks
+			}
+		}
 
-	if err != nil {
+		update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+		if len(unset) > 0 {
+			update["$unset"] = unset
+		}
+		err = s.col.FindOneAndUpdate(ctx,
+			versionFilter(oid, pinned),
+			update,
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updated)
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return models.TaskOut{}, ErrNotFound
+			err = s.missOrConflict(ctx, oid, pinned)
+			if errors.Is(err, ErrVersionMismatch) && version == AnyVersion && attempt < patchRetries {
+				continue
+			}
 		}
+		if err != nil {
+			return models.TaskOut{}, err
+		}
+		break
+	}
+	if newEdges {
+		// checkParent and checkBlockers ran before the write, so they could
+		// miss a concurrent edit that closes a cycle along with this one.
+		// Now both edges are stored, one of the two writers sees it.
+		if err := s.recheckEdges(ctx, oid, parent, blockers); err != nil {
+			if perr := s.putBack(ctx, oid, cur, updated.Version); perr != nil {
+				return models.TaskOut{}, perr
+			}
+			return models.TaskOut{}, err
+		}
+	}
+	s.events.publishCtx(ctx, updatedEvent(cur, updated))
+	if err := s.reopenAncestors(ctx, updated); err != nil {
 		return models.TaskOut{}, err
 	}
-	return toOut(updated), nil
+	if models.IsDone(updated.Status) && dto.Status != nil && !models.IsDone(cur.Status) {
+		if due, ok := nextDue(updated.Recurrence, updated.TimeZone, updated.SeriesStart, updated.DueDate); ok {
+			if _, err := s.addOccurrence(ctx, updated, due, updated.UpdatedAt); err != nil {
+				return models.TaskOut{}, err
+			}
+		}
+	}
+	task := toOut(updated)
+	slog.DebugContext(ctx, "task updated", "task_id", task.ID, "version", task.Version)
+	return task, nil
+}
+
+// recheckEdges vets the parent and blockers an update has just stored for
+// oid, as checkParent and checkBlockers did before it.
+func (s *TaskService) recheckEdges(ctx context.Context, oid, parent primitive.ObjectID, blockers []primitive.ObjectID) error {
+	if !parent.IsZero() {
+		if err := s.checkParent(ctx, oid, parent); err != nil {
+			return err
+		}
+	}
+	return s.vetBlockers(ctx, oid, blockers)
+}
+
+// putBack restores prev over the write that left oid at version written,
+// unless another write has changed it since and run its own checks.
+func (s *TaskService) putBack(ctx context.Context, oid primitive.ObjectID, prev models.TaskDB, written int64) error {
+	prev.Version = written + 1
+	prev.UpdatedAt = time.Now()
+	_, err := s.col.ReplaceOne(ctx, versionFilter(oid, written), prev)
+	return err
+}
+
+func setOrUnset(set, unset bson.M, key, value string) {
+	if value == "" {
+		unset[key] = ""
+	} else {
+		set[key] = value
+	}
 }
 
-func (s *TaskService) Delete(ctx context.Context, id string) error {
+// Delete removes the task and, with cascade, its subtree. The root goes
+// first so a version conflict leaves everything in place. Edges to the
+// removed tasks are dropped from their dependents. Where the server has
+// transactions this all lands at once; subtasks created under the removed
+// tasks meanwhile are dealt with after.
+func (s *TaskService) Delete(ctx context.Context, id string, version int64, cascade bool) error {
 	oid, err := parseObjectID(id)
 	if err != nil {
 		return ErrNotFound
@@ -173,12 +492,615 @@ func (s *TaskService) Delete(ctx context.Context, id string) error {
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
-	res, err := s.col.DeleteOne(ctx, bson.M{"_id": oid})
+	var ids bson.A
+	del := func(ctx context.Context) error {
+		var err error
+		ids, err = s.deleteTree(ctx, oid, version, cascade)
+		return err
+	}
+	if mongo.SessionFromContext(ctx) != nil {
+		err = del(ctx) // already inside an atomic batch
+	} else if err = s.transaction(ctx, del); errors.Is(err, ErrAtomicUnsupported) {
+		err = del(ctx)
+	}
 	if err != nil {
 		return err
 	}
-	if res.DeletedCount == 0 {
-		return ErrNotFound
+	if err := s.sweepOrphans(ctx, ids, cascade); err != nil {
+		return err
+	}
+	slog.DebugContext(ctx, "task deleted", "task_id", id, "cascade", cascade)
+	return nil
+}
+
+// deleteTree does the work of Delete and returns the ids it removed.
+func (s *TaskService) deleteTree(ctx context.Context, oid primitive.ObjectID, version int64, cascade bool) (bson.A, error) {
+	sub, err := s.descendants(ctx, oid)
+	if err != nil {
+		return nil, err
+	}
+	if len(sub) > 0 && !cascade {
+		return nil, ErrHasSubtasks
+	}
+
+	var root models.TaskDB
+	err = s.col.FindOneAndDelete(ctx, versionFilter(oid, version)).Decode(&root)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, s.missOrConflict(ctx, oid, version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.events.publishCtx(ctx, TaskEvent{Type: EventDeleted, Task: toOut(root)})
+	ids := bson.A{oid}
+	for _, t := range sub {
+		ids = append(ids, t.ID)
+	}
+	if len(sub) > 0 {
+		if _, err := s.col.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids[1:]}}); err != nil {
+			return nil, err
+		}
+		for _, t := range sub {
+			s.events.publishCtx(ctx, TaskEvent{Type: EventDeleted, Task: toOut(t)})
+		}
+	}
+
+	blocked := bson.M{"blocked_by": bson.M{"$in": ids}}
+	deps, err := s.col.Distinct(ctx, "_id", blocked)
+	if err != nil || len(deps) == 0 {
+		return ids, err
+	}
+	_, err = s.col.UpdateMany(ctx, blocked,
+		bson.M{"$pull": bson.M{"blocked_by": bson.M{"$in": ids}}, "$set": bson.M{"updated_at": time.Now()}, "$inc": bson.M{"version": 1}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := s.col.Find(ctx, bson.M{"_id": bson.M{"$in": deps}})
+	if err != nil {
+		return nil, err
+	}
+	var docs []models.TaskDB
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	for _, d := range docs {
+		s.events.publishCtx(ctx, TaskEvent{Type: EventUpdated, Task: toOut(d)})
+	}
+	return ids, nil
+}
+
+// sweepOrphans deals with subtasks created under the deleted tasks ids while
+// the delete ran, too late for it to see them: with cascade they go too,
+// otherwise they are detached and become top-level tasks.
+func (s *TaskService) sweepOrphans(ctx context.Context, ids bson.A, cascade bool) error {
+	for len(ids) > 0 {
+		cur, err := s.col.Find(ctx, bson.M{"parent_id": bson.M{"$in": ids}})
+		if err != nil {
+			return err
+		}
+		var orphans []models.TaskDB
+		if err := cur.All(ctx, &orphans); err != nil {
+			return err
+		}
+		var next bson.A
+		for _, o := range orphans {
+			oid, _ := o.ID.(primitive.ObjectID)
+			if cascade {
+				gone, err := s.deleteTree(ctx, oid, AnyVersion, true)
+				if err != nil && !errors.Is(err, ErrNotFound) {
+					return err
+				}
+				next = append(next, gone...)
+				continue
+			}
+			var detached models.TaskDB
+			err := s.col.FindOneAndUpdate(ctx,
+				bson.M{"_id": oid, "parent_id": o.ParentID},
+				bson.M{"$unset": bson.M{"parent_id": ""}, "$set": bson.M{"updated_at": time.Now()}, "$inc": bson.M{"version": 1}},
+				options.FindOneAndUpdate().SetReturnDocument(options.After),
+			).Decode(&detached)
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			s.events.publishCtx(ctx, updatedEvent(o, detached))
+		}
+		ids = next
+	}
+	return nil
+}
+
+// Batch applies ops in order. An atomic batch runs in one transaction,
+// which MongoDB only offers on a replica set or sharded cluster.
+func (s *TaskService) Batch(ctx context.Context, ops []BatchOp, atomic bool) ([]BatchResult, error) {
+	if !atomic {
+		results, _ := runBatch(ops, false, func(op BatchOp) (models.TaskOut, error) { return s.apply(ctx, op) })
+		slog.DebugContext(ctx, "batch applied", "operations", len(ops), "atomic", false)
+		return results, nil
+	}
+	var results []BatchResult
+	err := s.transaction(ctx, func(ctx context.Context) error {
+		var err error
+		results, err = runBatch(ops, true, func(op BatchOp) (models.TaskOut, error) { return s.apply(ctx, op) })
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.DebugContext(ctx, "batch applied", "operations", len(ops), "atomic", true)
+	return results, nil
+}
+
+// transaction runs fn in a MongoDB transaction and publishes its events once
+// it commits. A standalone server has no transactions; then it fails with
+// ErrAtomicUnsupported before anything is written.
+func (s *TaskService) transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	sess, err := s.col.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer sess.EndSession(ctx)
+	var events []TaskEvent
+	_, err = sess.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		// Events wait for the commit; a retried transaction starts over.
+		events = events[:0]
+		return nil, fn(bufferEvents(sc, &events))
+	})
+	// IllegalOperation: the server is a standalone without transactions.
+	var se mongo.ServerError
+	if errors.As(err, &se) && se.HasErrorCode(20) {
+		return ErrAtomicUnsupported
+	}
+	if err != nil {
+		return err
+	}
+	for _, ev := range events {
+		s.events.Publish(ev)
+	}
+	return nil
+}
+
+// apply runs one batch operation.
+func (s *TaskService) apply(ctx context.Context, op BatchOp) (models.TaskOut, error) {
+	switch op.Op {
+	case models.BatchCreate:
+		return s.Create(ctx, op.Create)
+	case models.BatchUpdate:
+		return s.Update(ctx, op.ID, op.Update, op.Version)
+	default:
+		return models.TaskOut{}, s.Delete(ctx, op.ID, op.Version, op.Cascade)
+	}
+}
+
+// Children returns the direct subtasks of id in creation order.
+func (s *TaskService) Children(ctx context.Context, id string) ([]models.TaskOut, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	oid, _ := parseObjectID(id)
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	cur, err := s.col.Find(ctx, bson.M{"parent_id": oid}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var docs []models.TaskDB
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	children := make([]models.TaskOut, len(docs))
+	for i, d := range docs {
+		children[i] = toOut(d)
+	}
+	return children, nil
+}
+
+func (s *TaskService) Tree(ctx context.Context, id string) (models.TaskNode, error) {
+	root, err := s.Get(ctx, id)
+	if err != nil {
+		return models.TaskNode{}, err
+	}
+	oid, _ := parseObjectID(id)
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	sub, err := s.descendants(ctx, oid)
+	if err != nil {
+		return models.TaskNode{}, err
+	}
+	out := make([]models.TaskOut, len(sub))
+	for i, d := range sub {
+		out[i] = toOut(d)
+	}
+	return buildTree(root, out), nil
+}
+
+// descendants loads the whole subtree below oid in one $graphLookup, in
+// creation order.
+func (s *TaskService) descendants(ctx context.Context, oid primitive.ObjectID) ([]models.TaskDB, error) {
+	cur, err := s.col.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"_id": oid}}},
+		{{Key: "$graphLookup", Value: bson.M{
+			"from":             s.col.Name(),
+			"startWith":        "$_id",
+			"connectFromField": "_id",
+			"connectToField":   "parent_id",
+			"as":               "subtree",
+		}}},
+		{{Key: "$project", Value: bson.M{"subtree": 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res []struct {
+		Subtree []models.TaskDB `bson:"subtree"`
+	}
+	if err := cur.All(ctx, &res); err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, ErrNotFound
+	}
+	sub := res[0].Subtree
+	sortByID(sub)
+	return sub, nil
+}
+
+// Blockers returns every task id transitively waits on, in creation order.
+func (s *TaskService) Blockers(ctx context.Context, id string) ([]models.TaskOut, error) {
+	oid, err := parseObjectID(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var task models.TaskDB
+	if err := s.col.FindOne(ctx, bson.M{"_id": oid}).Decode(&task); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	docs, err := s.blockerClosure(ctx, task.BlockedBy)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]models.TaskOut, len(docs))
+	for i, d := range docs {
+		out[i] = toOut(d)
+	}
+	return out, nil
+}
+
+// blockerClosure loads ids and everything they transitively wait on in one
+// $graphLookup, in creation order.
+func (s *TaskService) blockerClosure(ctx context.Context, ids []primitive.ObjectID) ([]models.TaskDB, error) {
+	if len(ids) == 0 {
+		return []models.TaskDB{}, nil
+	}
+	cur, err := s.col.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"_id": bson.M{"$in": ids}}}},
+		{{Key: "$graphLookup", Value: bson.M{
+			"from":             s.col.Name(),
+			"startWith":        "$blocked_by",
+			"connectFromField": "blocked_by",
+			"connectToField":   "_id",
+			"as":               "upstream",
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res []struct {
+		models.TaskDB `bson:",inline"`
+		Upstream      []models.TaskDB `bson:"upstream"`
+	}
+	if err := cur.All(ctx, &res); err != nil {
+		return nil, err
+	}
+	seen := make(map[interface{}]bool)
+	out := []models.TaskDB{}
+	for _, r := range res {
+		for _, d := range append([]models.TaskDB{r.TaskDB}, r.Upstream...) {
+			if !seen[d.ID] {
+				seen[d.ID] = true
+				out = append(out, d)
+			}
+		}
+	}
+	sortByID(out)
+	return out, nil
+}
+
+// checkBlockers vets blockers as the new BlockedBy of oid (NilObjectID for a
+// task that doesn't exist yet) and returns them deduplicated.
+func (s *TaskService) checkBlockers(ctx context.Context, oid primitive.ObjectID, blockers []string) ([]primitive.ObjectID, error) {
+	var ids []primitive.ObjectID
+	for _, b := range blockers {
+		bid, err := parseObjectID(b)
+		if err != nil {
+			return nil, ErrInvalidBlocker
+		}
+		if !slices.Contains(ids, bid) {
+			ids = append(ids, bid)
+		}
+	}
+	if err := s.vetBlockers(ctx, oid, ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// vetBlockers checks that ids exist and that none of them waits on oid.
+func (s *TaskService) vetBlockers(ctx context.Context, oid primitive.ObjectID, ids []primitive.ObjectID) error {
+	closure, err := s.blockerClosure(ctx, ids)
+	if err != nil {
+		return err
+	}
+	found := make(map[interface{}]bool, len(closure))
+	for _, d := range closure {
+		found[d.ID] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			return ErrInvalidBlocker
+		}
+	}
+	if !oid.IsZero() && found[oid] {
+		return ErrDependencyCycle
+	}
+	return nil
+}
+
+// checkUnblocked fails with ErrBlocked while any of blockers is open.
+func (s *TaskService) checkUnblocked(ctx context.Context, blockers []primitive.ObjectID) error {
+	if len(blockers) == 0 {
+		return nil
+	}
+	open, err := s.col.CountDocuments(ctx, bson.M{"_id": bson.M{"$in": blockers}, "status": notDone()}, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if open > 0 {
+		return ErrBlocked
+	}
+	return nil
+}
+
+func sortByID(docs []models.TaskDB) {
+	slices.SortFunc(docs, func(a, b models.TaskDB) int {
+		x, _ := a.ID.(primitive.ObjectID)
+		y, _ := b.ID.(primitive.ObjectID)
+		return bytes.Compare(x[:], y[:])
+	})
+}
+
+// checkParent vets placing oid under parent; oid is NilObjectID for a task
+// that doesn't exist yet.
+func (s *TaskService) checkParent(ctx context.Context, oid, parent primitive.ObjectID) error {
+	if parent == oid {
+		return ErrParentCycle
+	}
+	n, err := s.col.CountDocuments(ctx, bson.M{"_id": parent}, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrInvalidParent
+	}
+	if oid.IsZero() {
+		return nil
+	}
+	sub, err := s.descendants(ctx, oid)
+	if err != nil {
+		return err
+	}
+	for _, t := range sub {
+		if t.ID == parent {
+			return ErrParentCycle
+		}
+	}
+	return nil
+}
+
+// updatedEvent announces a write that took prev to t.
+func updatedEvent(prev, t models.TaskDB) TaskEvent {
+	before := toOut(prev)
+	return TaskEvent{Type: EventUpdated, Task: toOut(t), Before: &before}
+}
+
+// reopenAncestors keeps "done means every subtask is done" true after t was
+// written: while t is open, each done ancestor goes back to the workflow's
+// reopen status, whatever its transitions say.
+func (s *TaskService) reopenAncestors(ctx context.Context, t models.TaskDB) error {
+	if models.IsDone(t.Status) {
+		return nil
+	}
+	wf := models.CurrentWorkflow()
+	for p := t.ParentID; p != nil; {
+		var prev models.TaskDB
+		err := s.col.FindOneAndUpdate(ctx,
+			bson.M{"_id": p, "status": bson.M{"$in": wf.InCategory(models.CategoryDone)}},
+			bson.M{"$set": bson.M{"status": wf.Reopen, "updated_at": t.UpdatedAt}, "$inc": bson.M{"version": 1}},
+		).Decode(&prev)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		parent := prev
+		parent.Status, parent.UpdatedAt, parent.Version = wf.Reopen, t.UpdatedAt, prev.Version+1
+		s.events.publishCtx(ctx, updatedEvent(prev, parent))
+		p = parent.ParentID
+	}
+	return nil
+}
+
+// versionFilter matches the task only while it is still at version. Tasks
+// stored before versioning have no field and count as version 0.
+func versionFilter(oid primitive.ObjectID, version int64) bson.M {
+	filter := bson.M{"_id": oid}
+	switch version {
+	case AnyVersion:
+	case 0:
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	default:
+		filter["version"] = version
+	}
+	return filter
+}
+
+// ScheduleOccurrences extends every series up to until.
+func (s *TaskService) ScheduleOccurrences(ctx context.Context, until time.Time) (int, error) {
+	cur, err := s.col.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"series_id": bson.M{"$exists": true}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "series_id", Value: 1}, {Key: "due_date", Value: -1}, {Key: "_id", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$series_id", "latest": bson.M{"$first": "$$ROOT"}}}},
+		{{Key: "$match", Value: bson.M{"latest.recurrence": bson.M{"$exists": true}}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var res []struct {
+		Latest models.TaskDB `bson:"latest"`
+	}
+	if err := cur.All(ctx, &res); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	created := 0
+	for _, r := range res {
+		t := r.Latest
+		for range maxScheduled {
+			due, ok := nextDue(t.Recurrence, t.TimeZone, t.SeriesStart, t.DueDate)
+			if !ok || due.After(until) {
+				break
+			}
+			next, err := s.addOccurrence(ctx, t, due, now)
+			if err != nil {
+				return created, err
+			}
+			t = next
+			created++
+		}
+	}
+	return created, nil
+}
+
+// addOccurrence creates the task due at due that follows t in its series.
+// It starts in the workflow's first initial status and takes everything
+// else but its blockers from t. If the series already has a task due then,
+// that task is returned instead.
+func (s *TaskService) addOccurrence(ctx context.Context, t models.TaskDB, due, now time.Time) (models.TaskDB, error) {
+	doc := models.TaskDB{
+		ID:          primitive.NewObjectID(),
+		Title:       t.Title,
+		Description: t.Description,
+		DueDate:     due,
+		Status:      models.CurrentWorkflow().InitialStatuses()[0],
+		ParentID:    t.ParentID,
+		Priority:    t.Priority,
+		Labels:      t.Labels,
+		Assignee:    t.Assignee,
+		Recurrence:  t.Recurrence,
+		TimeZone:    t.TimeZone,
+		SeriesID:    t.SeriesID,
+		SeriesStart: t.SeriesStart,
+		Version:     1,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if _, err := s.col.InsertOne(ctx, doc); err != nil {
+		if !mongo.IsDuplicateKeyError(err) {
+			return doc, err
+		}
+		var existing models.TaskDB
+		err := s.col.FindOne(ctx, bson.M{"series_id": t.SeriesID, "due_date": due}).Decode(&existing)
+		return existing, err
+	}
+	s.events.publishCtx(ctx, TaskEvent{Type: EventCreated, Task: toOut(doc)})
+	return doc, s.reopenAncestors(ctx, doc)
+}
+
+// notDone matches statuses outside the workflow's done category.
+func notDone() bson.M {
+	return bson.M{"$nin": models.CurrentWorkflow().InCategory(models.CategoryDone)}
+}
+
+// CountByStatus groups the tasks by status.
+func (s *TaskService) CountByStatus(ctx context.Context) (map[models.TaskStatus]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+	cur, err := s.col.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$status", "n": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res []struct {
+		Status models.TaskStatus `bson:"_id"`
+		N      int64             `bson:"n"`
+	}
+	if err := cur.All(ctx, &res); err != nil {
+		return nil, err
+	}
+	counts := make(map[models.TaskStatus]int64, len(res))
+	for _, r := range res {
+		counts[r.Status] = r.N
+	}
+	return counts, nil
+}
+
+// MigrateStatuses rewrites statuses listed under the workflow's migrate
+// map and fails if any task is still in a status the workflow doesn't
+// define.
+func (s *TaskService) MigrateStatuses(ctx context.Context) error {
+	w := models.CurrentWorkflow()
+	now := time.Now()
+	for from, to := range w.Migrate {
+		if from == to {
+			continue
+		}
+		if _, err := s.col.UpdateMany(ctx,
+			bson.M{"status": from},
+			bson.M{"$set": bson.M{"status": to, "updated_at": now}, "$inc": bson.M{"version": 1}},
+		); err != nil {
+			return err
+		}
+	}
+	found, err := s.col.Distinct(ctx, "status", bson.M{"status": bson.M{"$nin": w.Names()}})
+	if err != nil {
+		return err
+	}
+	var unknown []models.TaskStatus
+	for _, v := range found {
+		st, _ := v.(string)
+		unknown = append(unknown, models.TaskStatus(st))
+	}
+	if len(unknown) > 0 {
+		slices.Sort(unknown)
+		return unknownStatuses(unknown)
 	}
 	return nil
 }
+
+// missOrConflict explains why a versioned write matched nothing.
+func (s *TaskService) missOrConflict(ctx context.Context, oid primitive.ObjectID, version int64) error {
+	if version == AnyVersion {
+		return ErrNotFound
+	}
+	n, err := s.col.CountDocuments(ctx, bson.M{"_id": oid}, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return ErrVersionMismatch
+}
@@ -0,0 +1,264 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"errors"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"task_manager/models"
+)
+
+var (
+	ErrWebhookNotFound     = errors.New("webhook not found")
+	ErrDeliveryNotFound    = errors.New("delivery not found")
+	ErrInvalidWebhookURL   = errors.New("invalid webhook url (use an absolute http or https URL)")
+	ErrInvalidWebhookEvent = errors.New("invalid webhook event (use: task.created | task.updated | task.deleted)")
+)
+
+// deliveryLogSize is how many finished deliveries MemoryWebhookService keeps
+// per webhook, and how many a webhook's log lists.
+const deliveryLogSize = 1000
+
+// WebhookRepository stores webhook subscriptions and the log of their
+// deliveries. IDs are opaque strings, as in TaskRepository.
+//
+// Deleting a webhook drops its deliveries. ClaimDelivery takes the pending
+// delivery whose next attempt has been due by now the longest and, in the
+// same step, moves that attempt to until, so no one else takes it meanwhile;
+// it returns ErrDeliveryNotFound when nothing is due. Redeliver puts a
+// delivery back in that queue with a fresh set of attempts.
+type WebhookRepository interface {
+	ListWebhooks(ctx context.Context) ([]models.Webhook, error)
+	GetWebhook(ctx context.Context, id string) (models.Webhook, error)
+	CreateWebhook(ctx context.Context, dto models.WebhookDTO) (models.Webhook, error)
+	UpdateWebhook(ctx context.Context, id string, dto models.WebhookDTO) (models.Webhook, error)
+	DeleteWebhook(ctx context.Context, id string) error
+
+	AddDelivery(ctx context.Context, d models.WebhookDelivery) error
+	SaveDelivery(ctx context.Context, d models.WebhookDelivery) error
+	ClaimDelivery(ctx context.Context, now, until time.Time) (models.WebhookDelivery, error)
+	Deliveries(ctx context.Context, webhookID string, status models.DeliveryStatus) ([]models.WebhookDelivery, error)
+	Redeliver(ctx context.Context, webhookID, id string) (models.WebhookDelivery, error)
+}
+
+var (
+	_ WebhookRepository = (*WebhookService)(nil)
+	_ WebhookRepository = (*MemoryWebhookService)(nil)
+)
+
+// applyWebhookDTO checks dto and copies it onto w.
+func applyWebhookDTO(w *models.Webhook, dto models.WebhookDTO) error {
+	u, err := url.Parse(dto.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidWebhookURL
+	}
+	for _, e := range dto.Events {
+		if !models.IsValidWebhookEvent(e) {
+			return ErrInvalidWebhookEvent
+		}
+	}
+	w.URL = dto.URL
+	w.Events = slices.Compact(slices.Sorted(slices.Values(dto.Events)))
+	switch {
+	case dto.Secret != "":
+		w.Secret = dto.Secret
+	case w.Secret == "":
+		w.Secret = rand.Text()
+	}
+	w.Active = dto.Active == nil || *dto.Active
+	return nil
+}
+
+// wants reports whether w is subscribed to event.
+func wants(w models.Webhook, event string) bool {
+	return w.Active && (len(w.Events) == 0 || slices.Contains(w.Events, event))
+}
+
+// MemoryWebhookService keeps webhooks and their deliveries in process
+// memory, alongside MemoryTaskService; everything is lost on restart.
+type MemoryWebhookService struct {
+	mu         sync.Mutex
+	seq        int64
+	hooks      map[string]models.Webhook
+	deliveries map[string]models.WebhookDelivery
+}
+
+func NewMemoryWebhookService() *MemoryWebhookService {
+	return &MemoryWebhookService{
+		hooks:      make(map[string]models.Webhook),
+		deliveries: make(map[string]models.WebhookDelivery),
+	}
+}
+
+func (s *MemoryWebhookService) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := slices.Collect(maps.Values(s.hooks))
+	slices.SortFunc(out, func(a, b models.Webhook) int { return compareIDs(a.ID, b.ID) })
+	return out, nil
+}
+
+func (s *MemoryWebhookService) GetWebhook(ctx context.Context, id string) (models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.hooks[id]
+	if !ok {
+		return models.Webhook{}, ErrWebhookNotFound
+	}
+	return w, nil
+}
+
+func (s *MemoryWebhookService) CreateWebhook(ctx context.Context, dto models.WebhookDTO) (models.Webhook, error) {
+	var w models.Webhook
+	if err := applyWebhookDTO(&w, dto); err != nil {
+		return models.Webhook{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	w.ID = strconv.FormatInt(s.seq, 10)
+	w.CreatedAt = time.Now().UTC()
+	w.UpdatedAt = w.CreatedAt
+	s.hooks[w.ID] = w
+	return w, nil
+}
+
+func (s *MemoryWebhookService) UpdateWebhook(ctx context.Context, id string, dto models.WebhookDTO) (models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.hooks[id]
+	if !ok {
+		return models.Webhook{}, ErrWebhookNotFound
+	}
+	if err := applyWebhookDTO(&w, dto); err != nil {
+		return models.Webhook{}, err
+	}
+	w.UpdatedAt = time.Now().UTC()
+	s.hooks[id] = w
+	return w, nil
+}
+
+func (s *MemoryWebhookService) DeleteWebhook(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.hooks[id]; !ok {
+		return ErrWebhookNotFound
+	}
+	delete(s.hooks, id)
+	for did, d := range s.deliveries {
+		if d.WebhookID == id {
+			delete(s.deliveries, did)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryWebhookService) AddDelivery(ctx context.Context, d models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	d.ID = strconv.FormatInt(s.seq, 10)
+	s.deliveries[d.ID] = d
+	return nil
+}
+
+func (s *MemoryWebhookService) SaveDelivery(ctx context.Context, d models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.deliveries[d.ID]; !ok {
+		return ErrDeliveryNotFound
+	}
+	s.deliveries[d.ID] = d
+	if d.Status != models.DeliveryPending {
+		s.trimLog(d.WebhookID)
+	}
+	return nil
+}
+
+// trimLog drops the oldest finished deliveries of a webhook beyond
+// deliveryLogSize.
+func (s *MemoryWebhookService) trimLog(webhookID string) {
+	var done []string
+	for id, d := range s.deliveries {
+		if d.WebhookID == webhookID && d.Status != models.DeliveryPending {
+			done = append(done, id)
+		}
+	}
+	if len(done) <= deliveryLogSize {
+		return
+	}
+	slices.SortFunc(done, compareIDs)
+	for _, id := range done[:len(done)-deliveryLogSize] {
+		delete(s.deliveries, id)
+	}
+}
+
+func (s *MemoryWebhookService) ClaimDelivery(ctx context.Context, now, until time.Time) (models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due *models.WebhookDelivery
+	for _, d := range s.deliveries {
+		if d.Status != models.DeliveryPending || d.NextAttempt == nil || d.NextAttempt.After(now) {
+			continue
+		}
+		if due == nil || cmp.Or(d.NextAttempt.Compare(*due.NextAttempt), compareIDs(d.ID, due.ID)) < 0 {
+			due = &d
+		}
+	}
+	if due == nil {
+		return models.WebhookDelivery{}, ErrDeliveryNotFound
+	}
+	due.NextAttempt = &until
+	s.deliveries[due.ID] = *due
+	return cloneDelivery(*due), nil
+}
+
+// Deliveries returns a webhook's deliveries, newest first, optionally only
+// those with status.
+func (s *MemoryWebhookService) Deliveries(ctx context.Context, webhookID string, status models.DeliveryStatus) ([]models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.hooks[webhookID]; !ok {
+		return nil, ErrWebhookNotFound
+	}
+	out := []models.WebhookDelivery{}
+	for _, d := range s.deliveries {
+		if d.WebhookID == webhookID && (status == "" || d.Status == status) {
+			out = append(out, cloneDelivery(d))
+		}
+	}
+	slices.SortFunc(out, func(a, b models.WebhookDelivery) int { return compareIDs(b.ID, a.ID) })
+	return out, nil
+}
+
+func (s *MemoryWebhookService) Redeliver(ctx context.Context, webhookID, id string) (models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.hooks[webhookID]; !ok {
+		return models.WebhookDelivery{}, ErrWebhookNotFound
+	}
+	d, ok := s.deliveries[id]
+	if !ok || d.WebhookID != webhookID {
+		return models.WebhookDelivery{}, ErrDeliveryNotFound
+	}
+	now := time.Now().UTC()
+	d.Status = models.DeliveryPending
+	d.Tries = 0
+	d.NextAttempt = &now
+	d.UpdatedAt = now
+	s.deliveries[id] = d
+	return cloneDelivery(d), nil
+}
+
+// cloneDelivery copies the attempt log so callers can append to it.
+func cloneDelivery(d models.WebhookDelivery) models.WebhookDelivery {
+	d.Attempts = slices.Clone(d.Attempts)
+	return d
+}
@@ -0,0 +1,78 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"task_manager/models"
+)
+
+var ErrInvalidTransition = errors.New("status change not allowed by the workflow")
+
+// TransitionError is a status change the workflow doesn't allow. From is
+// empty when a task is being created; Allowed lists what would have been
+// accepted instead.
+type TransitionError struct {
+	From    models.TaskStatus
+	To      models.TaskStatus
+	Allowed []models.TaskStatus
+}
+
+func (e *TransitionError) Error() string {
+	var b strings.Builder
+	if e.From == "" {
+		fmt.Fprintf(&b, "tasks cannot be created as %s", e.To)
+	} else {
+		fmt.Fprintf(&b, "cannot move from %s to %s", e.From, e.To)
+	}
+	if len(e.Allowed) == 0 {
+		b.WriteString(" (" + string(e.From) + " is final)")
+	} else {
+		b.WriteString(" (use: " + StatusList(e.Allowed) + ")")
+	}
+	return b.String()
+}
+
+func (e *TransitionError) Is(target error) bool { return target == ErrInvalidTransition }
+
+// StatusList joins statuses the way error messages show them.
+func StatusList(statuses []models.TaskStatus) string {
+	names := make([]string, len(statuses))
+	for i, s := range statuses {
+		names[i] = string(s)
+	}
+	return strings.Join(names, " | ")
+}
+
+// checkInitial vets the status a new task starts in.
+func checkInitial(status models.TaskStatus) error {
+	if !models.IsValidStatus(status) {
+		return ErrInvalidStatus
+	}
+	initial := models.CurrentWorkflow().InitialStatuses()
+	for _, s := range initial {
+		if s == status {
+			return nil
+		}
+	}
+	return &TransitionError{To: status, Allowed: initial}
+}
+
+// checkTransition vets moving a task from one status to another.
+func checkTransition(from, to models.TaskStatus) error {
+	if !models.IsValidStatus(to) {
+		return ErrInvalidStatus
+	}
+	w := models.CurrentWorkflow()
+	if !w.CanMove(from, to) {
+		return &TransitionError{From: from, To: to, Allowed: w.Next(from)}
+	}
+	return nil
+}
+
+// unknownStatuses is the error for tasks left in statuses the workflow
+// doesn't define after migration.
+func unknownStatuses(statuses []models.TaskStatus) error {
+	return fmt.Errorf("tasks have statuses the workflow does not define: %s (map them under \"migrate\")", StatusList(statuses))
+}
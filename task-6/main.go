@@ -1,15 +1,30 @@
 package main
 
 import (
-	"log"
+	"fmt"
+	"log/slog"
+	"os"
 
+	"task_manager/logging"
 	"task_manager/router"
 )
 
 func main() {
+	if len(os.Args) > 1 && (os.Args[1] == "export" || os.Args[1] == "import") {
+		if err := runTransfer(os.Args[1], os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err := logging.Setup(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 	r := router.Setup()
-	log.Println("🚀 Task Manager API (Mongo) running on http://localhost:8080")
+	slog.Info("🚀 Task Manager API running on http://localhost:8080")
 	if err := r.Run(":8080"); err != nil {
-		log.Fatal(err)
+		slog.Error("server stopped", "error", err)
+		os.Exit(1)
 	}
 }
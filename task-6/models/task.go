@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type TaskStatus string
@@ -12,9 +14,22 @@ const (
 	StatusDone       TaskStatus = "done"
 )
 
-func IsValidStatus(s TaskStatus) bool {
-	switch s {
-	case StatusPending, StatusInProgress, StatusDone:
+// The constants above are the default workflow; see workflow.go for others.
+
+type TaskPriority string
+
+const (
+	PriorityLow    TaskPriority = "low"
+	PriorityMedium TaskPriority = "medium"
+	PriorityHigh   TaskPriority = "high"
+	PriorityUrgent TaskPriority = "urgent"
+
+	DefaultPriority = PriorityMedium
+)
+
+func IsValidPriority(p TaskPriority) bool {
+	switch p {
+	case PriorityLow, PriorityMedium, PriorityHigh, PriorityUrgent:
 		return true
 	default:
 		return false
@@ -22,37 +37,127 @@ func IsValidStatus(s TaskStatus) bool {
 }
 
 type CreateTaskDTO struct {
-	Title       string     `json:"title" binding:"required"`
-	Description string     `json:"description"`
-	DueDate     string     `json:"due_date" binding:"required"` 
-	Status      TaskStatus `json:"status" binding:"required"`
+	Title       string       `json:"title" binding:"required"`
+	Description string       `json:"description"`
+	DueDate     string       `json:"due_date" binding:"required"`
+	Status      TaskStatus   `json:"status" binding:"required"`
+	ParentID    string       `json:"parent_id"`
+	BlockedBy   []string     `json:"blocked_by"`
+	Priority    TaskPriority `json:"priority"` // defaults to medium
+	Labels      []string     `json:"labels"`
+	Assignee    string       `json:"assignee"`
+	Recurrence  string       `json:"recurrence"` // RRULE, e.g. FREQ=WEEKLY;BYDAY=MO
+	TimeZone    string       `json:"time_zone"`  // IANA zone the rule runs in, defaults to UTC
 }
 
 type UpdateTaskDTO struct {
-	Title       *string     `json:"title"`
-	Description *string     `json:"description"`
-	DueDate     *string     `json:"due_date"`
-	Status      *TaskStatus `json:"status"`
+	Title       *string       `json:"title"`
+	Description *string       `json:"description"`
+	DueDate     *string       `json:"due_date"`
+	Status      *TaskStatus   `json:"status"`
+	ParentID    *string       `json:"parent_id"`  // "" detaches from the parent
+	BlockedBy   *[]string     `json:"blocked_by"` // replaces the whole set
+	Priority    *TaskPriority `json:"priority"`
+	Labels      *[]string     `json:"labels"`     // replaces the whole set
+	Assignee    *string       `json:"assignee"`   // "" unassigns
+	Recurrence  *string       `json:"recurrence"` // "" ends the series
+	TimeZone    *string       `json:"time_zone"`
 }
 
 
 type TaskDB struct {
-	ID          interface{} `bson:"_id,omitempty"` 
-	Title       string      `bson:"title"`
-	Description string      `bson:"description"`
-	DueDate     time.Time   `bson:"due_date"`
-	Status      TaskStatus  `bson:"status"`
-	CreatedAt   time.Time   `bson:"created_at"`
-	UpdatedAt   time.Time   `bson:"updated_at"`
+	ID          interface{}          `bson:"_id,omitempty"`
+	Title       string               `bson:"title"`
+	Description string               `bson:"description"`
+	DueDate     time.Time            `bson:"due_date"`
+	Status      TaskStatus           `bson:"status"`
+	ParentID    interface{}          `bson:"parent_id,omitempty"`
+	BlockedBy   []primitive.ObjectID `bson:"blocked_by,omitempty"`
+	Priority    TaskPriority         `bson:"priority,omitempty"`
+	Labels      []string             `bson:"labels,omitempty"`
+	Assignee    string               `bson:"assignee,omitempty"`
+	Recurrence  string               `bson:"recurrence,omitempty"`
+	TimeZone    string               `bson:"time_zone,omitempty"`
+	SeriesID    interface{}          `bson:"series_id,omitempty"`
+	SeriesStart *time.Time           `bson:"series_start,omitempty"`
+	Version     int64                `bson:"version"`
+	CreatedAt   time.Time            `bson:"created_at"`
+	UpdatedAt   time.Time            `bson:"updated_at"`
 }
 
 
 type TaskOut struct {
-	ID          string     `json:"id"`
-	Title       string     `json:"title"`
-	Description string     `json:"description"`
-	DueDate     time.Time  `json:"due_date"`
-	Status      TaskStatus `json:"status"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
+	ID          string       `json:"id"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	DueDate     time.Time    `json:"due_date"`
+	Status      TaskStatus   `json:"status"`
+	ParentID    string       `json:"parent_id,omitempty"`
+	BlockedBy   []string     `json:"blocked_by,omitempty"`
+	Priority    TaskPriority `json:"priority"`
+	Labels      []string     `json:"labels,omitempty"`
+	Assignee    string       `json:"assignee,omitempty"`
+	Recurrence  string       `json:"recurrence,omitempty"`
+	TimeZone    string       `json:"time_zone,omitempty"`
+	SeriesID    string       `json:"series_id,omitempty"`    // first task of the series
+	SeriesStart *time.Time   `json:"series_start,omitempty"` // where the rule starts counting
+	Version     int64        `json:"version"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// TaskNode is a task with its subtasks nested under it. RollupStatus sums up
+// the whole subtree: done only when every task in it is done.
+type TaskNode struct {
+	TaskOut
+	RollupStatus TaskStatus `json:"rollup_status"`
+	Children     []TaskNode `json:"children"`
+}
+
+// Fields GET /tasks can sort on, by their JSON name.
+var SortableFields = map[string]bool{
+	"id":          true,
+	"title":       true,
+	"description": true,
+	"due_date":    true,
+	"status":      true,
+	"created_at":  true,
+	"updated_at":  true,
+}
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 500
+)
+
+// TaskQuery narrows, orders and pages a task listing. Zero values mean "no
+// filter"; time bounds are inclusive.
+type TaskQuery struct {
+	Statuses    []TaskStatus
+	Title       string // case-insensitive substring
+	DueFrom     *time.Time
+	DueTo       *time.Time
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	UpdatedFrom *time.Time
+	UpdatedTo   *time.Time
+	Priorities  []TaskPriority
+	Labels      []string // tasks must carry all of them
+	Assignee    string
+
+	SortBy   string // one of SortableFields; defaults to "id"
+	SortDesc bool
+
+	Limit  int
+	Offset int
+	Cursor string // opaque, from a previous page's next_cursor
+}
+
+// TaskPage is the response envelope for GET /tasks.
+type TaskPage struct {
+	Data       []TaskOut `json:"data"`
+	Total      int64     `json:"total"`
+	Limit      int       `json:"limit"`
+	Offset     int       `json:"offset"`
+	NextCursor string    `json:"next_cursor,omitempty"`
 }
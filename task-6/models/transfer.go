@@ -0,0 +1,109 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// MaxImportSize caps the tasks in one POST /tasks/import.
+const MaxImportSize = 10000
+
+// Import and export file formats.
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatYAML = "yaml"
+)
+
+func IsValidFormat(f string) bool {
+	switch f {
+	case FormatJSON, FormatCSV, FormatYAML:
+		return true
+	default:
+		return false
+	}
+}
+
+// ConflictPolicy says what an import does with a task whose id is taken.
+type ConflictPolicy string
+
+const (
+	ConflictSkip      ConflictPolicy = "skip"      // keep the stored task
+	ConflictOverwrite ConflictPolicy = "overwrite" // replace it with the imported one
+	ConflictNewID     ConflictPolicy = "new_id"    // import it as a new task
+
+	DefaultConflictPolicy = ConflictSkip
+)
+
+func IsValidConflictPolicy(p ConflictPolicy) bool {
+	switch p {
+	case ConflictSkip, ConflictOverwrite, ConflictNewID:
+		return true
+	default:
+		return false
+	}
+}
+
+// RecordID is a task ID in an export file. It reads JSON strings as well as
+// numbers, so files move between editions of the API.
+type RecordID string
+
+func (id *RecordID) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		*id = ""
+		return nil
+	}
+	if len(b) > 0 && b[0] == '"' {
+		return json.Unmarshal(b, (*string)(id))
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return err
+	}
+	*id = RecordID(n)
+	return nil
+}
+
+// TaskRecord is a task in an export file: the fields of CreateTaskDTO, with
+// its rules, and the task's ID. ParentID and BlockedBy name other tasks of
+// the file by their ID, or tasks already stored.
+type TaskRecord struct {
+	ID          RecordID     `json:"id,omitempty"`
+	Title       string       `json:"title" binding:"required"`
+	Description string       `json:"description"`
+	DueDate     string       `json:"due_date" binding:"required"`
+	Status      TaskStatus   `json:"status" binding:"required"`
+	ParentID    RecordID     `json:"parent_id,omitempty"`
+	BlockedBy   []RecordID   `json:"blocked_by,omitempty"`
+	Priority    TaskPriority `json:"priority"`
+	Labels      []string     `json:"labels,omitempty"`
+	Assignee    string       `json:"assignee,omitempty"`
+	Recurrence  string       `json:"recurrence,omitempty"`
+	TimeZone    string       `json:"time_zone,omitempty"`
+}
+
+// What an import did with one task.
+const (
+	ImportCreated = "created"
+	ImportUpdated = "updated"
+	ImportSkipped = "skipped"
+	ImportFailed  = "failed"
+)
+
+// ImportResult reports one task of an import, by its position in the file.
+type ImportResult struct {
+	Index  int      `json:"index"`
+	ID     RecordID `json:"id,omitempty"` // in the file
+	Action string   `json:"action"`
+	TaskID string   `json:"task_id,omitempty"` // the stored task it became or kept
+	Error  string   `json:"error,omitempty"`
+}
+
+// ImportReport is the answer to POST /tasks/import.
+type ImportReport struct {
+	Created int            `json:"created"`
+	Updated int            `json:"updated"`
+	Skipped int            `json:"skipped"`
+	Failed  int            `json:"failed"`
+	Results []ImportResult `json:"results"`
+}
@@ -2,65 +2,193 @@ package router
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"task_manager/controllers"
 	"task_manager/data"
+	"task_manager/metrics"
+	"task_manager/middleware"
+	"task_manager/models"
 )
 
+// deliveryRetention is how long a webhook delivery is kept after its last
+// attempt.
+const deliveryRetention = 30 * 24 * time.Hour
+
 func Setup() *gin.Engine {
-	r := gin.Default()
-
-	r.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
+	m := metrics.New()
+	r := gin.New()
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		fatal("TRUSTED_PROXIES", err)
+	}
+	r.Use(middleware.RequestID(), middleware.AccessLog(), m.Middleware(), middleware.Recovery())
+
+	cors, err := middleware.CORS(corsConfig([]string{"*"}))
+	if err != nil {
+		fatal("CORS", err)
+	}
+	r.Use(cors)
+
+	loadWorkflow()
+	var taskService data.TaskRepository
+	var webhookService data.WebhookRepository
+	switch backend := getenv("TASK_BACKEND", "mongo"); backend {
+	case "mongo":
+		col := connectMongo(m.MongoMonitor())
+		svc := data.NewTaskService(col)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		if err := svc.MigrateStatuses(ctx); err != nil {
+			fatal("migrate task statuses", err)
 		}
-		c.Next()
+		cancel()
+		taskService = svc
+		webhookService = webhookStore(col.Database())
+	case "memory":
+		taskService = data.NewMemoryTaskService()
+		webhookService = data.NewMemoryWebhookService()
+	default:
+		slog.Error("unknown TASK_BACKEND (use: mongo | memory)", "backend", backend)
+		os.Exit(1)
+	}
+	m.WatchTasks(taskService)
+	startScheduler(taskService)
+	data.NewWebhookDispatcher(webhookService, taskService.Events()).Start(context.Background())
+	taskController := controllers.NewTaskController(taskService)
+
+	// Task and webhook routes share one budget per client IP.
+	limiter := middleware.NewRateLimiter(middleware.NewMemoryRateStore())
+	limiter.Limits["api"] = rateLimit("RATE_LIMIT_API", "300/1m")
+	api := r.Group("/", limiter.Limit("api", middleware.ByIP))
+	taskController.Register(api)
+	controllers.NewWebhookController(webhookService).Register(api)
+
+	r.GET("/health", func(c *gin.Context) {
+		c.JSON(200, gin.H{"status": "ok"})
 	})
+	r.GET("/metrics", m.Handler())
+
+	// API docs, built from the routes above; keep this last.
+	controllers.RegisterDocs(r)
 
+	return r
+}
+
+// connectMongo opens the task collection named by the MONGO_* variables and
+// makes sure its indexes exist. monitor watches every command sent.
+func connectMongo(monitor *event.CommandMonitor) *mongo.Collection {
 	mongoURI := getenv("MONGO_URI", "mongodb://localhost:27017")
 	dbName := getenv("MONGO_DB", "task_manager")
 	colName := getenv("MONGO_COLLECTION", "tasks")
 
-	client, err := mongo.NewClient(options.Client().ApplyURI(mongoURI))
+	client, err := mongo.NewClient(options.Client().ApplyURI(mongoURI).SetMonitor(monitor))
 	if err != nil {
-		log.Fatalf("mongo client init: %v", err)
+		fatal("mongo client init", err)
 	}
-	{
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		if err := client.Connect(ctx); err != nil {
-			log.Fatalf("mongo connect: %v", err)
-		}
-		if err := client.Ping(ctx, nil); err != nil {
-			log.Fatalf("mongo ping: %v", err)
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		fatal("mongo connect", err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		fatal("mongo ping", err)
 	}
 
-	db := client.Database(dbName)
-	col := db.Collection(colName)
+	col := client.Database(dbName).Collection(colName)
+	ensureTaskIndexes(col)
+	return col
+}
 
-	taskService := data.NewTaskService(col)
-	taskController := controllers.NewTaskController(taskService)
+// loadWorkflow swaps in the workflow from the JSON file named by
+// TASK_WORKFLOW; without it tasks use pending, in_progress and done.
+func loadWorkflow() {
+	path := os.Getenv("TASK_WORKFLOW")
+	if path == "" {
+		return
+	}
+	w, err := models.LoadWorkflow(path)
+	if err != nil {
+		fatal("load workflow", err)
+	}
+	models.SetWorkflow(w)
+}
 
-	api := r.Group("/")
-	taskController.Register(api)
+// startScheduler pre-creates recurring tasks in the background.
+// TASK_RECURRENCE_INTERVAL sets how often it runs (0 turns it off) and
+// TASK_RECURRENCE_HORIZON how far ahead it creates occurrences.
+func startScheduler(repo data.TaskRepository) {
+	interval, err := time.ParseDuration(getenv("TASK_RECURRENCE_INTERVAL", "1h"))
+	if err != nil {
+		fatal("TASK_RECURRENCE_INTERVAL", err)
+	}
+	horizon, err := time.ParseDuration(getenv("TASK_RECURRENCE_HORIZON", "168h"))
+	if err != nil {
+		fatal("TASK_RECURRENCE_HORIZON", err)
+	}
+	if interval > 0 {
+		go data.RunScheduler(context.Background(), repo, interval, horizon)
+	}
+}
 
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
-	})
+// fatal logs why the server can't start and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
 
-	return r
+// rateLimit reads the limit in k, like 60/1m or off, defaulting to def.
+func rateLimit(k, def string) middleware.Limit {
+	l, err := middleware.ParseLimit(getenv(k, def))
+	if err != nil {
+		fatal(k, err)
+	}
+	return l
+}
+
+// trustedProxies lists the proxies, from the comma-separated IPs or CIDRs
+// in TRUSTED_PROXIES, whose X-Forwarded-For gives a client's IP. There are
+// none by default, so a client can't pick the IP it is limited by.
+func trustedProxies() []string {
+	return splitList(os.Getenv("TRUSTED_PROXIES"))
+}
+
+// corsConfig reads the CORS policy from the JSON file named by CORS_CONFIG.
+// CORS_ALLOWED_ORIGINS, comma-separated, replaces its allowed origins;
+// without either the origins are def.
+func corsConfig(def []string) middleware.CORSConfig {
+	var cfg middleware.CORSConfig
+	if path := os.Getenv("CORS_CONFIG"); path != "" {
+		var err error
+		if cfg, err = middleware.LoadCORSConfig(path); err != nil {
+			fatal("load CORS config", err)
+		}
+	}
+	if origins := splitList(os.Getenv("CORS_ALLOWED_ORIGINS")); origins != nil {
+		cfg.AllowedOrigins = origins
+	}
+	if cfg.AllowedOrigins == nil {
+		cfg.AllowedOrigins = def
+	}
+	return cfg
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for item := range strings.SplitSeq(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 func getenv(k, def string) string {
@@ -69,3 +197,51 @@ func getenv(k, def string) string {
 	}
 	return def
 }
+
+// ensureTaskIndexes backs the sort orders and filters of GET /tasks. Each
+// sortable date is paired with _id to match the keyset used by cursors.
+// parent_id serves subtask lookups and the next three back the priority,
+// label and assignee filters. The unique series index keeps a recurring
+// series from getting two tasks due at the same time.
+func ensureTaskIndexes(col *mongo.Collection) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := col.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "due_date", Value: 1}}},
+		{Keys: bson.D{{Key: "due_date", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "updated_at", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "parent_id", Value: 1}}},
+		{Keys: bson.D{{Key: "priority", Value: 1}, {Key: "due_date", Value: 1}}},
+		{Keys: bson.D{{Key: "labels", Value: 1}}},
+		{Keys: bson.D{{Key: "assignee", Value: 1}, {Key: "status", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "series_id", Value: 1}, {Key: "due_date", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"series_id": bson.M{"$exists": true}}),
+		},
+	})
+	if err != nil {
+		slog.Warn("failed to create task indexes", "error", err)
+	}
+}
+
+// webhookStore keeps webhooks next to the tasks. Deliveries are indexed for
+// the dispatcher's queue and each webhook's log, and expire after
+// deliveryRetention.
+func webhookStore(db *mongo.Database) *data.WebhookService {
+	hooks, deliveries := db.Collection("webhooks"), db.Collection("webhook_deliveries")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := deliveries.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt", Value: 1}}},
+		{Keys: bson.D{{Key: "webhook_id", Value: 1}, {Key: "_id", Value: -1}}},
+		{
+			Keys:    bson.D{{Key: "updated_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(deliveryRetention.Seconds())),
+		},
+	})
+	if err != nil {
+		slog.Warn("failed to create webhook delivery indexes", "error", err)
+	}
+	return data.NewWebhookService(hooks, deliveries)
+}
@@ -0,0 +1,90 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"task_manager/controllers"
+)
+
+func setup(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("TASK_BACKEND", "memory")
+	t.Setenv("TASK_RECURRENCE_INTERVAL", "0")
+	return Setup()
+}
+
+// TestAPISpecMatchesRoutes fails when a route is added without documenting
+// it in controllers.APISpec, or an operation outlives its route.
+func TestAPISpecMatchesRoutes(t *testing.T) {
+	r := setup(t)
+	if _, err := controllers.APISpec().Build(r.Routes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	r := setup(t)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json: %d", w.Code)
+	}
+	var doc struct {
+		OpenAPI    string                    `json:"openapi"`
+		Paths      map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("openapi = %q, want 3.x", doc.OpenAPI)
+	}
+	if _, ok := doc.Paths["/tasks/{id}"]["patch"]; !ok {
+		t.Errorf("PATCH /tasks/{id} missing from paths")
+	}
+
+	var refs []string
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, x := range v {
+				if s, ok := x.(string); ok && k == "$ref" {
+					refs = append(refs, s)
+				}
+				walk(x)
+			}
+		case []any:
+			for _, x := range v {
+				walk(x)
+			}
+		}
+	}
+	var raw any
+	json.Unmarshal(w.Body.Bytes(), &raw)
+	walk(raw)
+	if len(refs) == 0 {
+		t.Fatal("no $ref in the document")
+	}
+	for _, ref := range refs {
+		name, ok := strings.CutPrefix(ref, "#/components/schemas/")
+		if _, found := doc.Components.Schemas[name]; !ok || !found {
+			t.Errorf("$ref %q does not resolve", ref)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "openapi.json") {
+		t.Errorf("GET /docs: %d, want the docs page", w.Code)
+	}
+}
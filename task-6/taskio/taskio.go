@@ -0,0 +1,200 @@
+// Package taskio reads and writes task export files in JSON, CSV and YAML.
+// Every format holds a list of models.TaskRecord; what to do with them is
+// up to the caller.
+package taskio
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"task_manager/models"
+)
+
+var ErrInvalidFile = errors.New("invalid file")
+
+// columns are the CSV columns, in the order they are written. Lists are
+// joined with commas within their cell.
+var columns = []string{
+	"id", "title", "description", "due_date", "status", "parent_id",
+	"blocked_by", "priority", "labels", "assignee", "recurrence", "time_zone",
+}
+
+// ContentType is the media type a file in format is served as.
+func ContentType(format string) string {
+	switch format {
+	case models.FormatCSV:
+		return "text/csv; charset=utf-8"
+	case models.FormatYAML:
+		return "application/yaml; charset=utf-8"
+	default:
+		return "application/json; charset=utf-8"
+	}
+}
+
+// FormatOf guesses the format of a file from its media type, as sent in a
+// Content-Type header, or its name. It returns "" when it can't tell.
+func FormatOf(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch {
+	case strings.HasSuffix(s, ".csv"), strings.HasPrefix(s, "text/csv"):
+		return models.FormatCSV
+	case strings.HasSuffix(s, ".yaml"), strings.HasSuffix(s, ".yml"), strings.Contains(s, "yaml"):
+		return models.FormatYAML
+	case strings.HasSuffix(s, ".json"), strings.Contains(s, "json"):
+		return models.FormatJSON
+	default:
+		return ""
+	}
+}
+
+func Write(w io.Writer, format string, records []models.TaskRecord) error {
+	if records == nil {
+		records = []models.TaskRecord{}
+	}
+	switch format {
+	case models.FormatCSV:
+		return writeCSV(w, records)
+	case models.FormatYAML:
+		raw, err := json.Marshal(records)
+		if err != nil {
+			return err
+		}
+		if raw, err = yaml.JSONToYAML(raw); err != nil {
+			return err
+		}
+		_, err = w.Write(raw)
+		return err
+	default:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	}
+}
+
+// Read parses a file. A JSON file holds a list of tasks, or a {"data": [...]}
+// object like the answer to GET /tasks; unknown fields and columns are
+// ignored in every format.
+func Read(r io.Reader, format string) ([]models.TaskRecord, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case models.FormatCSV:
+		return readCSV(raw)
+	case models.FormatYAML:
+		if raw, err = yaml.YAMLToJSON(raw); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+		}
+	}
+	return readJSON(raw)
+}
+
+func readJSON(raw []byte) ([]models.TaskRecord, error) {
+	raw = bytes.TrimSpace(raw)
+	var records []models.TaskRecord
+	var err error
+	if len(raw) > 0 && raw[0] == '{' {
+		var page struct {
+			Data []models.TaskRecord `json:"data"`
+		}
+		err = json.Unmarshal(raw, &page)
+		records = page.Data
+	} else if len(raw) > 0 {
+		err = json.Unmarshal(raw, &records)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+	return records, nil
+}
+
+func writeCSV(w io.Writer, records []models.TaskRecord) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	for _, r := range records {
+		blockedBy := make([]string, len(r.BlockedBy))
+		for i, id := range r.BlockedBy {
+			blockedBy[i] = string(id)
+		}
+		row := []string{
+			string(r.ID), r.Title, r.Description, r.DueDate, string(r.Status), string(r.ParentID),
+			strings.Join(blockedBy, ","), string(r.Priority), strings.Join(r.Labels, ","), r.Assignee, r.Recurrence, r.TimeZone,
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// readCSV reads rows by the column names in the header, so columns may come
+// in any order and missing ones are left empty. Cells other than the
+// description are trimmed.
+func readCSV(raw []byte) ([]models.TaskRecord, error) {
+	cr := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(raw, []byte("\ufeff"))))
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	var records []models.TaskRecord
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+		}
+		value := func(name string) string {
+			if i, ok := index[name]; ok {
+				return row[i]
+			}
+			return ""
+		}
+		cell := func(name string) string { return strings.TrimSpace(value(name)) }
+		r := models.TaskRecord{
+			ID:          models.RecordID(cell("id")),
+			Title:       cell("title"),
+			Description: value("description"),
+			DueDate:     cell("due_date"),
+			Status:      models.TaskStatus(cell("status")),
+			ParentID:    models.RecordID(cell("parent_id")),
+			Priority:    models.TaskPriority(cell("priority")),
+			Labels:      splitList(cell("labels")),
+			Assignee:    cell("assignee"),
+			Recurrence:  cell("recurrence"),
+			TimeZone:    cell("time_zone"),
+		}
+		for _, id := range splitList(cell("blocked_by")) {
+			r.BlockedBy = append(r.BlockedBy, models.RecordID(id))
+		}
+		records = append(records, r)
+	}
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,401 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"task_manager/models"
+	"task_manager/openapi"
+	"task_manager/patch"
+)
+
+// ErrorResponse is the body of every error answer.
+type ErrorResponse struct {
+	Error string `json:"error"`
+	Index *int   `json:"index,omitempty"` // the failing operation of a batch or task of an import
+}
+
+// registerDocs serves the OpenAPI document of every route of r at
+// /openapi.json and a page to browse and try it at /docs. Register it
+// last: the document is built from r's routes on the first request.
+func registerDocs(r *gin.Engine) {
+	var once sync.Once
+	var doc []byte
+	r.GET("/openapi.json", func(c *gin.Context) {
+		once.Do(func() {
+			spec, err := APISpec().Build(r.Routes())
+			if err != nil {
+				slog.Warn("routes and API spec differ", "error", err)
+			}
+			if doc, err = json.Marshal(spec); err != nil {
+				slog.Error("encoding API spec", "error", err)
+			}
+		})
+		if doc == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			return
+		}
+		c.Data(http.StatusOK, "application/json; charset=utf-8", doc)
+	})
+	r.GET("/docs", openapi.UI)
+}
+
+// APISpec documents every route RegisterRoutes registers, with the access
+// its middleware enforces. A route added without an operation here, an
+// operation left after its route is gone, or an Access that disagrees with
+// AuthRequired and AdminOnly fails the controller tests.
+func APISpec() openapi.Spec {
+	var statuses []string
+	for _, s := range models.CurrentWorkflow().Names() {
+		statuses = append(statuses, string(s))
+	}
+	taskResp := openapi.Resp{Status: http.StatusOK, Body: envelope(models.TaskOut{}), Headers: map[string]string{"ETag": "the task's version"}}
+	ifMatch := openapi.HeaderParam("If-Match", `write only if the task's ETag is one of these, e.g. "3"; 412 otherwise`)
+
+	spec := openapi.Spec{
+		Info: openapi.Info{
+			Title:       "Task Manager API",
+			Version:     "1.0",
+			Description: "Tasks with subtasks, dependencies, recurrence and webhooks, stored in MongoDB. Reading tasks takes a bearer token from POST /login; changing them takes an admin's. Errors answer {\"error\": message}.",
+		},
+		Tags: []openapi.Tag{
+			{Name: "tasks", Description: "Create, read, change and delete tasks."},
+			{Name: "transfer", Description: "Task feeds and files: events, calendar, import and export."},
+			{Name: "webhooks", Description: "Subscriptions to task changes and their deliveries."},
+			{Name: "users", Description: "Accounts and bearer tokens."},
+			{Name: "meta", Description: "Health and this documentation."},
+		},
+		Enums: map[reflect.Type][]string{
+			reflect.TypeFor[models.TaskStatus]():     statuses,
+			reflect.TypeFor[models.TaskPriority]():   {"low", "medium", "high", "urgent"},
+			reflect.TypeFor[models.BatchMode]():      {"atomic", "best_effort"},
+			reflect.TypeFor[models.ConflictPolicy](): {"skip", "overwrite", "new_id"},
+			reflect.TypeFor[models.DeliveryStatus](): {"pending", "succeeded", "failed"},
+			reflect.TypeFor[models.Role]():           {string(models.RoleAdmin), string(models.RoleUser)},
+		},
+		Error: ErrorResponse{},
+		Ops: []openapi.Op{
+			{
+				Method: "GET", Path: "/tasks", Access: openapi.User, Tag: "tasks", Summary: "List tasks",
+				Description: "Filters, sorts and pages the tasks. The answer is a page, not wrapped in data.",
+				Params:      append(taskFilters(), pageParams()...),
+				Responses:   []openapi.Resp{{Status: http.StatusOK, Body: openapi.JSON(models.TaskPage{})}, errResp(http.StatusBadRequest, "Invalid filter, sort or page")},
+			},
+			{
+				Method: "GET", Path: "/tasks/events", Access: openapi.User, Tag: "transfer", Summary: "Stream task changes",
+				Description: "Server-Sent Events of task changes. Last-Event-ID resumes after that event; a reset event means it was too old to replay.",
+				Params: []openapi.Param{
+					openapi.Query("status", "comma-separated statuses"),
+					openapi.Query("assignee", "only tasks assigned to this user"),
+					openapi.HeaderParam("Last-Event-ID", "resume after this event"),
+				},
+				Responses: []openapi.Resp{{Status: http.StatusOK, Body: openapi.Content{"text/event-stream": ""}}, errResp(http.StatusBadRequest, "Invalid status")},
+			},
+			{
+				Method: "GET", Path: "/tasks.ics", Tag: "transfer", Summary: "Calendar feed of due dates",
+				Description: "The tasks matching the GET /tasks filters as iCalendar entries at their due_date. Calendar apps can't send a bearer token, so the feed takes the caller's feed token from POST /calendar/token instead.",
+				Params: append(taskFilters(),
+					openapi.Param{Name: "token", In: "query", Description: "feed token", Required: true},
+					openapi.Param{Name: "as", In: "query", Description: "entries as events (default) or to-dos", Enum: []string{"event", "todo"}},
+					openapi.HeaderParam("If-None-Match", "the ETag of a feed already fetched")),
+				Responses: []openapi.Resp{
+					{Status: http.StatusOK, Body: openapi.Content{"text/calendar": ""}, Headers: map[string]string{"ETag": "hash of the feed"}},
+					{Status: http.StatusNotModified},
+					errResp(http.StatusBadRequest, "Invalid filter or as"),
+					errResp(http.StatusUnauthorized, "Missing or invalid feed token"),
+				},
+			},
+			{
+				Method: "GET", Path: "/tasks/export", Access: openapi.User, Tag: "transfer", Summary: "Export tasks",
+				Description: "The tasks matching the GET /tasks filters as a JSON, CSV or YAML file that POST /tasks/import reads back.",
+				Params: append(taskFilters(),
+					openapi.Param{Name: "format", In: "query", Description: "file format, json by default", Enum: []string{models.FormatJSON, models.FormatCSV, models.FormatYAML}}),
+				Responses: []openapi.Resp{
+					{Status: http.StatusOK, Body: recordFiles(), Headers: map[string]string{"Content-Disposition": "attachment with the file name"}},
+					errResp(http.StatusBadRequest, "Invalid filter or format"),
+				},
+			},
+			{
+				Method: "GET", Path: "/tasks/:id", Access: openapi.User, Tag: "tasks", Summary: "Get a task",
+				Params: []openapi.Param{openapi.HeaderParam("If-None-Match", "the task's ETag, for a 304 when it has not changed")},
+				Responses: []openapi.Resp{
+					taskResp,
+					{Status: http.StatusNotModified},
+					errResp(http.StatusNotFound, "Task not found"),
+				},
+			},
+			{
+				Method: "GET", Path: "/tasks/:id/children", Access: openapi.User, Tag: "tasks", Summary: "List the direct subtasks of a task",
+				Responses: []openapi.Resp{{Status: http.StatusOK, Body: envelope([]models.TaskOut{})}, errResp(http.StatusNotFound, "Task not found")},
+			},
+			{
+				Method: "GET", Path: "/tasks/:id/tree", Access: openapi.User, Tag: "tasks", Summary: "Get a task with all its subtasks nested",
+				Responses: []openapi.Resp{{Status: http.StatusOK, Body: envelope(models.TaskNode{})}, errResp(http.StatusNotFound, "Task not found")},
+			},
+			{
+				Method: "GET", Path: "/tasks/:id/dependencies", Access: openapi.User, Tag: "tasks", Summary: "List what a task waits on",
+				Description: "The task after everything it transitively waits on, each task after its own blockers.",
+				Responses:   []openapi.Resp{{Status: http.StatusOK, Body: envelope([]models.TaskOut{})}, errResp(http.StatusNotFound, "Task not found")},
+			},
+			{
+				Method: "POST", Path: "/tasks", Access: openapi.Admin, Tag: "tasks", Summary: "Create a task",
+				Body: openapi.JSON(models.CreateTaskDTO{}),
+				Responses: []openapi.Resp{
+					{Status: http.StatusCreated, Body: envelope(models.TaskOut{}), Headers: map[string]string{"ETag": "the task's version"}},
+					errResp(http.StatusBadRequest, "Invalid task"),
+					errResp(http.StatusConflict, "The parent or a blocker forbids it"),
+				},
+			},
+			{
+				Method: "PUT", Path: "/tasks/:id", Access: openapi.Admin, Tag: "tasks", Summary: "Update a task",
+				Description: "Changes the fields present in the body.",
+				Params:      []openapi.Param{ifMatch},
+				Body:        openapi.JSON(models.UpdateTaskDTO{}),
+				Responses:   writeResps(taskResp),
+			},
+			{
+				Method: "PATCH", Path: "/tasks/:id", Access: openapi.Admin, Tag: "tasks", Summary: "Patch a task",
+				Description: "A JSON Merge Patch (RFC 7396) or JSON Patch (RFC 6902) of the task, chosen by Content-Type.",
+				Params:      []openapi.Param{ifMatch},
+				Body: openapi.Content{
+					"application/merge-patch+json": models.UpdateTaskDTO{},
+					"application/json-patch+json":  []patch.Operation{},
+				},
+				Responses: append(writeResps(taskResp), errResp(http.StatusUnsupportedMediaType, "Neither patch media type")),
+			},
+			{
+				Method: "DELETE", Path: "/tasks/:id", Access: openapi.Admin, Tag: "tasks", Summary: "Delete a task",
+				Params: []openapi.Param{ifMatch, {Name: "cascade", In: "query", Description: "also delete its subtasks", Type: false}},
+				Responses: []openapi.Resp{
+					{Status: http.StatusNoContent},
+					errResp(http.StatusNotFound, "Task not found"),
+					errResp(http.StatusConflict, "It has subtasks or dependents"),
+					errResp(http.StatusPreconditionFailed, "If-Match does not match"),
+				},
+			},
+			{
+				Method: "POST", Path: "/tasks/batch", Access: openapi.Admin, Tag: "tasks", Summary: "Apply many writes at once",
+				Description: "Creates, updates and deletes in order. In atomic mode the first failure undoes the batch and is answered on its own, with its index.",
+				Body:        openapi.JSON(models.BatchRequest{}),
+				Responses: []openapi.Resp{
+					{Status: http.StatusOK, Body: envelope([]models.BatchResult{})},
+					errResp(http.StatusBadRequest, "Malformed batch or operation"),
+					errResp(http.StatusConflict, "An atomic batch failed"),
+				},
+			},
+			{
+				Method: "POST", Path: "/tasks/import", Access: openapi.Admin, Tag: "transfer", Summary: "Import tasks",
+				Description: "Stores the tasks of an export file. A task missing a required field rejects the file; other failures only skip that task and are reported.",
+				Params: []openapi.Param{
+					{Name: "format", In: "query", Description: "file format; defaults to the Content-Type, else json", Enum: []string{models.FormatJSON, models.FormatCSV, models.FormatYAML}},
+					{Name: "on_conflict", In: "query", Description: "what to do with a task whose id is taken, skip by default", Type: models.ConflictPolicy("")},
+				},
+				Body: recordFiles(),
+				Responses: []openapi.Resp{
+					{Status: http.StatusOK, Body: envelope(models.ImportReport{})},
+					errResp(http.StatusBadRequest, "Invalid file, format or on_conflict"),
+					errResp(http.StatusRequestEntityTooLarge, "File too large"),
+				},
+			},
+			{
+				Method: "POST", Path: "/tasks/:id/blockers", Access: openapi.Admin, Tag: "tasks", Summary: "Block a task on another",
+				Params: []openapi.Param{ifMatch},
+				Body: openapi.JSON(struct {
+					TaskID string `json:"task_id" binding:"required"`
+				}{}),
+				Responses: writeResps(taskResp),
+			},
+			{
+				Method: "DELETE", Path: "/tasks/:id/blockers/:blocker", Access: openapi.Admin, Tag: "tasks", Summary: "Unblock a task",
+				Params:    []openapi.Param{ifMatch},
+				Responses: writeResps(taskResp),
+			},
+
+			{
+				Method: "GET", Path: "/webhooks", Access: openapi.Admin, Tag: "webhooks", Summary: "List webhooks",
+				Responses: []openapi.Resp{{Status: http.StatusOK, Body: envelope([]models.Webhook{})}},
+			},
+			{
+				Method: "GET", Path: "/webhooks/:id", Access: openapi.Admin, Tag: "webhooks", Summary: "Get a webhook",
+				Responses: []openapi.Resp{{Status: http.StatusOK, Body: envelope(models.Webhook{})}, errResp(http.StatusNotFound, "Webhook not found")},
+			},
+			{
+				Method: "POST", Path: "/webhooks", Access: openapi.Admin, Tag: "webhooks", Summary: "Create a webhook",
+				Description: "The answer holds the signing secret; it is not shown again.",
+				Body:        openapi.JSON(models.WebhookDTO{}),
+				Responses:   []openapi.Resp{{Status: http.StatusCreated, Body: envelope(models.Webhook{})}, errResp(http.StatusBadRequest, "Invalid URL or event")},
+			},
+			{
+				Method: "PUT", Path: "/webhooks/:id", Access: openapi.Admin, Tag: "webhooks", Summary: "Replace a webhook",
+				Body: openapi.JSON(models.WebhookDTO{}),
+				Responses: []openapi.Resp{
+					{Status: http.StatusOK, Body: envelope(models.Webhook{})},
+					errResp(http.StatusBadRequest, "Invalid URL or event"),
+					errResp(http.StatusNotFound, "Webhook not found"),
+				},
+			},
+			{
+				Method: "DELETE", Path: "/webhooks/:id", Access: openapi.Admin, Tag: "webhooks", Summary: "Delete a webhook",
+				Responses: []openapi.Resp{{Status: http.StatusNoContent}, errResp(http.StatusNotFound, "Webhook not found")},
+			},
+			{
+				Method: "GET", Path: "/webhooks/:id/deliveries", Access: openapi.Admin, Tag: "webhooks", Summary: "List a webhook's deliveries",
+				Description: "status=failed gives the dead letters.",
+				Params:      []openapi.Param{{Name: "status", In: "query", Type: models.DeliveryStatus("")}},
+				Responses: []openapi.Resp{
+					{Status: http.StatusOK, Body: envelope([]models.WebhookDelivery{})},
+					errResp(http.StatusBadRequest, "Invalid status"),
+					errResp(http.StatusNotFound, "Webhook not found"),
+				},
+			},
+			{
+				Method: "POST", Path: "/webhooks/:id/deliveries/:delivery/redeliver", Access: openapi.Admin, Tag: "webhooks", Summary: "Send a delivery again",
+				Description: "Queues the delivery with a fresh set of attempts.",
+				Responses:   []openapi.Resp{{Status: http.StatusAccepted, Body: envelope(models.WebhookDelivery{})}, errResp(http.StatusNotFound, "Webhook or delivery not found")},
+			},
+
+			{
+				Method: "POST", Path: "/register", Tag: "users", Summary: "Create an account",
+				Description: "The first account is an admin; later ones are users until promoted.",
+				Body:        openapi.JSON(models.RegisterDTO{}),
+				Responses: []openapi.Resp{
+					{Status: http.StatusCreated, Body: envelope(models.UserOut{})},
+					errResp(http.StatusBadRequest, "Invalid username or password"),
+					errResp(http.StatusConflict, "Username already exists"),
+				},
+			},
+			{
+				Method: "POST", Path: "/login", Tag: "users", Summary: "Get a bearer token",
+				Body: openapi.JSON(models.LoginDTO{}),
+				Responses: []openapi.Resp{
+					{Status: http.StatusOK, Body: openapi.JSON(struct {
+						AccessToken string         `json:"access_token"`
+						TokenType   string         `json:"token_type"`
+						ExpiresIn   int            `json:"expires_in"` // seconds
+						User        models.UserOut `json:"user"`
+					}{})},
+					errResp(http.StatusBadRequest, "Invalid request body"),
+					errResp(http.StatusUnauthorized, "Invalid username or password"),
+				},
+			},
+			{
+				Method: "POST", Path: "/promote", Tag: "users", Summary: "Make a user an admin", Access: openapi.Admin,
+				Body:      openapi.JSON(models.PromoteDTO{}),
+				Responses: []openapi.Resp{{Status: http.StatusOK, Body: envelope(models.UserOut{})}, errResp(http.StatusNotFound, "User not found")},
+			},
+			{
+				Method: "POST", Path: "/calendar/token", Tag: "transfer", Summary: "Get a calendar feed token", Access: openapi.User,
+				Description: "Replaces the caller's feed token, if any, and answers with the feed URL for GET /tasks.ics.",
+				Responses: []openapi.Resp{{Status: http.StatusCreated, Body: envelope(struct {
+					Token string `json:"token"`
+					URL   string `json:"url"`
+				}{})}},
+			},
+			{
+				Method: "DELETE", Path: "/calendar/token", Tag: "transfer", Summary: "Revoke the calendar feed token", Access: openapi.User,
+				Responses: []openapi.Resp{{Status: http.StatusNoContent}},
+			},
+
+			{
+				Method: "GET", Path: "/health", Tag: "meta", Summary: "Health check",
+				Responses: []openapi.Resp{{Status: http.StatusOK, Body: openapi.JSON(map[string]string{})}},
+			},
+			{
+				Method: "GET", Path: "/metrics", Tag: "meta", Summary: "Prometheus metrics",
+				Description: "Request counts and latencies by route, MongoDB command latencies and failures, and task counts by status, in the Prometheus text format.",
+				Responses:   []openapi.Resp{{Status: http.StatusOK, Body: openapi.Content{"text/plain": ""}}},
+			},
+			{
+				Method: "GET", Path: "/openapi.json", Tag: "meta", Summary: "This document",
+				Responses: []openapi.Resp{{Status: http.StatusOK, Body: openapi.JSON(map[string]any{})}},
+			},
+			{
+				Method: "GET", Path: "/docs", Tag: "meta", Summary: "Browse and try this document",
+				Responses: []openapi.Resp{{Status: http.StatusOK, Body: openapi.Content{"text/html": ""}}},
+			},
+		},
+	}
+	// Every route but the meta ones is rate limited.
+	for i, op := range spec.Ops {
+		if op.Tag != "meta" {
+			spec.Ops[i].Responses = append(op.Responses, tooManyRequests)
+		}
+	}
+	return spec
+}
+
+// tooManyRequests answers a client over the rate limit of a route group;
+// see middleware.RateLimiter.
+var tooManyRequests = openapi.Resp{
+	Status:      http.StatusTooManyRequests,
+	Description: "Over the rate limit",
+	Body:        openapi.JSON(ErrorResponse{}),
+	Headers: map[string]string{
+		"Retry-After":         "seconds until the next request is allowed",
+		"RateLimit-Limit":     "requests allowed in a burst; sent on every answer, like the other RateLimit headers",
+		"RateLimit-Remaining": "requests left in the current burst",
+		"RateLimit-Reset":     "seconds until the full burst is available again",
+		"RateLimit-Policy":    "the limit as requests;w=window in seconds",
+	},
+}
+
+// taskFilters are the GET /tasks query parameters that narrow the tasks;
+// see parseTaskQuery.
+func taskFilters() []openapi.Param {
+	params := []openapi.Param{
+		openapi.Query("status", "comma-separated statuses"),
+		openapi.Query("title", "case-insensitive substring of the title"),
+		openapi.Query("priority", "comma-separated priorities"),
+		openapi.Query("label", "comma-separated labels, all of which a task carries"),
+		openapi.Query("assignee", "tasks assigned to this user"),
+	}
+	for _, b := range []string{"due", "created", "updated"} {
+		params = append(params,
+			openapi.Query(b+"_from", "RFC3339 lower bound of "+b+", inclusive"),
+			openapi.Query(b+"_to", "RFC3339 upper bound of "+b+", inclusive"))
+	}
+	return params
+}
+
+func pageParams() []openapi.Param {
+	return []openapi.Param{
+		openapi.Query("sort", `a task field, "-" first for descending, e.g. -due_date`),
+		{Name: "limit", In: "query", Description: "page size", Type: 0},
+		{Name: "offset", In: "query", Description: "page start", Type: 0},
+		openapi.Query("cursor", "next_cursor of the previous page"),
+	}
+}
+
+// writeResps are the answers of the writes to one task.
+func writeResps(ok openapi.Resp) []openapi.Resp {
+	return []openapi.Resp{
+		ok,
+		errResp(http.StatusBadRequest, "Invalid change"),
+		errResp(http.StatusNotFound, "Task not found"),
+		errResp(http.StatusConflict, "The workflow, subtasks or blockers forbid it"),
+		errResp(http.StatusPreconditionFailed, "If-Match does not match"),
+	}
+}
+
+// recordFiles is an export file in each format.
+func recordFiles() openapi.Content {
+	return openapi.Content{
+		"application/json": []models.TaskRecord{},
+		"text/csv":         "",
+		"application/yaml": []models.TaskRecord{},
+	}
+}
+
+// envelope is a JSON body holding v under "data".
+func envelope(v any) openapi.Content {
+	t := reflect.StructOf([]reflect.StructField{{Name: "Data", Type: reflect.TypeOf(v), Tag: `json:"data"`}})
+	return openapi.JSON(reflect.New(t).Elem().Interface())
+}
+
+func errResp(status int, description string) openapi.Resp {
+	return openapi.Resp{Status: status, Description: description, Body: openapi.JSON(ErrorResponse{})}
+}
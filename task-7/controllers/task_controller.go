@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"os"
 	"time"
@@ -9,40 +11,77 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 
 	"task_manager/data"
+	"task_manager/metrics"
 	"task_manager/middleware"
 	"task_manager/models"
+	"task_manager/patch"
 )
 
 type Controller struct {
-	TaskSvc *data.TaskService
+	TaskSvc data.TaskRepository
 	UserSvc *data.UserService
+	HookSvc data.WebhookRepository
+	Metrics *metrics.Metrics
+	Limiter *middleware.RateLimiter // limits the auth, feed and api groups; nil doesn't limit
 }
 
-func NewController(ts *data.TaskService, us *data.UserService) *Controller {
-	return &Controller{TaskSvc: ts, UserSvc: us}
+func NewController(ts data.TaskRepository, us *data.UserService, hs data.WebhookRepository, m *metrics.Metrics, rl *middleware.RateLimiter) *Controller {
+	return &Controller{TaskSvc: ts, UserSvc: us, HookSvc: hs, Metrics: m, Limiter: rl}
 }
 
 func (ctr *Controller) RegisterRoutes(r *gin.Engine) {
 	// Public
 	r.GET("/health", func(c *gin.Context) { c.JSON(200, gin.H{"status": "ok"}) })
-	r.POST("/register", ctr.Register)
-	r.POST("/login", ctr.Login)
+	r.GET("/metrics", ctr.Metrics.Handler())
 
-	// Authenticated routes
-	auth := r.Group("/", middleware.AuthRequired())
+	// Public, limited per client IP
+	login := r.Group("/", ctr.Limiter.Limit("auth", middleware.ByIP))
+	login.POST("/register", ctr.Register)
+	login.POST("/login", ctr.Login)
+	feed := r.Group("/", ctr.Limiter.Limit("feed", middleware.ByIP))
+	feed.GET("/tasks.ics", ctr.TaskCalendar) // authenticated by feed token
+
+	// Authenticated routes, limited per user
+	auth := r.Group("/", middleware.AuthRequired(), ctr.Limiter.Limit("api", middleware.ByUser))
 
 	// Tasks: GET allowed to all authenticated users
 	auth.GET("/tasks", ctr.ListTasks)
+	auth.GET("/tasks/events", ctr.TaskEvents)
+	auth.GET("/tasks/export", ctr.ExportTasks)
 	auth.GET("/tasks/:id", ctr.GetTask)
+	auth.GET("/tasks/:id/children", ctr.GetTaskChildren)
+	auth.GET("/tasks/:id/tree", ctr.GetTaskTree)
+	auth.GET("/tasks/:id/dependencies", ctr.GetTaskDependencies)
+
+	// Calendar feed token of the caller
+	auth.POST("/calendar/token", ctr.CreateFeedToken)
+	auth.DELETE("/calendar/token", ctr.RevokeFeedToken)
 
 	// Admin-only task mutations
 	admin := auth.Group("/", middleware.AdminOnly())
 	admin.POST("/tasks", ctr.CreateTask)
 	admin.PUT("/tasks/:id", ctr.UpdateTask)
+	admin.PATCH("/tasks/:id", ctr.PatchTask)
 	admin.DELETE("/tasks/:id", ctr.DeleteTask)
+	admin.POST("/tasks/batch", ctr.BatchTasks)
+	admin.POST("/tasks/import", ctr.ImportTasks)
+	admin.POST("/tasks/:id/blockers", ctr.AddTaskBlocker)
+	admin.DELETE("/tasks/:id/blockers/:blocker", ctr.RemoveTaskBlocker)
 
 	// Admin-only user management
 	admin.POST("/promote", ctr.PromoteUser)
+
+	// Admin-only webhooks
+	admin.GET("/webhooks", ctr.ListWebhooks)
+	admin.GET("/webhooks/:id", ctr.GetWebhook)
+	admin.POST("/webhooks", ctr.CreateWebhook)
+	admin.PUT("/webhooks/:id", ctr.UpdateWebhook)
+	admin.DELETE("/webhooks/:id", ctr.DeleteWebhook)
+	admin.GET("/webhooks/:id/deliveries", ctr.ListWebhookDeliveries)
+	admin.POST("/webhooks/:id/deliveries/:delivery/redeliver", ctr.RedeliverWebhook)
+
+	// API docs, built from the routes above; keep this last.
+	registerDocs(r)
 }
 
 /* --------------------- Auth handlers --------------------- */
@@ -59,7 +98,7 @@ func (ctr *Controller) Register(c *gin.Context) {
 		case data.ErrUserExists:
 			c.JSON(http.StatusConflict, gin.H{"error": "username already exists"})
 		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			fail(c, http.StatusInternalServerError, "internal error", err)
 		}
 		return
 	}
@@ -84,7 +123,7 @@ func (ctr *Controller) Login(c *gin.Context) {
 	}
 	token, err := makeJWT(toHex(u.ID), u.Username, string(u.Role))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "token generation failed"})
+		fail(c, http.StatusInternalServerError, "token generation failed", err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
@@ -111,7 +150,7 @@ func (ctr *Controller) PromoteUser(c *gin.Context) {
 		case data.ErrUserNotFound:
 			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
 		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			fail(c, http.StatusInternalServerError, "internal error", err)
 		}
 		return
 	}
@@ -138,6 +177,11 @@ func makeJWT(uid, username, role string) (string, error) {
 	return tkn.SignedString([]byte(secret))
 }
 
+// invalidStatusMsg lists the statuses of the configured workflow.
+func invalidStatusMsg() string {
+	return "invalid status (" + data.StatusList(models.CurrentWorkflow().Names()) + ")"
+}
+
 func toHex(id interface{}) string {
 	if oid, ok := id.(interface{ Hex() string }); ok {
 		return oid.Hex()
@@ -148,12 +192,18 @@ func toHex(id interface{}) string {
 /* --------------------- Task handlers --------------------- */
 
 func (ctr *Controller) ListTasks(c *gin.Context) {
-	tasks, err := ctr.TaskSvc.List(c.Request.Context())
+	q, err := parseTaskQuery(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"data": tasks})
+	page, err := ctr.TaskSvc.List(c.Request.Context(), q)
+	if err != nil {
+		code, msg := listStatus(err)
+		fail(c, code, msg, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
 }
 
 func (ctr *Controller) GetTask(c *gin.Context) {
@@ -164,10 +214,16 @@ func (ctr *Controller) GetTask(c *gin.Context) {
 		case data.ErrNotFound:
 			c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
 		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			fail(c, http.StatusInternalServerError, "internal error", err)
 		}
 		return
 	}
+	tag := etag(t.Version)
+	c.Header("ETag", tag)
+	if notModified(c, tag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"data": t})
 }
 
@@ -179,16 +235,11 @@ func (ctr *Controller) CreateTask(c *gin.Context) {
 	}
 	t, err := ctr.TaskSvc.Create(c.Request.Context(), dto)
 	if err != nil {
-		switch err {
-		case data.ErrInvalidStatus:
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status (pending|in_progress|done)"})
-		case data.ErrInvalidDate:
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid due_date (RFC3339)"})
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
-		}
+		code, msg := createStatus(err)
+		fail(c, code, msg, err)
 		return
 	}
+	c.Header("ETag", etag(t.Version))
 	c.JSON(http.StatusCreated, gin.H{"data": t})
 }
 
@@ -199,33 +250,266 @@ func (ctr *Controller) UpdateTask(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
 		return
 	}
-	t, err := ctr.TaskSvc.Update(c.Request.Context(), id, dto)
+	version, ok := ctr.expectedVersion(c, id)
+	if !ok {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": data.ErrVersionMismatch.Error()})
+		return
+	}
+	t, err := ctr.TaskSvc.Update(c.Request.Context(), id, dto, version)
+	if err != nil {
+		code, msg := updateStatus(err)
+		fail(c, code, msg, err)
+		return
+	}
+	c.Header("ETag", etag(t.Version))
+	c.JSON(http.StatusOK, gin.H{"data": t})
+}
+
+// PatchTask accepts either a JSON Merge Patch or a JSON Patch, chosen by
+// Content-Type.
+func (ctr *Controller) PatchTask(c *gin.Context) {
+	id := c.Param("id")
+	var apply func(doc, p []byte) ([]byte, error)
+	switch c.ContentType() {
+	case "application/merge-patch+json":
+		apply = patch.Merge
+	case "application/json-patch+json":
+		apply = patch.Apply
+	default:
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "use application/merge-patch+json or application/json-patch+json"})
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	version, ok := ctr.expectedVersion(c, id)
+	if !ok {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": data.ErrVersionMismatch.Error()})
+		return
+	}
+
+	t, err := data.PatchTask(c.Request.Context(), ctr.TaskSvc, id, version, func(doc []byte) ([]byte, error) {
+		return apply(doc, body)
+	})
+	if err != nil {
+		code, msg := patchStatus(err)
+		fail(c, code, msg, err)
+		return
+	}
+	c.Header("ETag", etag(t.Version))
+	c.JSON(http.StatusOK, gin.H{"data": t})
+}
+
+func (ctr *Controller) DeleteTask(c *gin.Context) {
+	id := c.Param("id")
+	version, ok := ctr.expectedVersion(c, id)
+	if !ok {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": data.ErrVersionMismatch.Error()})
+		return
+	}
+	cascade := c.Query("cascade") == "true"
+	if err := ctr.TaskSvc.Delete(c.Request.Context(), id, version, cascade); err != nil {
+		code, msg := deleteStatus(err)
+		fail(c, code, msg, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetTaskChildren lists the direct subtasks of a task.
+func (ctr *Controller) GetTaskChildren(c *gin.Context) {
+	children, err := ctr.TaskSvc.Children(c.Request.Context(), c.Param("id"))
 	if err != nil {
 		switch err {
 		case data.ErrNotFound:
 			c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
-		case data.ErrInvalidStatus:
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status (pending|in_progress|done)"})
-		case data.ErrInvalidDate:
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid due_date (RFC3339)"})
 		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			fail(c, http.StatusInternalServerError, "internal error", err)
 		}
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"data": t})
+	c.JSON(http.StatusOK, gin.H{"data": children})
 }
 
-func (ctr *Controller) DeleteTask(c *gin.Context) {
+// GetTaskTree returns a task with its whole subtree nested under it.
+func (ctr *Controller) GetTaskTree(c *gin.Context) {
+	tree, err := ctr.TaskSvc.Tree(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		switch err {
+		case data.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		default:
+			fail(c, http.StatusInternalServerError, "internal error", err)
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": tree})
+}
+
+// AddTaskBlocker marks the task as blocked by the task named in the body.
+func (ctr *Controller) AddTaskBlocker(c *gin.Context) {
+	var body struct {
+		TaskID string `json:"task_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	ctr.editBlockers(c, func(id string, version int64) (models.TaskOut, error) {
+		return data.AddBlocker(c.Request.Context(), ctr.TaskSvc, id, body.TaskID, version)
+	})
+}
+
+// RemoveTaskBlocker drops one blocked-by edge from the task.
+func (ctr *Controller) RemoveTaskBlocker(c *gin.Context) {
+	ctr.editBlockers(c, func(id string, version int64) (models.TaskOut, error) {
+		return data.RemoveBlocker(c.Request.Context(), ctr.TaskSvc, id, c.Param("blocker"), version)
+	})
+}
+
+func (ctr *Controller) editBlockers(c *gin.Context, edit func(id string, version int64) (models.TaskOut, error)) {
 	id := c.Param("id")
-	if err := ctr.TaskSvc.Delete(c.Request.Context(), id); err != nil {
+	version, ok := ctr.expectedVersion(c, id)
+	if !ok {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": data.ErrVersionMismatch.Error()})
+		return
+	}
+	t, err := edit(id, version)
+	if err != nil {
 		switch err {
 		case data.ErrNotFound:
 			c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		case data.ErrVersionMismatch:
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+		case data.ErrInvalidBlocker, data.ErrDependencyCycle:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			fail(c, http.StatusInternalServerError, "internal error", err)
 		}
 		return
 	}
-	c.Status(http.StatusNoContent)
+	c.Header("ETag", etag(t.Version))
+	c.JSON(http.StatusOK, gin.H{"data": t})
+}
+
+// GetTaskDependencies lists the task after everything it transitively waits
+// on, each task after its own blockers.
+func (ctr *Controller) GetTaskDependencies(c *gin.Context) {
+	tasks, err := data.DependencyOrder(c.Request.Context(), ctr.TaskSvc, c.Param("id"))
+	if err != nil {
+		switch err {
+		case data.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		default:
+			fail(c, http.StatusInternalServerError, "internal error", err)
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": tasks})
+}
+
+// listStatus maps a List error to its response status and message.
+func listStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, data.ErrInvalidQuery):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, data.ErrInvalidStatus):
+		return http.StatusBadRequest, invalidStatusMsg()
+	case errors.Is(err, data.ErrInvalidPriority):
+		return http.StatusBadRequest, "invalid priority (low|medium|high|urgent)"
+	default:
+		return http.StatusInternalServerError, "internal error"
+	}
+}
+
+// createStatus maps a Create error to its response status and message.
+func createStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, data.ErrInvalidStatus):
+		return http.StatusBadRequest, invalidStatusMsg()
+	case errors.Is(err, data.ErrInvalidDate):
+		return http.StatusBadRequest, "invalid due_date (RFC3339)"
+	case errors.Is(err, data.ErrInvalidPriority):
+		return http.StatusBadRequest, "invalid priority (low|medium|high|urgent)"
+	case errors.Is(err, data.ErrInvalidParent), errors.Is(err, data.ErrParentCycle),
+		errors.Is(err, data.ErrInvalidBlocker), errors.Is(err, data.ErrDependencyCycle),
+		errors.Is(err, data.ErrInvalidLabels), errors.Is(err, data.ErrInvalidAssignee),
+		errors.Is(err, data.ErrInvalidRecurrence), errors.Is(err, data.ErrInvalidTimeZone),
+		errors.Is(err, data.ErrInvalidTransition):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, data.ErrOpenSubtasks), errors.Is(err, data.ErrBlocked):
+		return http.StatusConflict, err.Error()
+	default:
+		return http.StatusInternalServerError, "internal error"
+	}
+}
+
+// updateStatus maps an Update error to its response status and message.
+func updateStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, data.ErrNotFound):
+		return http.StatusNotFound, "task not found"
+	case errors.Is(err, data.ErrVersionMismatch):
+		return http.StatusPreconditionFailed, err.Error()
+	case errors.Is(err, data.ErrInvalidStatus):
+		return http.StatusBadRequest, invalidStatusMsg()
+	case errors.Is(err, data.ErrInvalidDate):
+		return http.StatusBadRequest, "invalid due_date (RFC3339)"
+	case errors.Is(err, data.ErrInvalidPriority):
+		return http.StatusBadRequest, "invalid priority (low|medium|high|urgent)"
+	case errors.Is(err, data.ErrInvalidParent), errors.Is(err, data.ErrParentCycle),
+		errors.Is(err, data.ErrInvalidBlocker), errors.Is(err, data.ErrDependencyCycle),
+		errors.Is(err, data.ErrInvalidLabels), errors.Is(err, data.ErrInvalidAssignee),
+		errors.Is(err, data.ErrInvalidRecurrence), errors.Is(err, data.ErrInvalidTimeZone):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, data.ErrOpenSubtasks), errors.Is(err, data.ErrBlocked),
+		errors.Is(err, data.ErrInvalidTransition):
+		return http.StatusConflict, err.Error()
+	default:
+		return http.StatusInternalServerError, "internal error"
+	}
+}
+
+// patchStatus maps a PatchTask error to its response status and message.
+// Errors from the patch itself are handled here, the rest like Update's.
+func patchStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, patch.ErrTestFailed):
+		return http.StatusConflict, err.Error()
+	case errors.Is(err, patch.ErrInvalid), errors.Is(err, data.ErrInvalidPatch):
+		return http.StatusBadRequest, err.Error()
+	default:
+		return updateStatus(err)
+	}
+}
+
+// deleteStatus maps a Delete error to its response status and message.
+func deleteStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, data.ErrNotFound):
+		return http.StatusNotFound, "task not found"
+	case errors.Is(err, data.ErrHasSubtasks):
+		return http.StatusConflict, err.Error()
+	case errors.Is(err, data.ErrVersionMismatch):
+		return http.StatusPreconditionFailed, err.Error()
+	default:
+		return http.StatusInternalServerError, "internal error"
+	}
+}
+
+// fail answers with an error message. A 5xx hides its cause from the
+// client, so the cause goes to the access log instead.
+func fail(c *gin.Context, code int, msg string, err error) {
+	logCause(c, code, err)
+	c.JSON(code, gin.H{"error": msg})
+}
+
+// logCause attaches err to the request for the access log when code is a
+// 5xx.
+func logCause(c *gin.Context, code int, err error) {
+	if code >= http.StatusInternalServerError && err != nil {
+		_ = c.Error(err)
+	}
 }
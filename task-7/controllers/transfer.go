@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"task_manager/data"
+	"task_manager/models"
+	"task_manager/taskio"
+)
+
+// maxImportBytes caps the body of POST /tasks/import.
+const maxImportBytes = 32 << 20
+
+// ExportTasks serves the tasks matching the GET /tasks filters as a file:
+// format=json (the default), csv or yaml.
+func (ctr *Controller) ExportTasks(c *gin.Context) {
+	format := c.DefaultQuery("format", models.FormatJSON)
+	if !models.IsValidFormat(format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid format (json|csv|yaml)"})
+		return
+	}
+	q, err := parseTaskQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	records, err := data.ExportTasks(c.Request.Context(), ctr.TaskSvc, q)
+	if err != nil {
+		code, msg := listStatus(err)
+		fail(c, code, msg, err)
+		return
+	}
+	var buf bytes.Buffer
+	if err := taskio.Write(&buf, format, records); err != nil {
+		fail(c, http.StatusInternalServerError, "internal error", err)
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="tasks.`+format+`"`)
+	c.Data(http.StatusOK, taskio.ContentType(format), buf.Bytes())
+}
+
+// ImportTasks stores the tasks of a file in the body, in the format named by
+// format or else by the Content-Type. on_conflict says what to do with a
+// task whose id is taken. A task missing a required field rejects the whole
+// file before anything is stored; any other failure only skips that task,
+// and the report says what happened to each one.
+func (ctr *Controller) ImportTasks(c *gin.Context) {
+	format := cmp.Or(c.Query("format"), taskio.FormatOf(c.ContentType()), models.FormatJSON)
+	if !models.IsValidFormat(format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid format (json|csv|yaml)"})
+		return
+	}
+	policy := models.ConflictPolicy(c.DefaultQuery("on_conflict", string(models.DefaultConflictPolicy)))
+	if !models.IsValidConflictPolicy(policy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid on_conflict (skip|overwrite|new_id)"})
+		return
+	}
+	records, err := taskio.Read(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes), format)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("file too large (max %d bytes)", maxImportBytes)})
+		return
+	case errors.Is(err, taskio.ErrInvalidFile):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	if len(records) == 0 || len(records) > models.MaxImportSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("an import takes 1 to %d tasks", models.MaxImportSize)})
+		return
+	}
+	for i := range records {
+		if binding.Validator.ValidateStruct(&records[i]) != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("tasks[%d]: task needs a title, due_date and status", i), "index": i})
+			return
+		}
+	}
+
+	results := data.ImportTasks(c.Request.Context(), ctr.TaskSvc, records, policy)
+	report := models.ImportReport{Results: make([]models.ImportResult, len(results))}
+	for i, r := range results {
+		out := models.ImportResult{Index: i, ID: records[i].ID, Action: r.Action, TaskID: r.Task.ID}
+		switch r.Action {
+		case models.ImportCreated:
+			report.Created++
+		case models.ImportUpdated:
+			report.Updated++
+		case models.ImportSkipped:
+			report.Skipped++
+		default:
+			report.Failed++
+			code, msg := importError(r.Err)
+			logCause(c, code, r.Err)
+			out.Error = msg
+		}
+		report.Results[i] = out
+	}
+	c.JSON(http.StatusOK, gin.H{"data": report})
+}
+
+// importError explains why one task of an import failed, with the status
+// the single-task endpoints would answer.
+func importError(err error) (int, string) {
+	if errors.Is(err, data.ErrDuplicateRecord) || errors.Is(err, data.ErrRecordCycle) || errors.Is(err, data.ErrRecordDependent) {
+		return http.StatusBadRequest, err.Error()
+	}
+	return updateStatus(err)
+}
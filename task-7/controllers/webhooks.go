@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"task_manager/data"
+	"task_manager/models"
+)
+
+func (ctr *Controller) ListWebhooks(c *gin.Context) {
+	hooks, err := ctr.HookSvc.ListWebhooks(c.Request.Context())
+	if err != nil {
+		fail(c, http.StatusInternalServerError, "internal error", err)
+		return
+	}
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	c.JSON(http.StatusOK, gin.H{"data": hooks})
+}
+
+func (ctr *Controller) GetWebhook(c *gin.Context) {
+	hook, err := ctr.HookSvc.GetWebhook(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		code, msg := webhookStatus(err)
+		fail(c, code, msg, err)
+		return
+	}
+	hook.Secret = ""
+	c.JSON(http.StatusOK, gin.H{"data": hook})
+}
+
+// CreateWebhook answers with the webhook's secret, which is not shown again.
+func (ctr *Controller) CreateWebhook(c *gin.Context) {
+	var dto models.WebhookDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	hook, err := ctr.HookSvc.CreateWebhook(c.Request.Context(), dto)
+	if err != nil {
+		code, msg := webhookStatus(err)
+		fail(c, code, msg, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": hook})
+}
+
+func (ctr *Controller) UpdateWebhook(c *gin.Context) {
+	var dto models.WebhookDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	hook, err := ctr.HookSvc.UpdateWebhook(c.Request.Context(), c.Param("id"), dto)
+	if err != nil {
+		code, msg := webhookStatus(err)
+		fail(c, code, msg, err)
+		return
+	}
+	hook.Secret = ""
+	c.JSON(http.StatusOK, gin.H{"data": hook})
+}
+
+func (ctr *Controller) DeleteWebhook(c *gin.Context) {
+	if err := ctr.HookSvc.DeleteWebhook(c.Request.Context(), c.Param("id")); err != nil {
+		code, msg := webhookStatus(err)
+		fail(c, code, msg, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries lists a webhook's delivery log, newest first. status=failed
+// gives the dead letters.
+func (ctr *Controller) ListWebhookDeliveries(c *gin.Context) {
+	status := models.DeliveryStatus(c.Query("status"))
+	if status != "" && !models.IsValidDeliveryStatus(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status (pending|succeeded|failed)"})
+		return
+	}
+	deliveries, err := ctr.HookSvc.Deliveries(c.Request.Context(), c.Param("id"), status)
+	if err != nil {
+		code, msg := webhookStatus(err)
+		fail(c, code, msg, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": deliveries})
+}
+
+// RedeliverWebhook queues a delivery again with a fresh set of attempts.
+func (ctr *Controller) RedeliverWebhook(c *gin.Context) {
+	delivery, err := ctr.HookSvc.Redeliver(c.Request.Context(), c.Param("id"), c.Param("delivery"))
+	if err != nil {
+		code, msg := webhookStatus(err)
+		fail(c, code, msg, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"data": delivery})
+}
+
+func webhookStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, data.ErrWebhookNotFound), errors.Is(err, data.ErrDeliveryNotFound):
+		return http.StatusNotFound, err.Error()
+	case errors.Is(err, data.ErrInvalidWebhookURL), errors.Is(err, data.ErrInvalidWebhookEvent):
+		return http.StatusBadRequest, err.Error()
+	default:
+		return http.StatusInternalServerError, "internal error"
+	}
+}
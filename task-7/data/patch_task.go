@@ -0,0 +1,103 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"task_manager/models"
+)
+
+var ErrInvalidPatch = errors.New("patch would leave the task invalid")
+
+// patchable lists the task fields a patch may change, mapped to the value
+// that removing the field stands for; nil marks fields that must stay.
+// Everything else in the document is read-only.
+var patchable = map[string]any{
+	"title":       nil,
+	"description": "",
+	"due_date":    nil,
+	"status":      nil,
+	"parent_id":   "",
+	"blocked_by":  []any{},
+	"priority":    nil,
+	"labels":      []any{},
+	"assignee":    "",
+	"recurrence":  "",
+	"time_zone":   "",
+}
+
+// patchRetries bounds how often an unconditional patch is re-applied when a
+// concurrent write bumps the version underneath it.
+const patchRetries = 3
+
+// PatchTask applies a document-level patch to the task's JSON form and
+// stores the result as a single versioned update, so either every change
+// lands or none does. apply receives the current task and returns the
+// patched document; version works as for Update.
+func PatchTask(ctx context.Context, repo TaskRepository, id string, version int64, apply func(doc []byte) ([]byte, error)) (models.TaskOut, error) {
+	return updateFrom(ctx, repo, id, version, func(cur models.TaskOut) (models.UpdateTaskDTO, error) {
+		doc, err := json.Marshal(cur)
+		if err != nil { return models.UpdateTaskDTO{}, err }
+		patched, err := apply(doc)
+		if err != nil { return models.UpdateTaskDTO{}, err }
+		return patchedDTO(doc, patched)
+	})
+}
+
+// updateFrom derives an update from the current task and writes it against
+// the version it was derived from. When the caller asked for AnyVersion, a
+// concurrent write just means deriving again.
+func updateFrom(ctx context.Context, repo TaskRepository, id string, version int64, derive func(cur models.TaskOut) (models.UpdateTaskDTO, error)) (models.TaskOut, error) {
+	for attempt := 0; ; attempt++ {
+		cur, err := repo.Get(ctx, id)
+		if err != nil { return models.TaskOut{}, err }
+		if version != AnyVersion && cur.Version != version { return models.TaskOut{}, ErrVersionMismatch }
+		dto, err := derive(cur)
+		if err != nil { return models.TaskOut{}, err }
+		task, err := repo.Update(ctx, id, dto, cur.Version)
+		if errors.Is(err, ErrVersionMismatch) && version == AnyVersion && attempt < patchRetries { continue }
+		return task, err
+	}
+}
+
+// patchedDTO turns a patched task document into an update of the fields
+// that changed, rejecting edits to read-only fields and removal of required
+// ones.
+func patchedDTO(before, after []byte) (models.UpdateTaskDTO, error) {
+	var dto models.UpdateTaskDTO
+	var orig, next map[string]any
+	if err := json.Unmarshal(before, &orig); err != nil { return dto, err }
+	if err := json.Unmarshal(after, &next); err != nil || next == nil { return dto, fmt.Errorf("%w: result is not an object", ErrInvalidPatch) }
+
+	for k := range next {
+		_, editable := patchable[k]
+		if _, known := orig[k]; !editable && !known { return dto, fmt.Errorf("%w: unknown field %q", ErrInvalidPatch, k) }
+	}
+	changed := make(map[string]any)
+	for k, v := range orig {
+		if _, editable := patchable[k]; !editable && !reflect.DeepEqual(next[k], v) { return dto, fmt.Errorf("%w: %s is read-only", ErrInvalidPatch, k) }
+	}
+	for k, removed := range patchable {
+		v := next[k]
+		if v == nil {
+			if removed == nil { return dto, fmt.Errorf("%w: %s is required", ErrInvalidPatch, k) }
+			v = removed
+		}
+		if was, ok := orig[k]; (ok || !reflect.DeepEqual(v, removed)) && !reflect.DeepEqual(was, v) {
+			changed[k] = v
+		}
+	}
+
+	raw, err := json.Marshal(changed)
+	if err != nil { return dto, err }
+	if err := json.Unmarshal(raw, &dto); err != nil {
+		var te *json.UnmarshalTypeError
+		if errors.As(err, &te) { return dto, fmt.Errorf("%w: %s has the wrong type (want %s)", ErrInvalidPatch, te.Field, te.Type) }
+		return dto, err
+	}
+	if dto.Title != nil && *dto.Title == "" { return dto, fmt.Errorf("%w: title is required", ErrInvalidPatch) }
+	return dto, nil
+}
@@ -0,0 +1,67 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"task_manager/rrule"
+)
+
+var (
+	ErrInvalidRecurrence = rrule.ErrInvalid
+	ErrInvalidTimeZone   = errors.New("unknown time zone (use an IANA name such as Europe/Berlin)")
+)
+
+// maxScheduled bounds how many occurrences of one series a scheduler run
+// creates, so a long outage or a tiny interval can't flood the store.
+const maxScheduled = 500
+
+// normalizeRecurrence validates a rule and its time zone and returns the
+// rule in canonical form.
+func normalizeRecurrence(rule, zone string) (string, string, error) {
+	rule, zone = strings.TrimSpace(rule), strings.TrimSpace(zone)
+	if zone != "" {
+		if _, err := time.LoadLocation(zone); err != nil || zone == "Local" { return "", "", ErrInvalidTimeZone }
+	}
+	if rule == "" { return "", zone, nil }
+	r, err := rrule.Parse(rule)
+	if err != nil { return "", "", err }
+	return r.String(), zone, nil
+}
+
+// nextDue returns when the occurrence after the one due at after is due, for
+// a series that starts at start. The rule runs on the wall clock of zone,
+// but the result is in UTC like every other stored time. It is false for
+// tasks that don't recur and once the series has ended.
+func nextDue(rule, zone string, start *time.Time, after time.Time) (time.Time, bool) {
+	if rule == "" || start == nil { return time.Time{}, false }
+	r, err := rrule.Parse(rule)
+	if err != nil { return time.Time{}, false }
+	loc, err := time.LoadLocation(zone)
+	if err != nil { return time.Time{}, false }
+	next, ok := r.Next(start.In(loc), after)
+	return next.UTC(), ok
+}
+
+// RunScheduler creates the occurrences of recurring tasks that fall due
+// within horizon, then again every interval until ctx is done.
+func RunScheduler(ctx context.Context, repo TaskRepository, interval, horizon time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		n, err := repo.ScheduleOccurrences(ctx, time.Now().Add(horizon))
+		if err != nil {
+			slog.WarnContext(ctx, "scheduling recurring tasks", "error", err)
+		} else if n > 0 {
+			slog.InfoContext(ctx, "scheduled recurring tasks", "count", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"task_manager/models"
+)
+
+// AnyVersion skips the optimistic concurrency check on Update and Delete.
+const AnyVersion int64 = -1
+
+// TaskRepository is the storage contract the HTTP layer depends on. IDs are
+// opaque strings so callers don't care which backend issued them.
+//
+// Update and Delete only apply while the task is still at version, failing
+// with ErrVersionMismatch otherwise; pass AnyVersion to write unconditionally.
+//
+// Tasks nest through ParentID. A task can only be done once all of its
+// subtasks are, and reopening or adding a subtask reopens done ancestors.
+// Delete refuses a task with subtasks unless cascade removes the subtree.
+//
+// BlockedBy lists the tasks a task waits on. Edges may not form a cycle, and
+// a task cannot move to in progress or done while a blocker is still open.
+// Deleting a task drops it from every BlockedBy.
+//
+// A task with a Recurrence belongs to the series named by SeriesID. Marking
+// it done creates the next occurrence, and ScheduleOccurrences creates every
+// occurrence due by until after the latest one of each series, returning how
+// many it made. A series never holds two tasks due at the same time.
+//
+// Batch applies ops in order. Best-effort batches report each failure in its
+// result; atomic ones apply nothing unless every op succeeds, returning the
+// first failure as a *BatchError.
+//
+// CountByStatus counts the stored tasks in each status.
+//
+// Every change, including ones a write makes to other tasks, is published
+// on the hub returned by Events.
+type TaskRepository interface {
+	List(ctx context.Context, q models.TaskQuery) (models.TaskPage, error)
+	Get(ctx context.Context, id string) (models.TaskOut, error)
+	Create(ctx context.Context, dto models.CreateTaskDTO) (models.TaskOut, error)
+	Update(ctx context.Context, id string, dto models.UpdateTaskDTO, version int64) (models.TaskOut, error)
+	Delete(ctx context.Context, id string, version int64, cascade bool) error
+	Children(ctx context.Context, id string) ([]models.TaskOut, error)
+	Tree(ctx context.Context, id string) (models.TaskNode, error)
+	Blockers(ctx context.Context, id string) ([]models.TaskOut, error)
+	ScheduleOccurrences(ctx context.Context, until time.Time) (int, error)
+	Batch(ctx context.Context, ops []BatchOp, atomic bool) ([]BatchResult, error)
+	CountByStatus(ctx context.Context) (map[models.TaskStatus]int64, error)
+	Events() *EventHub
+}
+
+var _ TaskRepository = (*TaskService)(nil)
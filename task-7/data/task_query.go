@@ -0,0 +1,185 @@
+package data
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"task_manager/models"
+)
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+// pageCursor marks the last task of a page: its value in the sort field and
+// its ID, so the next page starts strictly after it.
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+func sortKey(q models.TaskQuery) string {
+	if q.SortDesc { return "-" + q.SortBy }
+	return q.SortBy
+}
+
+// bsonField maps a JSON field name to its document key.
+func bsonField(field string) string {
+	if field == "id" { return "_id" }
+	return field
+}
+
+func encodeCursor(q models.TaskQuery, t models.TaskOut) string {
+	var v string
+	switch q.SortBy {
+	case "title":
+		v = t.Title
+	case "description":
+		v = t.Description
+	case "status":
+		v = string(t.Status)
+	case "due_date":
+		v = t.DueDate.Format(time.RFC3339Nano)
+	case "created_at":
+		v = t.CreatedAt.Format(time.RFC3339Nano)
+	case "updated_at":
+		v = t.UpdatedAt.Format(time.RFC3339Nano)
+	}
+	raw, _ := json.Marshal(pageCursor{Sort: sortKey(q), Value: v, ID: t.ID})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// cursorFilter selects the documents that sort strictly after the cursor.
+func cursorFilter(q models.TaskQuery) (bson.M, error) {
+	bad := fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil { return nil, bad }
+	var c pageCursor
+	if err := json.Unmarshal(raw, &c); err != nil { return nil, bad }
+	if c.Sort != sortKey(q) { return nil, fmt.Errorf("%w: cursor was issued for sort=%s", ErrInvalidQuery, c.Sort) }
+	oid, err := primitive.ObjectIDFromHex(c.ID)
+	if err != nil { return nil, bad }
+
+	op := "$gt"
+	if q.SortDesc {
+		op = "$lt"
+	}
+	if q.SortBy == "id" { return bson.M{"_id": bson.M{op: oid}}, nil }
+
+	var v interface{} = c.Value
+	switch q.SortBy {
+	case "due_date", "created_at", "updated_at":
+		t, err := time.Parse(time.RFC3339Nano, c.Value)
+		if err != nil { return nil, bad }
+		v = t
+	}
+	f := bsonField(q.SortBy)
+	return bson.M{"$or": bson.A{
+		bson.M{f: bson.M{op: v}},
+		bson.M{f: v, "_id": bson.M{op: oid}},
+	}}, nil
+}
+
+func queryFilter(q models.TaskQuery) bson.M {
+	filter := bson.M{}
+	if len(q.Statuses) > 0 {
+		filter["status"] = bson.M{"$in": q.Statuses}
+	}
+	if q.Title != "" {
+		filter["title"] = primitive.Regex{Pattern: regexp.QuoteMeta(q.Title), Options: "i"}
+	}
+	if len(q.Priorities) > 0 {
+		// Tasks stored before priorities existed count as the default.
+		in := bson.A{}
+		for _, p := range q.Priorities {
+			in = append(in, p)
+			if p == models.DefaultPriority {
+				in = append(in, nil)
+			}
+		}
+		filter["priority"] = bson.M{"$in": in}
+	}
+	if len(q.Labels) > 0 {
+		filter["labels"] = bson.M{"$all": q.Labels}
+	}
+	if q.Assignee != "" {
+		uid, _ := primitive.ObjectIDFromHex(q.Assignee)
+		filter["assignee"] = uid
+	}
+	addRange(filter, "due_date", q.DueFrom, q.DueTo)
+	addRange(filter, "created_at", q.CreatedFrom, q.CreatedTo)
+	addRange(filter, "updated_at", q.UpdatedFrom, q.UpdatedTo)
+	return filter
+}
+
+func addRange(filter bson.M, field string, from, to *time.Time) {
+	r := bson.M{}
+	if from != nil {
+		r["$gte"] = *from
+	}
+	if to != nil {
+		r["$lte"] = *to
+	}
+	if len(r) > 0 {
+		filter[field] = r
+	}
+}
+
+func querySort(q models.TaskQuery) bson.D {
+	dir := 1
+	if q.SortDesc {
+		dir = -1
+	}
+	if q.SortBy == "id" { return bson.D{{Key: "_id", Value: dir}} }
+	return bson.D{{Key: bsonField(q.SortBy), Value: dir}, {Key: "_id", Value: dir}}
+}
+
+// normalizeQuery fills in defaults and rejects combinations we can't serve.
+func normalizeQuery(q models.TaskQuery) (models.TaskQuery, error) {
+	if q.SortBy == "" {
+		q.SortBy = "id"
+	}
+	if !models.SortableFields[q.SortBy] { return q, fmt.Errorf("%w: cannot sort by %q", ErrInvalidQuery, q.SortBy) }
+	if q.Limit <= 0 {
+		q.Limit = models.DefaultPageLimit
+	}
+	if q.Limit > models.MaxPageLimit {
+		q.Limit = models.MaxPageLimit
+	}
+	if q.Offset < 0 { return q, fmt.Errorf("%w: offset must not be negative", ErrInvalidQuery) }
+	if q.Cursor != "" && q.Offset > 0 { return q, fmt.Errorf("%w: use either cursor or offset, not both", ErrInvalidQuery) }
+	for _, s := range q.Statuses {
+		if !models.IsValidStatus(s) { return q, ErrInvalidStatus }
+	}
+	for _, p := range q.Priorities {
+		if !models.IsValidPriority(p) { return q, ErrInvalidPriority }
+	}
+	labels, err := normalizeLabels(q.Labels)
+	if err != nil { return q, fmt.Errorf("%w: %v", ErrInvalidQuery, err) }
+	q.Labels = labels
+	q.Assignee = strings.TrimSpace(q.Assignee)
+	if _, err := primitive.ObjectIDFromHex(q.Assignee); q.Assignee != "" && err != nil { return q, fmt.Errorf("%w: assignee must be a user id", ErrInvalidQuery) }
+	return q, nil
+}
+
+// AllTasks returns every task matching q in q's sort order, reading it
+// page by page; q's paging fields are ignored.
+func AllTasks(ctx context.Context, repo TaskRepository, q models.TaskQuery) ([]models.TaskOut, error) {
+	q.Limit, q.Offset, q.Cursor = models.MaxPageLimit, 0, ""
+	var out []models.TaskOut
+	for {
+		page, err := repo.List(ctx, q)
+		if err != nil { return nil, err }
+		out = append(out, page.Data...)
+		if page.NextCursor == "" { return out, nil }
+		q.Cursor = page.NextCursor
+	}
+}
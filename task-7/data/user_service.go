@@ -2,6 +2,9 @@ package data
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"time"
 
@@ -140,3 +143,56 @@ err = s.col.FindOneAndUpdate(
 	}
 	return updated, nil
 }
+
+// NewFeedToken gives a user a new calendar feed token, replacing any old
+// one. Only its hash is stored, so the token is shown just this once.
+func (s *UserService) NewFeedToken(ctx context.Context, userID string) (string, error) {
+	token := rand.Text()
+	return token, s.setFeedToken(ctx, userID, bson.M{"$set": bson.M{"feed_token_hash": hashFeedToken(token), "updated_at": time.Now()}})
+}
+
+// RevokeFeedToken stops the user's calendar feed token from working.
+func (s *UserService) RevokeFeedToken(ctx context.Context, userID string) error {
+	return s.setFeedToken(ctx, userID, bson.M{"$unset": bson.M{"feed_token_hash": ""}, "$set": bson.M{"updated_at": time.Now()}})
+}
+
+func (s *UserService) setFeedToken(ctx context.Context, userID string, update bson.M) error {
+	ctx, cancel := context.WithTimeout(ctx, userTimeout)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	res, err := s.col.UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// FindByFeedToken returns the user a calendar feed token belongs to.
+func (s *UserService) FindByFeedToken(ctx context.Context, token string) (models.UserDB, error) {
+	ctx, cancel := context.WithTimeout(ctx, userTimeout)
+	defer cancel()
+	if token == "" {
+		return models.UserDB{}, ErrUserNotFound
+	}
+	var u models.UserDB
+	err := s.col.FindOne(ctx, bson.M{"feed_token_hash": hashFeedToken(token)}).Decode(&u)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.UserDB{}, ErrUserNotFound
+		}
+		return models.UserDB{}, err
+	}
+	return u, nil
+}
+
+func hashFeedToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
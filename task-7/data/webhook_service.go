@@ -0,0 +1,236 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"task_manager/models"
+)
+
+// WebhookService stores webhooks in hooks and their deliveries in
+// deliveries, where a TTL index ages out old ones.
+type WebhookService struct {
+	hooks      *mongo.Collection
+	deliveries *mongo.Collection
+}
+
+func NewWebhookService(hooks, deliveries *mongo.Collection) *WebhookService {
+	return &WebhookService{hooks: hooks, deliveries: deliveries}
+}
+
+func toWebhook(doc models.WebhookDB) models.Webhook {
+	return models.Webhook{
+		ID:        doc.ID.Hex(),
+		URL:       doc.URL,
+		Events:    doc.Events,
+		Secret:    doc.Secret,
+		Active:    doc.Active,
+		CreatedAt: doc.CreatedAt,
+		UpdatedAt: doc.UpdatedAt,
+	}
+}
+
+func toDelivery(doc models.WebhookDeliveryDB) models.WebhookDelivery {
+	attempts := doc.Attempts
+	if attempts == nil {
+		attempts = []models.DeliveryAttempt{}
+	}
+	return models.WebhookDelivery{
+		ID:          doc.ID.Hex(),
+		WebhookID:   doc.WebhookID.Hex(),
+		Event:       doc.Event,
+		Payload:     json.RawMessage(doc.Payload),
+		Status:      doc.Status,
+		Tries:       doc.Tries,
+		NextAttempt: doc.NextAttempt,
+		Attempts:    attempts,
+		CreatedAt:   doc.CreatedAt,
+		UpdatedAt:   doc.UpdatedAt,
+	}
+}
+
+func toDeliveryDB(d models.WebhookDelivery) (models.WebhookDeliveryDB, error) {
+	doc := models.WebhookDeliveryDB{
+		Event:       d.Event,
+		Payload:     string(d.Payload),
+		Status:      d.Status,
+		Tries:       d.Tries,
+		NextAttempt: d.NextAttempt,
+		Attempts:    d.Attempts,
+		CreatedAt:   d.CreatedAt,
+		UpdatedAt:   d.UpdatedAt,
+	}
+	var err error
+	if d.ID != "" {
+		if doc.ID, err = parseObjectID(d.ID); err != nil { return doc, ErrDeliveryNotFound }
+	}
+	if doc.WebhookID, err = parseObjectID(d.WebhookID); err != nil { return doc, ErrWebhookNotFound }
+	return doc, nil
+}
+
+func (s *WebhookService) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	cur, err := s.hooks.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil { return nil, err }
+	var docs []models.WebhookDB
+	if err := cur.All(ctx, &docs); err != nil { return nil, err }
+	out := make([]models.Webhook, 0, len(docs))
+	for _, d := range docs {
+		out = append(out, toWebhook(d))
+	}
+	return out, nil
+}
+
+func (s *WebhookService) GetWebhook(ctx context.Context, id string) (models.Webhook, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	oid, err := parseObjectID(id)
+	if err != nil { return models.Webhook{}, ErrWebhookNotFound }
+	var doc models.WebhookDB
+	err = s.hooks.FindOne(ctx, bson.M{"_id": oid}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) { return models.Webhook{}, ErrWebhookNotFound }
+	if err != nil { return models.Webhook{}, err }
+	return toWebhook(doc), nil
+}
+
+func (s *WebhookService) CreateWebhook(ctx context.Context, dto models.WebhookDTO) (models.Webhook, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var w models.Webhook
+	if err := applyWebhookDTO(&w, dto); err != nil { return models.Webhook{}, err }
+	now := time.Now().UTC()
+	doc := models.WebhookDB{
+		ID: primitive.NewObjectID(), URL: w.URL, Events: w.Events, Secret: w.Secret, Active: w.Active,
+		CreatedAt: now, UpdatedAt: now,
+	}
+	if _, err := s.hooks.InsertOne(ctx, doc); err != nil { return models.Webhook{}, err }
+	return toWebhook(doc), nil
+}
+
+func (s *WebhookService) UpdateWebhook(ctx context.Context, id string, dto models.WebhookDTO) (models.Webhook, error) {
+	w, err := s.GetWebhook(ctx, id)
+	if err != nil { return models.Webhook{}, err }
+	if err := applyWebhookDTO(&w, dto); err != nil { return models.Webhook{}, err }
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+	oid, _ := parseObjectID(id)
+	var doc models.WebhookDB
+	err = s.hooks.FindOneAndUpdate(ctx, bson.M{"_id": oid},
+		bson.M{"$set": bson.M{"url": w.URL, "events": w.Events, "secret": w.Secret, "active": w.Active, "updated_at": time.Now().UTC()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) { return models.Webhook{}, ErrWebhookNotFound }
+	if err != nil { return models.Webhook{}, err }
+	return toWebhook(doc), nil
+}
+
+func (s *WebhookService) DeleteWebhook(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	oid, err := parseObjectID(id)
+	if err != nil { return ErrWebhookNotFound }
+	res, err := s.hooks.DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil { return err }
+	if res.DeletedCount == 0 { return ErrWebhookNotFound }
+	_, err = s.deliveries.DeleteMany(ctx, bson.M{"webhook_id": oid})
+	return err
+}
+
+func (s *WebhookService) AddDelivery(ctx context.Context, d models.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	doc, err := toDeliveryDB(d)
+	if err != nil { return err }
+	_, err = s.deliveries.InsertOne(ctx, doc)
+	return err
+}
+
+func (s *WebhookService) SaveDelivery(ctx context.Context, d models.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	doc, err := toDeliveryDB(d)
+	if err != nil { return err }
+	res, err := s.deliveries.ReplaceOne(ctx, bson.M{"_id": doc.ID}, doc)
+	if err != nil { return err }
+	if res.MatchedCount == 0 { return ErrDeliveryNotFound }
+	return nil
+}
+
+func (s *WebhookService) ClaimDelivery(ctx context.Context, now, until time.Time) (models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var doc models.WebhookDeliveryDB
+	err := s.deliveries.FindOneAndUpdate(ctx,
+		bson.M{"status": models.DeliveryPending, "next_attempt": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"next_attempt": until}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "next_attempt", Value: 1}, {Key: "_id", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) { return models.WebhookDelivery{}, ErrDeliveryNotFound }
+	if err != nil { return models.WebhookDelivery{}, err }
+	return toDelivery(doc), nil
+}
+
+// Deliveries returns the newest deliveryLogSize deliveries of a webhook,
+// optionally only those with status.
+func (s *WebhookService) Deliveries(ctx context.Context, webhookID string, status models.DeliveryStatus) ([]models.WebhookDelivery, error) {
+	if _, err := s.GetWebhook(ctx, webhookID); err != nil { return nil, err }
+	oid, _ := parseObjectID(webhookID)
+	filter := bson.M{"webhook_id": oid}
+	if status != "" {
+		filter["status"] = status
+	}
+	return s.findDeliveries(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(deliveryLogSize))
+}
+
+func (s *WebhookService) findDeliveries(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	cur, err := s.deliveries.Find(ctx, filter, opts)
+	if err != nil { return nil, err }
+	var docs []models.WebhookDeliveryDB
+	if err := cur.All(ctx, &docs); err != nil { return nil, err }
+	out := make([]models.WebhookDelivery, 0, len(docs))
+	for _, d := range docs {
+		out = append(out, toDelivery(d))
+	}
+	return out, nil
+}
+
+func (s *WebhookService) Redeliver(ctx context.Context, webhookID, id string) (models.WebhookDelivery, error) {
+	if _, err := s.GetWebhook(ctx, webhookID); err != nil { return models.WebhookDelivery{}, err }
+	wid, _ := parseObjectID(webhookID)
+	oid, err := parseObjectID(id)
+	if err != nil { return models.WebhookDelivery{}, ErrDeliveryNotFound }
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+	now := time.Now().UTC()
+	var doc models.WebhookDeliveryDB
+	err = s.deliveries.FindOneAndUpdate(ctx, bson.M{"_id": oid, "webhook_id": wid},
+		bson.M{"$set": bson.M{"status": models.DeliveryPending, "tries": 0, "next_attempt": now, "updated_at": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) { return models.WebhookDelivery{}, ErrDeliveryNotFound }
+	if err != nil { return models.WebhookDelivery{}, err }
+	return toDelivery(doc), nil
+}
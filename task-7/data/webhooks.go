@@ -0,0 +1,70 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"net/url"
+	"slices"
+	"time"
+
+	"task_manager/models"
+)
+
+var (
+	ErrWebhookNotFound     = errors.New("webhook not found")
+	ErrDeliveryNotFound    = errors.New("delivery not found")
+	ErrInvalidWebhookURL   = errors.New("invalid webhook url (use an absolute http or https URL)")
+	ErrInvalidWebhookEvent = errors.New("invalid webhook event (task.created|task.updated|task.deleted)")
+)
+
+// deliveryLogSize caps how many deliveries a webhook's log lists.
+const deliveryLogSize = 1000
+
+// WebhookRepository stores webhook subscriptions and the log of their
+// deliveries. IDs are opaque strings, as in TaskRepository.
+//
+// Deleting a webhook drops its deliveries. ClaimDelivery takes the pending
+// delivery whose next attempt has been due by now the longest and, in the
+// same step, moves that attempt to until, so no one else takes it meanwhile;
+// it returns ErrDeliveryNotFound when nothing is due. Redeliver puts a
+// delivery back in that queue with a fresh set of attempts.
+type WebhookRepository interface {
+	ListWebhooks(ctx context.Context) ([]models.Webhook, error)
+	GetWebhook(ctx context.Context, id string) (models.Webhook, error)
+	CreateWebhook(ctx context.Context, dto models.WebhookDTO) (models.Webhook, error)
+	UpdateWebhook(ctx context.Context, id string, dto models.WebhookDTO) (models.Webhook, error)
+	DeleteWebhook(ctx context.Context, id string) error
+
+	AddDelivery(ctx context.Context, d models.WebhookDelivery) error
+	SaveDelivery(ctx context.Context, d models.WebhookDelivery) error
+	ClaimDelivery(ctx context.Context, now, until time.Time) (models.WebhookDelivery, error)
+	Deliveries(ctx context.Context, webhookID string, status models.DeliveryStatus) ([]models.WebhookDelivery, error)
+	Redeliver(ctx context.Context, webhookID, id string) (models.WebhookDelivery, error)
+}
+
+var _ WebhookRepository = (*WebhookService)(nil)
+
+// applyWebhookDTO checks dto and copies it onto w.
+func applyWebhookDTO(w *models.Webhook, dto models.WebhookDTO) error {
+	u, err := url.Parse(dto.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" { return ErrInvalidWebhookURL }
+	for _, e := range dto.Events {
+		if !models.IsValidWebhookEvent(e) { return ErrInvalidWebhookEvent }
+	}
+	w.URL = dto.URL
+	w.Events = slices.Compact(slices.Sorted(slices.Values(dto.Events)))
+	switch {
+	case dto.Secret != "":
+		w.Secret = dto.Secret
+	case w.Secret == "":
+		w.Secret = rand.Text()
+	}
+	w.Active = dto.Active == nil || *dto.Active
+	return nil
+}
+
+// wants reports whether w is subscribed to event.
+func wants(w models.Webhook, event string) bool {
+	return w.Active && (len(w.Events) == 0 || slices.Contains(w.Events, event))
+}
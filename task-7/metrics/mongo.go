@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// MongoMonitor times the commands a client sends, by the collection they
+// act on and their name, and counts the ones that fail. Commands that act
+// on no collection, like ping or commitTransaction, get an empty
+// collection.
+func (m *Metrics) MongoMonitor() *event.CommandMonitor {
+	var collections sync.Map // request ID → collection of a command in flight
+	finished := func(e event.CommandFinishedEvent, failed bool) {
+		coll, _ := collections.LoadAndDelete(e.RequestID)
+		name, _ := coll.(string)
+		m.mongoLatency.WithLabelValues(name, e.CommandName).Observe(e.Duration.Seconds())
+		if failed {
+			m.mongoErrors.WithLabelValues(name, e.CommandName).Inc()
+		}
+	}
+	return &event.CommandMonitor{
+		Started: func(_ context.Context, e *event.CommandStartedEvent) {
+			collections.Store(e.RequestID, collectionOf(e))
+		},
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			finished(e.CommandFinishedEvent, false)
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			finished(e.CommandFinishedEvent, true)
+		},
+	}
+}
+
+// collectionOf reads the collection a command acts on: the value of its
+// first field for most commands, the collection field for getMore.
+func collectionOf(e *event.CommandStartedEvent) string {
+	if name, ok := e.Command.Lookup(e.CommandName).StringValueOK(); ok {
+		return name
+	}
+	name, _ := e.Command.Lookup("collection").StringValueOK()
+	return name
+}
@@ -0,0 +1,256 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORSPolicy says which cross-origin requests browsers may make. Fields
+// left out take the value of the policy it overrides, and in the end those
+// of corsDefaults.
+type CORSPolicy struct {
+	// AllowedOrigins lists origins like https://app.example.com. One "*"
+	// stands for any run of subdomain characters, as in
+	// https://*.example.com, and "*" alone allows every origin.
+	AllowedOrigins []string `json:"allowed_origins,omitempty"`
+	AllowedMethods []string `json:"allowed_methods,omitempty"`
+	// AllowedHeaders are the request headers scripts may send; "*" allows
+	// any.
+	AllowedHeaders []string `json:"allowed_headers,omitempty"`
+	// ExposedHeaders are the response headers scripts may read.
+	ExposedHeaders []string `json:"exposed_headers,omitempty"`
+	// AllowCredentials lets cookies and HTTP auth through; it needs a list
+	// of origins rather than "*".
+	AllowCredentials *bool `json:"allow_credentials,omitempty"`
+	// MaxAge is how many seconds browsers may cache a preflight answer.
+	MaxAge *int `json:"max_age,omitempty"`
+}
+
+// CORSRoute overrides the policy for the request paths Path matches: one
+// path, or every path starting with Path up to a trailing "*".
+type CORSRoute struct {
+	Path string `json:"path"`
+	CORSPolicy
+}
+
+// CORSConfig is the policy for every route, and the routes that override
+// it; the first route that matches a path wins.
+type CORSConfig struct {
+	CORSPolicy
+	Routes []CORSRoute `json:"routes,omitempty"`
+}
+
+// corsDefaults fills in what a configuration leaves out. It allows no
+// origin.
+func corsDefaults() CORSPolicy {
+	no, tenMinutes := false, 600
+	return CORSPolicy{
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "If-Match", "If-None-Match", "X-Request-ID"},
+		ExposedHeaders: []string{"ETag", "Content-Disposition", "X-Request-ID",
+			"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"},
+		AllowCredentials: &no,
+		MaxAge:           &tenMinutes,
+	}
+}
+
+// LoadCORSConfig reads a configuration from a JSON file.
+func LoadCORSConfig(path string) (CORSConfig, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return CORSConfig{}, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	var cfg CORSConfig
+	if err := dec.Decode(&cfg); err != nil {
+		return CORSConfig{}, fmt.Errorf("cors %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// over returns p with the fields o sets replaced.
+func (p CORSPolicy) over(o CORSPolicy) CORSPolicy {
+	if o.AllowedOrigins != nil {
+		p.AllowedOrigins = o.AllowedOrigins
+	}
+	if o.AllowedMethods != nil {
+		p.AllowedMethods = o.AllowedMethods
+	}
+	if o.AllowedHeaders != nil {
+		p.AllowedHeaders = o.AllowedHeaders
+	}
+	if o.ExposedHeaders != nil {
+		p.ExposedHeaders = o.ExposedHeaders
+	}
+	if o.AllowCredentials != nil {
+		p.AllowCredentials = o.AllowCredentials
+	}
+	if o.MaxAge != nil {
+		p.MaxAge = o.MaxAge
+	}
+	return p
+}
+
+// corsRule is a complete policy, ready to answer requests.
+type corsRule struct {
+	anyOrigin   bool
+	origins     []string    // exact, lowercased
+	patterns    [][2]string // prefix and suffix around a "*"
+	anyHeader   bool
+	credentials bool
+	methods     string
+	headers     string
+	exposed     string
+	maxAge      string
+}
+
+func compileCORS(p CORSPolicy) (*corsRule, error) {
+	r := &corsRule{
+		credentials: *p.AllowCredentials,
+		methods:     strings.Join(p.AllowedMethods, ", "),
+		headers:     strings.Join(p.AllowedHeaders, ", "),
+		exposed:     strings.Join(p.ExposedHeaders, ", "),
+		maxAge:      strconv.Itoa(*p.MaxAge),
+	}
+	for _, o := range p.AllowedOrigins {
+		o = strings.ToLower(o)
+		switch n := strings.Count(o, "*"); {
+		case o == "*":
+			r.anyOrigin = true
+		case !strings.Contains(o, "://") || strings.HasSuffix(o, "/"):
+			return nil, fmt.Errorf("origin %q: use scheme://host[:port], e.g. https://app.example.com", o)
+		case n == 0:
+			r.origins = append(r.origins, o)
+		case n == 1:
+			prefix, suffix, _ := strings.Cut(o, "*")
+			r.patterns = append(r.patterns, [2]string{prefix, suffix})
+		default:
+			return nil, fmt.Errorf("origin %q: only one * is allowed", o)
+		}
+	}
+	if r.anyOrigin && r.credentials {
+		return nil, fmt.Errorf(`allow_credentials needs a list of origins, not "*"`)
+	}
+	if *p.MaxAge < 0 {
+		return nil, fmt.Errorf("max_age must not be negative")
+	}
+	r.anyHeader = slices.Contains(p.AllowedHeaders, "*")
+	return r, nil
+}
+
+func (r *corsRule) allows(origin string) bool {
+	if r.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if slices.Contains(r.origins, origin) {
+		return true
+	}
+	for _, p := range r.patterns {
+		if len(origin) > len(p[0])+len(p[1]) && strings.HasPrefix(origin, p[0]) && strings.HasSuffix(origin, p[1]) {
+			// The "*" can't reach across a ":", "/" or "@" into another
+			// part of the origin.
+			if !strings.ContainsAny(origin[len(p[0]):len(origin)-len(p[1])], "/:@") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CORS answers cross-origin requests by cfg. Preflights, OPTIONS requests
+// with Access-Control-Request-Method, are answered here with 204, or 403
+// when the origin is not allowed. Other requests go on to their route; those
+// from an origin that is not allowed get no CORS headers, so browsers
+// withhold the answer from the script.
+func CORS(cfg CORSConfig) (gin.HandlerFunc, error) {
+	policy := corsDefaults().over(cfg.CORSPolicy)
+	def, err := compileCORS(policy)
+	if err != nil {
+		return nil, fmt.Errorf("cors: %w", err)
+	}
+	type route struct {
+		path   string
+		prefix bool
+		rule   *corsRule
+	}
+	var routes []route
+	for _, rt := range cfg.Routes {
+		if !strings.HasPrefix(rt.Path, "/") {
+			return nil, fmt.Errorf("cors route %q: path must start with /", rt.Path)
+		}
+		rule, err := compileCORS(policy.over(rt.CORSPolicy))
+		if err != nil {
+			return nil, fmt.Errorf("cors route %s: %w", rt.Path, err)
+		}
+		path, prefix := strings.CutSuffix(rt.Path, "*")
+		routes = append(routes, route{path, prefix, rule})
+	}
+	ruleFor := func(path string) *corsRule {
+		for _, rt := range routes {
+			if path == rt.path || rt.prefix && strings.HasPrefix(path, rt.path) {
+				return rt.rule
+			}
+		}
+		return def
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		rule := ruleFor(c.Request.URL.Path)
+		h := c.Writer.Header()
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if !rule.anyOrigin || rule.credentials {
+			h.Add("Vary", "Origin")
+		}
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+		}
+		if !rule.allows(origin) {
+			if preflight {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "origin not allowed"})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if rule.anyOrigin && !rule.credentials {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if rule.credentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			if rule.exposed != "" {
+				h.Set("Access-Control-Expose-Headers", rule.exposed)
+			}
+			c.Next()
+			return
+		}
+		h.Set("Access-Control-Allow-Methods", rule.methods)
+		if rule.anyHeader {
+			h.Set("Access-Control-Allow-Headers", c.GetHeader("Access-Control-Request-Headers"))
+		} else if rule.headers != "" {
+			h.Set("Access-Control-Allow-Headers", rule.headers)
+		}
+		h.Set("Access-Control-Max-Age", rule.maxAge)
+		c.AbortWithStatus(http.StatusNoContent)
+	}, nil
+}
@@ -0,0 +1,177 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limit lets a client make Requests requests per Per, in bursts of up to
+// Requests: a token bucket holding Requests tokens that refills at
+// Requests/Per.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// rate is the refill rate in tokens per second.
+func (l Limit) rate() float64 { return float64(l.Requests) / l.Per.Seconds() }
+
+// ParseLimit reads a limit written as requests/period, like "60/1m" or
+// "5/s". "off" gives the zero Limit, which doesn't limit.
+func ParseLimit(s string) (Limit, error) {
+	if s == "off" {
+		return Limit{}, nil
+	}
+	n, per, found := strings.Cut(s, "/")
+	if !found {
+		return Limit{}, fmt.Errorf("invalid rate limit %q (use requests/period, e.g. 60/1m, or off)", s)
+	}
+	var l Limit
+	var err error
+	if l.Requests, err = strconv.Atoi(n); err != nil || l.Requests <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: requests must be a positive integer", s)
+	}
+	if per == "s" || per == "m" || per == "h" {
+		per = "1" + per
+	}
+	if l.Per, err = time.ParseDuration(per); err != nil || l.Per <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: period must be a positive duration", s)
+	}
+	return l, nil
+}
+
+// Decision is a rate store's answer for one request.
+type Decision struct {
+	Allowed    bool
+	Remaining  int           // whole tokens left after this request
+	RetryAfter time.Duration // until the next token, when not allowed
+	Reset      time.Duration // until the bucket is full again
+}
+
+// RateStore keeps the token buckets. Take spends a token from the bucket
+// of key, creating a full one on first use, and must be safe for
+// concurrent use.
+type RateStore interface {
+	Take(key string, l Limit, now time.Time) Decision
+}
+
+// MemoryRateStore keeps buckets in process memory, so each instance of the
+// server limits on its own. Buckets that have refilled are dropped.
+type MemoryRateStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time // when tokens was computed
+	full   time.Time // when the bucket will be full again
+}
+
+// sweepInterval is how often idle buckets are dropped.
+const sweepInterval = time.Minute
+
+func NewMemoryRateStore() *MemoryRateStore {
+	return &MemoryRateStore{buckets: make(map[string]*bucket)}
+}
+
+func (s *MemoryRateStore) Take(key string, l Limit, now time.Time) Decision {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		for k, b := range s.buckets {
+			if !now.Before(b.full) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	burst, rate := float64(l.Requests), l.rate()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		s.buckets[key] = b
+	}
+	b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	var d Decision
+	if b.tokens >= 1 {
+		b.tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	d.Remaining = int(b.tokens)
+	d.Reset = seconds((burst - b.tokens) / rate)
+	b.full = now.Add(d.Reset)
+	return d
+}
+
+func seconds(s float64) time.Duration { return time.Duration(s * float64(time.Second)) }
+
+// KeyFunc names the client a request is counted against.
+type KeyFunc func(c *gin.Context) string
+
+// ByIP counts requests against the client's IP address.
+func ByIP(c *gin.Context) string { return "ip:" + c.ClientIP() }
+
+// ByUser counts requests against the uid of the caller's token, so users
+// behind one address don't share a budget. It follows AuthRequired, and
+// falls back to the IP address without a uid.
+func ByUser(c *gin.Context) string {
+	if uid := c.GetString(CtxUserIDKey); uid != "" {
+		return "user:" + uid
+	}
+	return ByIP(c)
+}
+
+// RateLimiter applies a limit per route group, each group with its own
+// buckets. A group without a limit, or with the zero Limit, isn't limited,
+// and neither is anything when the limiter is nil.
+type RateLimiter struct {
+	Store  RateStore
+	Limits map[string]Limit
+}
+
+func NewRateLimiter(store RateStore) *RateLimiter {
+	return &RateLimiter{Store: store, Limits: make(map[string]Limit)}
+}
+
+// Limit returns the middleware that limits the routes of group, counting
+// each request against key(c). Every answer carries RateLimit-Limit,
+// RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy; a request over
+// the limit gets 429 with Retry-After.
+func (rl *RateLimiter) Limit(group string, key KeyFunc) gin.HandlerFunc {
+	if rl == nil || rl.Limits[group].Requests == 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	l := rl.Limits[group]
+	policy := fmt.Sprintf("%d;w=%d", l.Requests, ceilSeconds(l.Per))
+	return func(c *gin.Context) {
+		d := rl.Store.Take(group+"|"+key(c), l, time.Now())
+		h := c.Writer.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(l.Requests))
+		h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.Reset)))
+		h.Set("RateLimit-Policy", policy)
+		if !d.Allowed {
+			h.Set("Retry-After", strconv.Itoa(max(ceilSeconds(d.RetryAfter), 1)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// ceilSeconds rounds d up to whole seconds, as the headers count them.
+func ceilSeconds(d time.Duration) int { return int(math.Ceil(d.Seconds())) }
@@ -10,12 +10,13 @@ const (
 )
 
 type UserDB struct {
-	ID           interface{} `bson:"_id,omitempty"`
-	Username     string      `bson:"username"`
-	PasswordHash string      `bson:"password_hash"`
-	Role         Role        `bson:"role"`
-	CreatedAt    time.Time   `bson:"created_at"`
-	UpdatedAt    time.Time   `bson:"updated_at"`
+	ID            interface{} `bson:"_id,omitempty"`
+	Username      string      `bson:"username"`
+	PasswordHash  string      `bson:"password_hash"`
+	Role          Role        `bson:"role"`
+	FeedTokenHash string      `bson:"feed_token_hash,omitempty"` // SHA-256 of the calendar feed token
+	CreatedAt     time.Time   `bson:"created_at"`
+	UpdatedAt     time.Time   `bson:"updated_at"`
 }
 
 type RegisterDTO struct {
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Webhook events, one per kind of task change.
+const (
+	WebhookTaskCreated = "task.created"
+	WebhookTaskUpdated = "task.updated"
+	WebhookTaskDeleted = "task.deleted"
+)
+
+func IsValidWebhookEvent(e string) bool {
+	switch e {
+	case WebhookTaskCreated, WebhookTaskUpdated, WebhookTaskDeleted:
+		return true
+	default:
+		return false
+	}
+}
+
+// Webhook subscribes URL to task changes. An empty Events means every
+// event. Secret signs each delivery and is only shown when the webhook is
+// created.
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events,omitempty"`
+	Secret    string    `json:"secret,omitempty"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WebhookDTO creates or replaces a webhook. A blank Secret is generated on
+// create and left alone on update; Active defaults to true.
+type WebhookDTO struct {
+	URL    string   `json:"url" binding:"required"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+	Active *bool    `json:"active"`
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"   // waiting for its next attempt
+	DeliverySucceeded DeliveryStatus = "succeeded" // the receiver answered 2xx
+	DeliveryFailed    DeliveryStatus = "failed"    // out of attempts: a dead letter
+)
+
+func IsValidDeliveryStatus(s DeliveryStatus) bool {
+	switch s {
+	case DeliveryPending, DeliverySucceeded, DeliveryFailed:
+		return true
+	default:
+		return false
+	}
+}
+
+// WebhookDelivery is one event on its way to one webhook, with a log of
+// every attempt to send it.
+type WebhookDelivery struct {
+	ID          string            `json:"id"`
+	WebhookID   string            `json:"webhook_id"`
+	Event       string            `json:"event"`
+	Payload     json.RawMessage   `json:"payload"`
+	Status      DeliveryStatus    `json:"status"`
+	Tries       int               `json:"tries"`                  // attempts since it was queued or redelivered
+	NextAttempt *time.Time        `json:"next_attempt,omitempty"` // pending only
+	Attempts    []DeliveryAttempt `json:"attempts"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+type DeliveryAttempt struct {
+	At         time.Time `json:"at" bson:"at"`
+	StatusCode int       `json:"status_code,omitempty" bson:"status_code,omitempty"` // 0 when no response came back
+	Response   string    `json:"response,omitempty" bson:"response,omitempty"`       // start of the response body
+	Error      string    `json:"error,omitempty" bson:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms" bson:"duration_ms"`
+}
+
+type WebhookDB struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	URL       string             `bson:"url"`
+	Events    []string           `bson:"events,omitempty"`
+	Secret    string             `bson:"secret"`
+	Active    bool               `bson:"active"`
+	CreatedAt time.Time          `bson:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at"`
+}
+
+// WebhookDeliveryDB keeps the payload as a string so it is stored exactly
+// as it is sent and signed.
+type WebhookDeliveryDB struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	WebhookID   primitive.ObjectID `bson:"webhook_id"`
+	Event       string             `bson:"event"`
+	Payload     string             `bson:"payload"`
+	Status      DeliveryStatus     `bson:"status"`
+	Tries       int                `bson:"tries"`
+	NextAttempt *time.Time         `bson:"next_attempt,omitempty"`
+	Attempts    []DeliveryAttempt  `bson:"attempts"`
+	CreatedAt   time.Time          `bson:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at"`
+}
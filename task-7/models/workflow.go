@@ -0,0 +1,192 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// StatusCategory tells the rest of the system what a status means, so rules
+// like "a task is done once its subtasks are" work with any set of names.
+type StatusCategory string
+
+const (
+	CategoryTodo   StatusCategory = "todo"
+	CategoryActive StatusCategory = "active"
+	CategoryDone   StatusCategory = "done"
+)
+
+type WorkflowStatus struct {
+	Name     TaskStatus     `json:"name"`
+	Category StatusCategory `json:"category"`
+}
+
+// Workflow defines the statuses a task can be in and how it may move
+// between them.
+type Workflow struct {
+	Statuses []WorkflowStatus `json:"statuses"`
+	// Initial lists the statuses a task may be created in; empty allows all.
+	Initial []TaskStatus `json:"initial,omitempty"`
+	// Transitions maps a status to the ones it may move to. Without it any
+	// move is allowed; with it, a status missing as a key is final.
+	Transitions map[TaskStatus][]TaskStatus `json:"transitions,omitempty"`
+	// Reopen is where a done task goes when one of its subtasks reopens.
+	// It defaults to the first active status.
+	Reopen TaskStatus `json:"reopen,omitempty"`
+	// Migrate rewrites stored statuses on startup, old name to new.
+	Migrate map[TaskStatus]TaskStatus `json:"migrate,omitempty"`
+}
+
+// DefaultWorkflow is pending, in progress and done with every move allowed.
+func DefaultWorkflow() *Workflow {
+	return &Workflow{
+		Statuses: []WorkflowStatus{
+			{Name: StatusPending, Category: CategoryTodo},
+			{Name: StatusInProgress, Category: CategoryActive},
+			{Name: StatusDone, Category: CategoryDone},
+		},
+		Reopen: StatusInProgress,
+	}
+}
+
+// LoadWorkflow reads a workflow from a JSON file and validates it.
+func LoadWorkflow(path string) (*Workflow, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	var w Workflow
+	if err := dec.Decode(&w); err != nil {
+		return nil, fmt.Errorf("workflow %s: %w", path, err)
+	}
+	if err := w.Validate(); err != nil {
+		return nil, fmt.Errorf("workflow %s: %w", path, err)
+	}
+	return &w, nil
+}
+
+// Validate checks that every status the workflow mentions is defined and
+// fills in Reopen when it is left out.
+func (w *Workflow) Validate() error {
+	seen := make(map[TaskStatus]bool)
+	var hasDone bool
+	for _, s := range w.Statuses {
+		switch {
+		case s.Name == "":
+			return fmt.Errorf("status without a name")
+		case seen[s.Name]:
+			return fmt.Errorf("status %q is defined twice", s.Name)
+		case s.Category != CategoryTodo && s.Category != CategoryActive && s.Category != CategoryDone:
+			return fmt.Errorf("status %q: category must be todo, active or done", s.Name)
+		}
+		seen[s.Name] = true
+		if s.Category == CategoryDone {
+			hasDone = true
+		}
+		if w.Reopen == "" && s.Category == CategoryActive {
+			w.Reopen = s.Name
+		}
+	}
+	if !hasDone {
+		return fmt.Errorf("at least one status must have category done")
+	}
+	if w.Category(w.Reopen) != CategoryActive {
+		return fmt.Errorf("reopen must name an active status")
+	}
+	for _, s := range w.Initial {
+		if !seen[s] {
+			return fmt.Errorf("initial status %q is not defined", s)
+		}
+	}
+	for from, tos := range w.Transitions {
+		if !seen[from] {
+			return fmt.Errorf("transition from undefined status %q", from)
+		}
+		for _, to := range tos {
+			if !seen[to] {
+				return fmt.Errorf("transition from %q to undefined status %q", from, to)
+			}
+		}
+	}
+	for from, to := range w.Migrate {
+		if !seen[to] {
+			return fmt.Errorf("migrate %q to undefined status %q", from, to)
+		}
+	}
+	return nil
+}
+
+// Category returns the category of s, or "" if the workflow doesn't know it.
+func (w *Workflow) Category(s TaskStatus) StatusCategory {
+	for _, ws := range w.Statuses {
+		if ws.Name == s {
+			return ws.Category
+		}
+	}
+	return ""
+}
+
+// Names lists the statuses in definition order.
+func (w *Workflow) Names() []TaskStatus {
+	names := make([]TaskStatus, len(w.Statuses))
+	for i, s := range w.Statuses {
+		names[i] = s.Name
+	}
+	return names
+}
+
+// InCategory lists the statuses of category c.
+func (w *Workflow) InCategory(c StatusCategory) []TaskStatus {
+	var names []TaskStatus
+	for _, s := range w.Statuses {
+		if s.Category == c {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+// InitialStatuses lists the statuses a task may be created in.
+func (w *Workflow) InitialStatuses() []TaskStatus {
+	if len(w.Initial) == 0 {
+		return w.Names()
+	}
+	return w.Initial
+}
+
+// Next lists the statuses a task in from may move to, besides staying put.
+func (w *Workflow) Next(from TaskStatus) []TaskStatus {
+	if w.Transitions == nil {
+		return slices.DeleteFunc(w.Names(), func(s TaskStatus) bool { return s == from })
+	}
+	return w.Transitions[from]
+}
+
+// CanMove reports whether a task may go from one status to another.
+func (w *Workflow) CanMove(from, to TaskStatus) bool {
+	return from == to || slices.Contains(w.Next(from), to)
+}
+
+var workflow = DefaultWorkflow()
+
+// SetWorkflow replaces the active workflow. Call it once at startup, before
+// serving requests.
+func SetWorkflow(w *Workflow) { workflow = w }
+
+// CurrentWorkflow returns the active workflow.
+func CurrentWorkflow() *Workflow { return workflow }
+
+func IsValidStatus(s TaskStatus) bool { return workflow.Category(s) != "" }
+
+// IsDone reports whether s counts as finished.
+func IsDone(s TaskStatus) bool { return workflow.Category(s) == CategoryDone }
+
+// IsStarted reports whether work on a task in s has begun.
+func IsStarted(s TaskStatus) bool {
+	c := workflow.Category(s)
+	return c == CategoryActive || c == CategoryDone
+}
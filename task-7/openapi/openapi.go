@@ -0,0 +1,359 @@
+// Package openapi describes a Gin API as an OpenAPI 3 document. Paths come
+// from the routes the engine has registered and schemas from the Go types of
+// the request and response bodies, so the document follows the code; what
+// reflection can't see, like summaries and query parameters, is given per
+// operation. Routes without an operation and operations without a route are
+// reported as drift.
+package openapi
+
+import (
+	"cmp"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Version is the OpenAPI version documents are written in.
+const Version = "3.0.3"
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Tags       []Tag               `json:"tags,omitempty"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations of one path by lower-case method.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Roles       []string              `json:"x-roles,omitempty"` // roles the caller needs beyond a valid token
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required,omitempty"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// Schema is the subset of JSON Schema that Go types map to. An empty schema
+// takes any value.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Who may call an operation.
+type Access int
+
+const (
+	Public Access = iota
+	User          // any caller with a valid bearer token
+	Admin         // a caller whose token carries the admin role
+)
+
+// Content gives a body by media type, each as a value of the Go type that
+// describes it; a string stands for a body that is not JSON.
+type Content map[string]any
+
+// JSON is a JSON body shaped like v.
+func JSON(v any) Content { return Content{"application/json": v} }
+
+// Op describes the operation served at one route. Parameters named in Path,
+// in Gin syntax, are documented as path parameters of type string.
+type Op struct {
+	Method      string
+	Path        string
+	Tag         string
+	Summary     string
+	Description string
+	Access      Access
+	Params      []Param
+	Body        Content // nil when it takes none
+	Responses   []Resp
+}
+
+// Param is a query or header parameter. Type is a value of its Go type;
+// nil means a string.
+type Param struct {
+	Name        string
+	In          string // "query" or "header"
+	Description string
+	Required    bool
+	Type        any
+	Enum        []string
+}
+
+func Query(name, description string) Param {
+	return Param{Name: name, In: "query", Description: description}
+}
+
+func HeaderParam(name, description string) Param {
+	return Param{Name: name, In: "header", Description: description}
+}
+
+// Resp is one answer of an operation. Headers maps the names of the
+// response headers it sets to their descriptions.
+type Resp struct {
+	Status      int
+	Description string // defaults to the status text
+	Body        Content
+	Headers     map[string]string
+}
+
+// Spec is everything a document is built from besides the routes.
+type Spec struct {
+	Info Info
+	Tags []Tag
+	Ops  []Op
+
+	// Enums lists the values of string types with a fixed set, like task
+	// statuses; other named string types are plain strings.
+	Enums map[reflect.Type][]string
+	// Error is the body of error answers, used for the 401 and 403 that
+	// secured operations may give.
+	Error any
+}
+
+// DriftError lists the differences between the routes and the operations,
+// each as "METHOD /path" in Gin syntax.
+type DriftError struct {
+	Undocumented []string // routes without an operation
+	Unrouted     []string // operations without a route
+}
+
+func (e *DriftError) Error() string {
+	var parts []string
+	if len(e.Undocumented) > 0 {
+		parts = append(parts, "undocumented routes: "+strings.Join(e.Undocumented, ", "))
+	}
+	if len(e.Unrouted) > 0 {
+		parts = append(parts, "operations without a route: "+strings.Join(e.Unrouted, ", "))
+	}
+	return "openapi: " + strings.Join(parts, "; ")
+}
+
+// Build writes the document for routes. It covers every route: one without
+// an operation is still listed, bare, and makes Build return a *DriftError
+// alongside the document, as does an operation without a route, which is
+// left out.
+func (s Spec) Build(routes gin.RoutesInfo) (*Document, error) {
+	g := &generator{enums: s.Enums, schemas: map[string]*Schema{}, names: map[reflect.Type]string{}}
+	doc := &Document{
+		OpenAPI:    Version,
+		Info:       s.Info,
+		Tags:       s.Tags,
+		Paths:      map[string]PathItem{},
+		Components: Components{Schemas: g.schemas},
+	}
+
+	ops := make(map[string]Op, len(s.Ops))
+	for _, op := range s.Ops {
+		ops[routeKey(op.Method, op.Path)] = op
+	}
+	drift := &DriftError{}
+	routed := make(map[string]bool, len(routes))
+	for _, r := range routes {
+		key := routeKey(r.Method, r.Path)
+		routed[key] = true
+		op, ok := ops[key]
+		if !ok {
+			drift.Undocumented = append(drift.Undocumented, key)
+			op = Op{Method: r.Method, Path: r.Path, Summary: "Undocumented", Responses: []Resp{{Status: http.StatusOK}}}
+		}
+		path := openAPIPath(r.Path)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = PathItem{}
+		}
+		doc.Paths[path][strings.ToLower(r.Method)] = g.operation(op, s.Error)
+		if op.Access != Public {
+			doc.Components.SecuritySchemes = map[string]SecurityScheme{
+				"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT", Description: "A JWT, sent as Authorization: Bearer <token>."},
+			}
+		}
+	}
+	for _, op := range s.Ops {
+		if key := routeKey(op.Method, op.Path); !routed[key] {
+			drift.Unrouted = append(drift.Unrouted, key)
+		}
+	}
+
+	if len(drift.Undocumented) > 0 || len(drift.Unrouted) > 0 {
+		slices.Sort(drift.Undocumented)
+		slices.Sort(drift.Unrouted)
+		return doc, drift
+	}
+	return doc, nil
+}
+
+func routeKey(method, path string) string { return strings.ToUpper(method) + " " + path }
+
+// openAPIPath turns /tasks/:id and /files/*path into /tasks/{id} and
+// /files/{path}.
+func openAPIPath(path string) string {
+	segs := strings.Split(path, "/")
+	for i, seg := range segs {
+		if name, ok := pathParam(seg); ok {
+			segs[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+func pathParam(seg string) (string, bool) {
+	if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+		return seg[1:], true
+	}
+	return "", false
+}
+
+func (g *generator) operation(op Op, errBody any) *Operation {
+	out := &Operation{
+		Summary:     op.Summary,
+		Description: op.Description,
+		OperationID: operationID(op.Method, op.Path),
+		Responses:   map[string]Response{},
+	}
+	if op.Tag != "" {
+		out.Tags = []string{op.Tag}
+	}
+	for _, seg := range strings.Split(op.Path, "/") {
+		if name, ok := pathParam(seg); ok {
+			out.Parameters = append(out.Parameters, Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+	}
+	for _, p := range op.Params {
+		schema := &Schema{Type: "string"}
+		if p.Type != nil {
+			schema = g.schema(reflect.TypeOf(p.Type))
+		}
+		if len(p.Enum) > 0 {
+			schema.Enum = p.Enum
+		}
+		out.Parameters = append(out.Parameters, Parameter{Name: p.Name, In: p.In, Description: p.Description, Required: p.Required, Schema: schema})
+	}
+	if op.Body != nil {
+		out.RequestBody = &RequestBody{Required: true, Content: g.content(op.Body)}
+	}
+	for _, r := range op.Responses {
+		resp := Response{Description: cmp.Or(r.Description, http.StatusText(r.Status)), Content: g.content(r.Body)}
+		for name, desc := range r.Headers {
+			if resp.Headers == nil {
+				resp.Headers = map[string]Header{}
+			}
+			resp.Headers[name] = Header{Description: desc, Schema: &Schema{Type: "string"}}
+		}
+		out.Responses[strconv.Itoa(r.Status)] = resp
+	}
+
+	if op.Access == Public {
+		return out
+	}
+	out.Security = []map[string][]string{{"bearerAuth": {}}}
+	secured := []Resp{{Status: http.StatusUnauthorized, Description: "Missing, invalid or expired token"}}
+	if op.Access == Admin {
+		out.Roles = []string{"admin"}
+		secured = append(secured, Resp{Status: http.StatusForbidden, Description: "The token is not an admin's"})
+	}
+	for _, r := range secured {
+		if _, ok := out.Responses[strconv.Itoa(r.Status)]; ok {
+			continue
+		}
+		if errBody != nil {
+			r.Body = JSON(errBody)
+		}
+		out.Responses[strconv.Itoa(r.Status)] = Response{Description: r.Description, Content: g.content(r.Body)}
+	}
+	return out
+}
+
+func (g *generator) content(c Content) map[string]MediaType {
+	if len(c) == 0 {
+		return nil
+	}
+	out := make(map[string]MediaType, len(c))
+	for mediaType, v := range c {
+		out[mediaType] = MediaType{Schema: g.schema(reflect.TypeOf(v))}
+	}
+	return out
+}
+
+// operationID names an operation after its method and path, e.g.
+// GET /tasks/:id/children becomes getTasksIdChildren.
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, word := range strings.FieldsFunc(path, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+	}) {
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return b.String()
+}
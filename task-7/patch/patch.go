@@ -0,0 +1,318 @@
+// Package patch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents to JSON values.
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalid means the patch document itself is malformed or refers to
+	// a location that doesn't exist.
+	ErrInvalid = errors.New("invalid patch")
+	// ErrTestFailed means a JSON Patch "test" operation did not hold.
+	ErrTestFailed = errors.New("patch test failed")
+)
+
+// Merge applies an RFC 7396 merge patch to doc.
+func Merge(doc, patch []byte) ([]byte, error) {
+	var target, p any
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return json.Marshal(mergeValue(target, p))
+}
+
+func mergeValue(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergeValue(t[k], v)
+		}
+	}
+	return t
+}
+
+// Operation is one step of an RFC 6902 patch.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Apply runs an RFC 6902 patch against doc. Operations are applied in order
+// to a private copy, so either all of them take effect or none do.
+func Apply(doc, patch []byte) ([]byte, error) {
+	var ops []Operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	var root any
+	if err := json.Unmarshal(doc, &root); err != nil {
+		return nil, err
+	}
+	for i, op := range ops {
+		var err error
+		if root, err = applyOp(root, op); err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return json.Marshal(root)
+}
+
+func applyOp(root any, op Operation) (any, error) {
+	value := func() (any, error) {
+		if len(op.Value) == 0 {
+			return nil, fmt.Errorf("%w: missing value", ErrInvalid)
+		}
+		var v any
+		err := json.Unmarshal(op.Value, &v)
+		return v, err
+	}
+
+	switch op.Op {
+	case "add":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		return add(root, op.Path, v)
+	case "remove":
+		root, _, err := remove(root, op.Path)
+		return root, err
+	case "replace":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		if op.Path == "" {
+			return v, nil
+		}
+		if root, _, err = remove(root, op.Path); err != nil {
+			return nil, err
+		}
+		return add(root, op.Path, v)
+	case "move":
+		if op.Path != op.From && strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, fmt.Errorf("%w: cannot move a value into itself", ErrInvalid)
+		}
+		root, v, err := remove(root, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, op.Path, v)
+	case "copy":
+		v, err := get(root, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, op.Path, deepCopy(v))
+	case "test":
+		want, err := value()
+		if err != nil {
+			return nil, err
+		}
+		got, err := get(root, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(got, want) {
+			return nil, ErrTestFailed
+		}
+		return root, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", ErrInvalid, op.Op)
+	}
+}
+
+// parsePointer splits an RFC 6901 pointer into unescaped reference tokens.
+func parsePointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return nil, nil
+	}
+	if ptr[0] != '/' {
+		return nil, fmt.Errorf("%w: pointer %q must start with /", ErrInvalid, ptr)
+	}
+	tokens := strings.Split(ptr[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func arrayIndex(tok string, n int, appendOK bool) (int, error) {
+	if appendOK && tok == "-" {
+		return n, nil
+	}
+	i, err := strconv.Atoi(tok)
+	if err != nil || i < 0 || (tok != "0" && tok[0] == '0') {
+		return 0, fmt.Errorf("%w: bad array index %q", ErrInvalid, tok)
+	}
+	limit := n - 1
+	if appendOK {
+		limit = n
+	}
+	if i > limit {
+		return 0, fmt.Errorf("%w: array index %d out of range", ErrInvalid, i)
+	}
+	return i, nil
+}
+
+func get(root any, ptr string) (any, error) {
+	tokens, err := parsePointer(ptr)
+	if err != nil {
+		return nil, err
+	}
+	cur := root
+	for _, tok := range tokens {
+		switch c := cur.(type) {
+		case map[string]any:
+			v, ok := c[tok]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s does not exist", ErrInvalid, ptr)
+			}
+			cur = v
+		case []any:
+			i, err := arrayIndex(tok, len(c), false)
+			if err != nil {
+				return nil, err
+			}
+			cur = c[i]
+		default:
+			return nil, fmt.Errorf("%w: %s does not exist", ErrInvalid, ptr)
+		}
+	}
+	return cur, nil
+}
+
+// update walks to the parent of ptr and replaces its child through fn, then
+// rebuilds the path so slices that grew or shrank are stored back.
+func update(root any, ptr string, fn func(parent any, tok string) (any, error)) (any, error) {
+	tokens, err := parsePointer(ptr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: cannot modify the whole document here", ErrInvalid)
+	}
+	var walk func(node any, toks []string) (any, error)
+	walk = func(node any, toks []string) (any, error) {
+		if len(toks) == 1 {
+			return fn(node, toks[0])
+		}
+		switch c := node.(type) {
+		case map[string]any:
+			child, ok := c[toks[0]]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s does not exist", ErrInvalid, ptr)
+			}
+			v, err := walk(child, toks[1:])
+			if err != nil {
+				return nil, err
+			}
+			c[toks[0]] = v
+			return c, nil
+		case []any:
+			i, err := arrayIndex(toks[0], len(c), false)
+			if err != nil {
+				return nil, err
+			}
+			v, err := walk(c[i], toks[1:])
+			if err != nil {
+				return nil, err
+			}
+			c[i] = v
+			return c, nil
+		default:
+			return nil, fmt.Errorf("%w: %s does not exist", ErrInvalid, ptr)
+		}
+	}
+	return walk(root, tokens)
+}
+
+func add(root any, ptr string, v any) (any, error) {
+	if ptr == "" {
+		return v, nil
+	}
+	return update(root, ptr, func(parent any, tok string) (any, error) {
+		switch c := parent.(type) {
+		case map[string]any:
+			c[tok] = v
+			return c, nil
+		case []any:
+			i, err := arrayIndex(tok, len(c), true)
+			if err != nil {
+				return nil, err
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = v
+			return c, nil
+		default:
+			return nil, fmt.Errorf("%w: parent of %s is not a container", ErrInvalid, ptr)
+		}
+	})
+}
+
+func remove(root any, ptr string) (any, any, error) {
+	var removed any
+	root, err := update(root, ptr, func(parent any, tok string) (any, error) {
+		switch c := parent.(type) {
+		case map[string]any:
+			v, ok := c[tok]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s does not exist", ErrInvalid, ptr)
+			}
+			removed = v
+			delete(c, tok)
+			return c, nil
+		case []any:
+			i, err := arrayIndex(tok, len(c), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = c[i]
+			return append(c[:i:i], c[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("%w: %s does not exist", ErrInvalid, ptr)
+		}
+	})
+	return root, removed, err
+}
+
+func deepCopy(v any) any {
+	switch c := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(c))
+		for k, e := range c {
+			m[k] = deepCopy(e)
+		}
+		return m
+	case []any:
+		s := make([]any, len(c))
+		for i, e := range c {
+			s[i] = deepCopy(e)
+		}
+		return s
+	default:
+		return v
+	}
+}